@@ -0,0 +1,85 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ArchiveFilename is the filename GET /blobs?action=archive suggests in its Content-Disposition header.
+const ArchiveFilename = "blobs.tar.gz"
+
+// handleGETArchive streams every blob as a tar.gz archive with one file per blob, named by its id.
+// The "blob:" range is scanned a page at a time and each page is written out before the next is fetched,
+// so memory use does not grow with the size of the store.
+// The first page is fetched before anything is written, so a TiKV that is down still gets a JSON error.
+// A failure after that can only be logged, and the client is left with a truncated archive.
+func handleGETArchive(w http.ResponseWriter, r *http.Request, client RawKVClientInterface) {
+	startKey := blobStart
+	keys, values, err := client.Scan(r.Context(), startKey, blobEnd, SearchPageSize)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve blobs")
+		log.Printf("Failed to retrieve blobs: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+ArchiveFilename+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	count := 0
+	for {
+		for i, key := range keys {
+			if err := writeArchiveEntry(tw, strings.TrimPrefix(string(key), "blob:"), values[i]); err != nil {
+				log.Printf("Failed to write archive after %d blobs: %v", count, err)
+				return
+			}
+			count++
+		}
+		if len(keys) < SearchPageSize {
+			break
+		}
+		startKey = nextScanKey(keys[len(keys)-1])
+		keys, values, err = client.Scan(r.Context(), startKey, blobEnd, SearchPageSize)
+		if err != nil {
+			log.Printf("Failed to retrieve blobs after %d were archived: %v", count, err)
+			return
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		log.Printf("Failed to finish archive: %v", err)
+		return
+	}
+	if err := gz.Close(); err != nil {
+		log.Printf("Failed to finish archive: %v", err)
+		return
+	}
+	log.Printf("Archived %d blobs", count)
+}
+
+// writeArchiveEntry adds value to tw as a file named id. Time-based ids set the file's modification time
+// to the blob's creation time; other ids get the current time.
+func writeArchiveEntry(tw *tar.Writer, id string, value []byte) error {
+	modTime, ok := blobCreated(id)
+	if !ok {
+		modTime = time.Now()
+	}
+	header := &tar.Header{
+		Name:     id,
+		Mode:     0644,
+		Size:     int64(len(value)),
+		ModTime:  modTime,
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(value)
+	return err
+}
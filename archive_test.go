@@ -0,0 +1,70 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// The archive holds one file per blob, named by id, across several scan pages
+func TestHandleGETArchive(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	expected := map[string]string{}
+	for i := 0; i < SearchPageSize+5; i++ {
+		id := fmt.Sprintf("17000000000000%05d", i)
+		expected[id] = fmt.Sprintf("blob %d", i)
+		store["blob:"+id] = expected[id]
+	}
+	store["meta:1700000000000000000"] = `{"size":6}`
+
+	req := httptest.NewRequest(http.MethodGet, "/blobs?action=archive", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	withCompression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleGETArchive(w, r, mockClient)
+	})).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/gzip", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="blobs.tar.gz"`, w.Header().Get("Content-Disposition"))
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+
+	gz, err := gzip.NewReader(w.Body)
+	assert.NoError(t, err)
+	tr := tar.NewReader(gz)
+	extracted := map[string]string{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		content, err := io.ReadAll(tr)
+		assert.NoError(t, err)
+		extracted[header.Name] = string(content)
+	}
+	assert.Equal(t, expected, extracted)
+}
+
+// A failing first scan is reported as a JSON error rather than an empty archive
+func TestHandleGETArchiveScanError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil, assert.AnError)
+
+	w := httptest.NewRecorder()
+	handleGETArchive(w, httptest.NewRequest(http.MethodGet, "/blobs?action=archive", nil), mockClient)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"error":"Failed to retrieve blobs"}`, w.Body.String())
+}
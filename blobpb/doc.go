@@ -0,0 +1,5 @@
+// Package blobpb holds the gRPC service definition for the blob API and the code generated from it.
+// Regenerate after editing blobs.proto with protoc-gen-go v1.30.0 and protoc-gen-go-grpc v1.3.0 on the PATH.
+package blobpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative blobs.proto
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"log"
+	"sync"
+)
+
+// Each expected key gets bloomBitsPerKey bits and is set in bloomHashes of them, for about 1% false positives
+// while the filter holds no more than DEDUP_BLOOM_SIZE keys.
+const (
+	bloomBitsPerKey = 10
+	bloomHashes     = 7
+)
+
+// dedupBloom holds the content keys stored in TiKV, so POST can skip the duplicate lookup for blobs it has never seen.
+// It is nil unless DEDUP_BLOOM_SIZE is set with KEY_SCHEME=content.
+var dedupBloom *bloomFilter
+
+// bloomFilter is a fixed-size Bloom filter over keys. mayContain never misses a key that was added,
+// but may report keys that were not. A nil filter reports every key as possibly present.
+type bloomFilter struct {
+	mu   sync.Mutex
+	bits []uint64
+}
+
+// newBloomFilter returns an empty filter sized for n keys.
+func newBloomFilter(n int) *bloomFilter {
+	words := (n*bloomBitsPerKey + 63) / 64
+	if words < 1 {
+		words = 1
+	}
+	return &bloomFilter{bits: make([]uint64, words)}
+}
+
+// positions returns the bits key maps to, derived from the two halves of its 128-bit FNV hash.
+func (f *bloomFilter) positions(key []byte) [bloomHashes]uint64 {
+	h := fnv.New128a()
+	h.Write(key)
+	sum := h.Sum(nil)
+	h1, h2 := binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:])
+	size := uint64(len(f.bits)) * 64
+	var pos [bloomHashes]uint64
+	for i := range pos {
+		pos[i] = (h1 + uint64(i)*h2) % size
+	}
+	return pos
+}
+
+// add records key in the filter.
+func (f *bloomFilter) add(key []byte) {
+	if f == nil {
+		return
+	}
+	pos := f.positions(key)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, p := range pos {
+		f.bits[p/64] |= 1 << (p % 64)
+	}
+}
+
+// mayContain reports whether key may have been added. false means it definitely was not.
+func (f *bloomFilter) mayContain(key []byte) bool {
+	if f == nil {
+		return true
+	}
+	pos := f.positions(key)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, p := range pos {
+		if f.bits[p/64]&(1<<(p%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// setupDedupBloom builds dedupBloom from the keys stored in the "blob:" range, when DEDUP_BLOOM_SIZE is set.
+// If the scan fails the filter is left off, and every POST does the duplicate lookup as before.
+func setupDedupBloom(clientPool chan RawKVClientInterface) {
+	if dedupBloomSize <= 0 {
+		return
+	}
+	if keyScheme != KeySchemeContent {
+		log.Println("DEDUP_BLOOM_SIZE is ignored without KEY_SCHEME=content, as only content keys are looked up")
+		return
+	}
+
+	client := <-clientPool
+	defer func() {
+		clientPool <- client
+	}()
+	filter, count, err := loadBloomFilter(client, dedupBloomSize)
+	if err != nil {
+		log.Printf("Failed to build the dedup bloom filter, checking every POST in TiKV: %v", err)
+		return
+	}
+	if count > dedupBloomSize {
+		log.Printf("%d blobs stored, more than DEDUP_BLOOM_SIZE=%d; the dedup bloom filter will skip fewer lookups", count, dedupBloomSize)
+	}
+	dedupBloom = filter
+	log.Printf("Dedup bloom filter built from %d blobs", count)
+}
+
+// loadBloomFilter returns a filter sized for n keys holding every key in the "blob:" range, scanned a page at a time,
+// along with how many keys it added.
+func loadBloomFilter(client RawKVClientInterface, n int) (*bloomFilter, int, error) {
+	filter := newBloomFilter(n)
+	count := 0
+	startKey := blobStart
+	for {
+		keys, _, err := client.Scan(ctx, startKey, blobEnd, SearchPageSize)
+		if err != nil {
+			return nil, count, err
+		}
+		for _, key := range keys {
+			filter.add(key)
+		}
+		count += len(keys)
+		if len(keys) < SearchPageSize {
+			return filter, count, nil
+		}
+		startKey = nextScanKey(keys[len(keys)-1])
+	}
+}
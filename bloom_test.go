@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBloomFilter(t *testing.T) {
+	filter := newBloomFilter(1000)
+	for i := 0; i < 1000; i++ {
+		filter.add([]byte(fmt.Sprintf("blob:%d", i)))
+	}
+	for i := 0; i < 1000; i++ {
+		assert.True(t, filter.mayContain([]byte(fmt.Sprintf("blob:%d", i))))
+	}
+
+	falsePositives := 0
+	for i := 1000; i < 11000; i++ {
+		if filter.mayContain([]byte(fmt.Sprintf("blob:%d", i))) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, falsePositives, 300)
+
+	var off *bloomFilter
+	off.add([]byte("blob:1"))
+	assert.True(t, off.mayContain([]byte("blob:2")))
+}
+
+// A blob the filter has never seen is stored without the duplicate Get, and its key is added
+func TestDedupBloomSkipsLookupForNewBlob(t *testing.T) {
+	defer func(old string) { keyScheme = old }(keyScheme)
+	defer func(old *bloomFilter) { dedupBloom = old }(dedupBloom)
+	keyScheme = KeySchemeContent
+	dedupBloom = newBloomFilter(100)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	key := contentKey("postMe")
+	mockClient.EXPECT().Put(gomock.Any(), key, []byte("postMe")).Return(nil)
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=postMe", nil), mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, dedupBloom.mayContain(key))
+}
+
+// A blob the filter may have seen is still looked up, and a duplicate is refused
+func TestDedupBloomLooksUpPossibleDuplicate(t *testing.T) {
+	defer func(old string) { keyScheme = old }(keyScheme)
+	defer func(old *bloomFilter) { dedupBloom = old }(dedupBloom)
+	keyScheme = KeySchemeContent
+	dedupBloom = newBloomFilter(100)
+	key := contentKey("postMe")
+	dedupBloom.add(key)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), key).Return([]byte("postMe"), nil)
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=postMe", nil), mockClient)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+// The filter is built from every stored blob key, across scan pages
+func TestLoadBloomFilter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	for i := 0; i < SearchPageSize+5; i++ {
+		store[fmt.Sprintf("blob:%04d", i)] = "value"
+	}
+
+	filter, count, err := loadBloomFilter(mockClient, 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, SearchPageSize+5, count)
+	for key := range store {
+		assert.True(t, filter.mayContain([]byte(key)), key)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strings"
+)
+
+// sumKey returns the key under which the sha256 of the blob stored at key is kept with STORE_CHECKSUMS.
+// Like metadata keys, checksum keys live outside the "blob:" range.
+func sumKey(key []byte) []byte {
+	return []byte("sum:" + strings.TrimPrefix(string(key), "blob:"))
+}
+
+// checksumOf returns the hex-encoded sha256 of value.
+func checksumOf(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])
+}
+
+// recordChecksum stores the checksum of value, just stored at newKey, when STORE_CHECKSUMS is on.
+// oldKey is where the blob was stored before, or nil for a new blob. Its checksum is deleted if the blob moved.
+func recordChecksum(ctx context.Context, client RawKVClientInterface, oldKey, newKey []byte, value []byte) error {
+	if !storeChecksums {
+		return nil
+	}
+	if err := putBlob(ctx, client, sumKey(newKey), []byte(checksumOf(value))); err != nil {
+		return err
+	}
+	if oldKey != nil && string(oldKey) != string(newKey) {
+		return client.Delete(ctx, sumKey(oldKey))
+	}
+	return nil
+}
+
+// blobChecksum returns the stored checksum of value, the blob stored at key. Blobs written before STORE_CHECKSUMS
+// was turned on have none, so theirs is computed and stored on first read. Failing to store it is only logged,
+// as the computed checksum is still correct.
+func blobChecksum(ctx context.Context, client RawKVClientInterface, key []byte, value []byte) (string, error) {
+	stored, err := client.Get(ctx, sumKey(key))
+	if err != nil {
+		return "", err
+	}
+	if stored != nil {
+		return string(stored), nil
+	}
+	sum := checksumOf(value)
+	if err := putBlob(ctx, client, sumKey(key), []byte(sum)); err != nil {
+		log.Printf("Failed to store blob checksum: %v", err)
+	}
+	return sum, nil
+}
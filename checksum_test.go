@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// helloWorldSum is the sha256 of "HelloWorld".
+const helloWorldSum = "872e4e50ce9990d8b041330c47c9ddd11bec6b503ae9386a99da8584e9bb12c4"
+
+// With STORE_CHECKSUMS a write stores the sha256 of the value, and a read returns it
+func TestStoreChecksumsWriteAndRead(t *testing.T) {
+	defer func(old bool) { storeChecksums = old }(storeChecksums)
+	storeChecksums = true
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=HelloWorld", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	key := blobKeyOf(t, store)
+	assert.Equal(t, helloWorldSum, store[string(sumKey([]byte(key)))])
+	assert.Equal(t, checksumOf([]byte(store[key])), store[string(sumKey([]byte(key)))])
+
+	id := key[len("blob:"):]
+	w = httptest.NewRecorder()
+	handleGETByID(w, httptest.NewRequest(http.MethodGet, "/blobs/"+id, nil), mockClient, id)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"blob":"HelloWorld","sha256":"`+helloWorldSum+`"}`, w.Body.String())
+}
+
+// An update replaces the checksum, and a delete removes it with the blob
+func TestStoreChecksumsUpdateAndDelete(t *testing.T) {
+	defer func(old bool) { storeChecksums = old }(storeChecksums)
+	storeChecksums = true
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "HelloWorld"
+	store["sum:1"] = helloWorldSum
+
+	w := httptest.NewRecorder()
+	handlePUT(w, httptest.NewRequest(http.MethodPut, "/HelloWorld?newBlob=HelloAgain", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "39b50fc6d4d89cc68a03ed7541d02baa3e987834ab12782c34ff1f4d0e93cacf", store["sum:1"])
+
+	w = httptest.NewRecorder()
+	handleDELETE(w, httptest.NewRequest(http.MethodDelete, "/?blob=HelloAgain", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, store)
+}
+
+// A blob written before STORE_CHECKSUMS gets its checksum computed and stored on first read
+func TestStoreChecksumsLegacyBlob(t *testing.T) {
+	defer func(old bool) { storeChecksums = old }(storeChecksums)
+	storeChecksums = true
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "HelloWorld"
+
+	w := httptest.NewRecorder()
+	handleGETByID(w, httptest.NewRequest(http.MethodGet, "/blobs/1?meta=true", nil), mockClient, "1")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"id":"1","blob":"HelloWorld","sha256":"`+helloWorldSum+`"}`, w.Body.String())
+	assert.Equal(t, helloWorldSum, store["sum:1"])
+}
+
+// Without STORE_CHECKSUMS nothing is stored or returned
+func TestStoreChecksumsOff(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=HelloWorld", nil), mockClient)
+	assert.Len(t, store, 1)
+
+	id := blobKeyOf(t, store)[len("blob:"):]
+	w = httptest.NewRecorder()
+	handleGETByID(w, httptest.NewRequest(http.MethodGet, "/blobs/"+id, nil), mockClient, id)
+	assert.Equal(t, `{"blob":"HelloWorld"}`, w.Body.String())
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+)
+
+// MaxClientIDLength is the longest blob id a client may choose with REQUIRE_CLIENT_ID.
+const MaxClientIDLength = 128
+
+// handlePOSTWithID creates a blob under the id in its path, POST /blobs/<id>?blob=<blob>. It is only routed with REQUIRE_CLIENT_ID.
+func handlePOSTWithID(w http.ResponseWriter, r *http.Request, client RawKVClientInterface, id string) {
+	blob, ok := blobParam(w, r, blobFieldName)
+	if !ok {
+		return
+	}
+	if blob == "" {
+		writeError(w, http.StatusBadRequest, "No blob provided")
+		log.Println("No blob provided")
+		return
+	}
+	if !checkContentHash(w, r, blob) {
+		return
+	}
+	insertBlobWithID(w, r, client, blob, id)
+}
+
+// insertBlobWithID stores blob under "blob:<id>" only if no blob is stored there yet, responding 409 if one is.
+// The check and the write are a single CompareAndSwap, so two clients choosing the same id cannot both succeed.
+// Values are not compared with other blobs, as the client's ids already say which blobs are the same.
+// The TiKV client used here does not pass a TTL with CompareAndSwap, so BLOB_TTL does not apply to these blobs.
+func insertBlobWithID(w http.ResponseWriter, r *http.Request, client RawKVClientInterface, blob string, id string) {
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "No blob id provided")
+		log.Println("No blob id provided")
+		return
+	}
+	if !validClientID(id) {
+		writeError(w, http.StatusBadRequest, "Invalid blob id")
+		log.Printf("Invalid blob id: %q", id)
+		return
+	}
+
+	key := idKey(id)
+	_, swapped, err := client.CompareAndSwap(r.Context(), key, nil, []byte(blob))
+	if err != nil {
+		writeSaveError(w, err, "Failed to save blob")
+		return
+	}
+	if !swapped {
+		writeBlobExists(w, id)
+		return
+	}
+	adjustBlobCount(r.Context(), client, 1)
+	if err := recordMeta(r.Context(), client, nil, key, []byte(blob)); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to save blob metadata")
+		log.Printf("Failed to save blob metadata: %v", err)
+		return
+	}
+	blobSizeBytes.Observe(float64(len(blob)))
+
+	writeSavedBlob(w, r, client, key, blob)
+}
+
+// validClientID reports whether id can be used as a blob id: printable ASCII of at most MaxClientIDLength bytes,
+// without "/", which would make it unreachable under /blobs/<id>.
+func validClientID(id string) bool {
+	if id == "" || len(id) > MaxClientIDLength || strings.Contains(id, "/") {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/tikv/client-go/v2/rawkv"
+)
+
+// With REQUIRE_CLIENT_ID a POST without an id is rejected before anything is written
+func TestRequireClientIDRejectsMissingID(t *testing.T) {
+	defer func(old bool) { requireClientID = old }(requireClientID)
+	requireClientID = true
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := NewMockRawKVClientInterface(ctrl)
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=hello", nil), mockClient)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error":"No blob id provided"}`, w.Body.String())
+}
+
+// A provided id is created with a create-only CompareAndSwap under "blob:<id>"
+func TestRequireClientIDCreatesProvidedID(t *testing.T) {
+	defer func(old bool) { requireClientID = old }(requireClientID)
+	requireClientID = true
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().CompareAndSwap(gomock.Any(), []byte("blob:greeting-1"), nil, []byte("hello")).Return(nil, true, nil)
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=hello&id=greeting-1", nil), mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"blob":"hello"}`, w.Body.String())
+}
+
+// An id already in use is answered with 409 and the blob's location
+func TestRequireClientIDRejectsCollision(t *testing.T) {
+	defer func(old bool) { requireClientID = old }(requireClientID)
+	requireClientID = true
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().CompareAndSwap(gomock.Any(), []byte("blob:greeting-1"), nil, []byte("hello")).Return([]byte("earlier"), false, nil)
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=hello&id=greeting-1", nil), mockClient)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "/blobs/greeting-1", w.Header().Get("Location"))
+	assert.JSONEq(t, `{"error":"Blob already exists","id":"greeting-1"}`, w.Body.String())
+}
+
+// The id can also be given in the path, POST /blobs/<id>
+func TestRequireClientIDFromPath(t *testing.T) {
+	defer func(old bool) { requireClientID = old }(requireClientID)
+	requireClientID = true
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().CompareAndSwap(gomock.Any(), []byte("blob:greeting-2"), nil, []byte("hello")).Return(nil, true, nil)
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- mockClient
+
+	w := httptest.NewRecorder()
+	handleBlobRequest(w, httptest.NewRequest(http.MethodPost, "/blobs/greeting-2?blob=hello", nil), clientPool)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"blob":"hello"}`, w.Body.String())
+}
+
+// Without REQUIRE_CLIENT_ID, POST /blobs/<id> is still not allowed
+func TestPOSTWithIDNeedsRequireClientID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- NewMockRawKVClientInterface(ctrl)
+
+	w := httptest.NewRecorder()
+	handleBlobRequest(w, httptest.NewRequest(http.MethodPost, "/blobs/greeting-2?blob=hello", nil), clientPool)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestValidClientID(t *testing.T) {
+	assert.True(t, validClientID("greeting-1"))
+	assert.True(t, validClientID("a:b.c_d"))
+	assert.False(t, validClientID(""))
+	assert.False(t, validClientID("a/b"))
+	assert.False(t, validClientID("has space"))
+	assert.False(t, validClientID("café"))
+	assert.False(t, validClientID(strings.Repeat("x", MaxClientIDLength+1)))
+}
+
+// With CASE_INSENSITIVE_IDS an id is created lowercased, and any casing of it reads the same blob
+func TestCaseInsensitiveIDs(t *testing.T) {
+	defer func(old bool) { requireClientID = old }(requireClientID)
+	defer func(old bool) { caseInsensitiveIDs = old }(caseInsensitiveIDs)
+	requireClientID = true
+	caseInsensitiveIDs = true
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	mockClient.EXPECT().CompareAndSwap(gomock.Any(), []byte("blob:abc"), nil, []byte("hello")).DoAndReturn(
+		func(ctx context.Context, key, previousValue, newValue []byte, options ...rawkv.RawOption) ([]byte, bool, error) {
+			store[string(key)] = string(newValue)
+			return nil, true, nil
+		})
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=hello&id=AbC", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	for _, id := range []string{"AbC", "abc", "ABC"} {
+		w = httptest.NewRecorder()
+		handleGETByID(w, httptest.NewRequest(http.MethodGet, "/blobs/"+id, nil), mockClient, id)
+		assert.Equal(t, http.StatusOK, w.Code, id)
+		assert.JSONEq(t, `{"blob":"hello"}`, w.Body.String(), id)
+	}
+}
+
+// By default ids are case-sensitive, so a differently cased id does not find the blob
+func TestCaseSensitiveIDsByDefault(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:AbC"] = "hello"
+
+	w := httptest.NewRecorder()
+	handleGETByID(w, httptest.NewRequest(http.MethodGet, "/blobs/AbC", nil), mockClient, "AbC")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"blob":"hello"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handleGETByID(w, httptest.NewRequest(http.MethodGet, "/blobs/abc", nil), mockClient, "abc")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Runtime settings. Each one keeps its default until loadConfig is called from main,
+// which lets tests flip them directly without touching the environment.
+var (
+	// normalizeWhitespace makes duplicate detection ignore leading, trailing and repeated whitespace.
+	// Only the comparison is normalized; blobs are always stored exactly as received.
+	normalizeWhitespace = false
+
+	// maxRetries is how many times a TiKV call failing with a transient error is retried before the error is surfaced.
+	maxRetries = 0
+
+	// maxReadRetries is how many more times a failed read is retried within a request, on top of maxRetries.
+	// Reads are always safe to repeat, so they can be given a budget of their own.
+	maxReadRetries = 0
+
+	// startupSelfCheck makes main verify a write/read/delete round-trip against TiKV before serving traffic.
+	startupSelfCheck = false
+
+	// compressionAlgorithms lists the response content codings offered to clients, in order of preference.
+	// An empty list disables response compression.
+	compressionAlgorithms = []string{"gzip", "deflate", "br"}
+
+	// compressionMinSize is the smallest response body, in bytes, that is compressed.
+	compressionMinSize = 1024
+
+	// writeContentTypes lists the media types accepted for POST, PUT and PATCH request bodies.
+	// An empty list disables the check.
+	writeContentTypes = []string{"application/json"}
+
+	// maxAllResults caps how many blobs a single /all response returns. Zero returns every blob.
+	maxAllResults = 0
+
+	// listETags makes /all send a weak ETag for each page and answer a matching If-None-Match with 304.
+	listETags = false
+
+	// secondaryPDAddrs are the PD addresses of a standby cluster, used when clients cannot be created against pdAddrs.
+	secondaryPDAddrs []string
+
+	// blobFieldName is the name of the blob field in responses and of the blob query parameter in requests.
+	blobFieldName = "blob"
+
+	// readTimeout, writeTimeout and scanTimeout bound each point read, write or delete, and scan made while serving a request.
+	// Scans cover many keys and usually need a longer timeout than point operations. Zero means no timeout.
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	scanTimeout  time.Duration
+
+	// keyScheme selects how keys for new blobs are built, either KeySchemeTime or KeySchemeContent.
+	keyScheme = KeySchemeTime
+
+	// maxHistoryVersions is how many previous values PUT keeps for each blob. Zero disables history.
+	maxHistoryVersions = 0
+
+	// serverReadHeaderTimeout, serverReadTimeout, serverWriteTimeout and serverIdleTimeout bound how long
+	// a client connection may take to send headers, send the whole request, receive the response, and sit idle
+	// between keep-alive requests. Zero means no timeout.
+	serverReadHeaderTimeout = 5 * time.Second
+	serverReadTimeout       = 30 * time.Second
+	serverWriteTimeout      = 30 * time.Second
+	serverIdleTimeout       = 120 * time.Second
+
+	// enableH2C makes the HTTP server also speak HTTP/2 over cleartext connections.
+	enableH2C = false
+
+	// maxConns caps the number of open HTTP connections. Zero means unlimited.
+	maxConns = 0
+
+	// blobSizeBuckets are the upper bounds, in bytes, of the blob size histogram buckets.
+	blobSizeBuckets = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576}
+
+	// logActions makes handleGET log the "GET action" line for every request. Error logs are unaffected.
+	logActions = true
+
+	// searchTimeout bounds a whole regex search, scans and matching included. Zero means no timeout.
+	searchTimeout = 5 * time.Second
+
+	// partialResults makes a search that times out return the matches found so far and a cursor, instead of 503.
+	partialResults = false
+
+	// grpcAddr is the address the gRPC BlobService listens on, such as ":9090". Empty disables gRPC.
+	grpcAddr = ""
+
+	// redisAddr is the address the Redis protocol front-end listens on, such as ":6379". Empty disables it.
+	redisAddr = ""
+
+	// drawSessionTTL is how long the keys recording a draw session's progress are kept.
+	drawSessionTTL = time.Hour
+
+	// maxQueryParamLength caps the URL-encoded length, in bytes, of blobs passed in the URL. Zero means no limit.
+	maxQueryParamLength = 8192
+
+	// blobTTL is how long blobs live after they are created, updated or touched. Zero means they never expire.
+	blobTTL time.Duration
+
+	// maxBlobAge makes the sweeper delete blobs created longer ago than this. Zero disables the sweeper.
+	maxBlobAge time.Duration
+
+	// sweepInterval is how often the sweeper runs.
+	sweepInterval = 10 * time.Minute
+
+	// sweepDryRun makes the sweeper log the blobs it would delete instead of deleting them.
+	sweepDryRun = false
+
+	// keyPartitions is how many shards new time-based keys are spread over to avoid write hotspots. 0 or 1 means no sharding.
+	keyPartitions = 0
+
+	// minPoolClients is how many TiKV clients must be created at startup for the service to start.
+	// The rest of the pool is filled in the background.
+	minPoolClients = ClientPoolSize
+
+	// splitMetadata keeps each blob's creation time, update time and size under "meta:<id>", next to its raw value.
+	splitMetadata = false
+
+	// includeSize adds the stored value's length in bytes, as "size", to responses that return blobs by id or as a list of objects.
+	includeSize = false
+
+	// storeChecksums keeps the sha256 of each blob under "sum:<id>" and returns it when the blob is read by id.
+	storeChecksums = false
+
+	// errorCodes adds the application-level "code" from appErrors to error responses.
+	errorCodes = false
+
+	// debugEndpoints enables /debug/cluster, which shows which TiKV cluster the API talks to.
+	debugEndpoints = false
+
+	// enableUI serves the HTML blob browser on a plain GET of /.
+	enableUI = false
+
+	// requireClientID makes clients choose the id of every new blob, which is created only if the id is free.
+	// It puts the TiKV clients in atomic mode, which the create-only check needs.
+	requireClientID = false
+
+	// caseInsensitiveIDs lowercases blob ids before building their keys, so ids differing only in case are the same blob.
+	caseInsensitiveIDs = false
+
+	// maxBatchSize caps how many ids a single batch request, such as getMany or a Redis DEL, may name.
+	maxBatchSize = 100
+
+	// dedupScanLimit is how many blobs POST compares against when looking for a duplicate with time-based keys.
+	// Zero compares against every blob.
+	dedupScanLimit = 0
+
+	// dedupBloomSize is how many blobs the dedup bloom filter is sized for. Zero leaves it off.
+	dedupBloomSize = 0
+
+	// countLimit is how many blobs count and the monitoring scan count before stopping, reporting "at least" that many.
+	// Zero counts every blob, however long that takes.
+	countLimit = 100000
+
+	// blobCounter keeps the blob count in a counter key updated on every create and delete, so count is a single read.
+	// It puts the TiKV clients in atomic mode, which the compare-and-swap updates of the counter need.
+	blobCounter = false
+
+	// monitoringErrorRepeat makes the monitoring goroutine log a repeated failure again after that many repeats.
+	// Zero logs it once, until it changes or monitoring recovers.
+	monitoringErrorRepeat = 0
+
+	// deleteSuccessStatus is the status of a successful DELETE, http.StatusOK with a message or http.StatusNoContent without a body.
+	deleteSuccessStatus = http.StatusOK
+
+	// poolRefillInterval is how often clients discarded from the pool are replaced. Zero disables the refiller.
+	// Nothing discards clients on its own yet, so it is off until something does.
+	poolRefillInterval time.Duration
+
+	// rootGetBehavior is what GET / does, RootGetRandom, RootGetList, RootGetCount or RootGetNoop.
+	rootGetBehavior = RootGetRandom
+
+	// monitorOutput is where the monitoring tick reports its stats, MonitorOutputLog, MonitorOutputMetric or MonitorOutputBoth.
+	monitorOutput = MonitorOutputBoth
+
+	// storageMode is where blobs are kept, StorageModeTiKV, StorageModeMemory or StorageModeAuto.
+	storageMode = StorageModeTiKV
+
+	// poolAcquireMode is what getClientFromPool does when the pool is empty, PoolAcquireWait or PoolAcquireFailFast.
+	poolAcquireMode = PoolAcquireWait
+
+	// poolAcquireTimeout is how long PoolAcquireWait waits for a client.
+	poolAcquireTimeout = 5 * time.Second
+)
+
+// loadConfig reads the runtime settings from environment variables.
+// Unset variables leave the defaults in place, and invalid values are logged and ignored.
+func loadConfig() {
+	pdAddrs = envList("PD_ADDRS", pdAddrs)
+	secondaryPDAddrs = envList("PD_SECONDARY_ADDRS", secondaryPDAddrs)
+	normalizeWhitespace = envBool("NORMALIZE_WHITESPACE", normalizeWhitespace)
+	maxRetries = envInt("MAX_RETRIES", maxRetries)
+	if maxRetries < 0 {
+		log.Printf("Invalid value for MAX_RETRIES: %d, using 0", maxRetries)
+		maxRetries = 0
+	}
+	maxReadRetries = envInt("MAX_READ_RETRIES", maxReadRetries)
+	if maxReadRetries < 0 {
+		log.Printf("Invalid value for MAX_READ_RETRIES: %d, using 0", maxReadRetries)
+		maxReadRetries = 0
+	}
+	startupSelfCheck = envBool("STARTUP_SELFCHECK", startupSelfCheck)
+
+	var algorithms []string
+	for _, algorithm := range envList("COMPRESSION_ALGORITHMS", compressionAlgorithms) {
+		algorithm = strings.ToLower(algorithm)
+		if _, ok := compressors[algorithm]; !ok {
+			log.Printf("Ignoring unsupported compression algorithm %q", algorithm)
+			continue
+		}
+		algorithms = append(algorithms, algorithm)
+	}
+	compressionAlgorithms = algorithms
+	compressionMinSize = envInt("COMPRESSION_MIN_SIZE", compressionMinSize)
+	writeContentTypes = envList("WRITE_CONTENT_TYPES", writeContentTypes)
+	listETags = envBool("LIST_ETAGS", listETags)
+	maxAllResults = envInt("MAX_ALL_RESULTS", maxAllResults)
+	if maxAllResults < 0 {
+		log.Printf("Invalid value for MAX_ALL_RESULTS: %d, using 0", maxAllResults)
+		maxAllResults = 0
+	}
+	if name := strings.TrimSpace(os.Getenv("BLOB_FIELD_NAME")); name != "" {
+		blobFieldName = name
+	}
+	readTimeout = envDuration("READ_TIMEOUT", readTimeout)
+	writeTimeout = envDuration("WRITE_TIMEOUT", writeTimeout)
+	scanTimeout = envDuration("SCAN_TIMEOUT", scanTimeout)
+	switch scheme := strings.ToLower(strings.TrimSpace(os.Getenv("KEY_SCHEME"))); scheme {
+	case "":
+	case KeySchemeTime, KeySchemeContent:
+		keyScheme = scheme
+	default:
+		log.Printf("Invalid value for KEY_SCHEME: %q, using %s", scheme, keyScheme)
+	}
+	maxHistoryVersions = envInt("MAX_HISTORY_VERSIONS", maxHistoryVersions)
+	if maxHistoryVersions < 0 {
+		log.Printf("Invalid value for MAX_HISTORY_VERSIONS: %d, using 0", maxHistoryVersions)
+		maxHistoryVersions = 0
+	}
+	serverReadHeaderTimeout = envDuration("SERVER_READ_HEADER_TIMEOUT", serverReadHeaderTimeout)
+	serverReadTimeout = envDuration("SERVER_READ_TIMEOUT", serverReadTimeout)
+	serverWriteTimeout = envDuration("SERVER_WRITE_TIMEOUT", serverWriteTimeout)
+	serverIdleTimeout = envDuration("SERVER_IDLE_TIMEOUT", serverIdleTimeout)
+	enableH2C = envBool("ENABLE_H2C", enableH2C)
+	maxConns = envInt("MAX_CONNS", maxConns)
+	if maxConns < 0 {
+		log.Printf("Invalid value for MAX_CONNS: %d, using 0", maxConns)
+		maxConns = 0
+	}
+	blobSizeBuckets = envBuckets("BLOB_SIZE_BUCKETS", blobSizeBuckets)
+	logActions = envBool("LOG_ACTIONS", logActions)
+	searchTimeout = envDuration("SEARCH_TIMEOUT", searchTimeout)
+	partialResults = envBool("PARTIAL_RESULTS", partialResults)
+	grpcAddr = strings.TrimSpace(os.Getenv("GRPC_ADDR"))
+	redisAddr = strings.TrimSpace(os.Getenv("REDIS_ADDR"))
+	drawSessionTTL = envDuration("DRAW_SESSION_TTL", drawSessionTTL)
+	maxQueryParamLength = envInt("MAX_QUERY_PARAM_LENGTH", maxQueryParamLength)
+	blobTTL = envDuration("BLOB_TTL", blobTTL)
+	maxBlobAge = envDuration("MAX_BLOB_AGE", maxBlobAge)
+	sweepInterval = envDuration("SWEEP_INTERVAL", sweepInterval)
+	if sweepInterval <= 0 {
+		log.Printf("Invalid value for SWEEP_INTERVAL: %v, using 10m", sweepInterval)
+		sweepInterval = 10 * time.Minute
+	}
+	sweepDryRun = envBool("SWEEP_DRY_RUN", sweepDryRun)
+	minPoolClients = envInt("MIN_POOL_CLIENTS", minPoolClients)
+	if minPoolClients < 1 || minPoolClients > ClientPoolSize {
+		log.Printf("Invalid value for MIN_POOL_CLIENTS: %d, using %d", minPoolClients, ClientPoolSize)
+		minPoolClients = ClientPoolSize
+	}
+	splitMetadata = envBool("SPLIT_METADATA", splitMetadata)
+	includeSize = envBool("INCLUDE_SIZE", includeSize)
+	errorCodes = envBool("ERROR_CODES", errorCodes)
+	storeChecksums = envBool("STORE_CHECKSUMS", storeChecksums)
+	enableUI = envBool("ENABLE_UI", enableUI)
+	debugEndpoints = envBool("DEBUG_ENDPOINTS", debugEndpoints)
+	requireClientID = envBool("REQUIRE_CLIENT_ID", requireClientID)
+	caseInsensitiveIDs = envBool("CASE_INSENSITIVE_IDS", caseInsensitiveIDs)
+	monitoringErrorRepeat = envInt("MONITORING_ERROR_REPEAT", monitoringErrorRepeat)
+	if monitoringErrorRepeat < 0 {
+		log.Printf("Invalid value for MONITORING_ERROR_REPEAT: %d, using 0", monitoringErrorRepeat)
+		monitoringErrorRepeat = 0
+	}
+	countLimit = envInt("COUNT_LIMIT", countLimit)
+	if countLimit < 0 {
+		log.Printf("Invalid value for COUNT_LIMIT: %d, using 0", countLimit)
+		countLimit = 0
+	}
+	blobCounter = envBool("BLOB_COUNTER", blobCounter)
+	maxBatchSize = envInt("MAX_BATCH_SIZE", maxBatchSize)
+	if maxBatchSize < 1 {
+		log.Printf("Invalid value for MAX_BATCH_SIZE: %d, using 100", maxBatchSize)
+		maxBatchSize = 100
+	}
+	dedupScanLimit = envInt("DEDUP_SCAN_LIMIT", dedupScanLimit)
+	if dedupScanLimit < 0 {
+		log.Printf("Invalid value for DEDUP_SCAN_LIMIT: %d, using 0", dedupScanLimit)
+		dedupScanLimit = 0
+	}
+	dedupBloomSize = envInt("DEDUP_BLOOM_SIZE", dedupBloomSize)
+	if dedupBloomSize < 0 {
+		log.Printf("Invalid value for DEDUP_BLOOM_SIZE: %d, using 0", dedupBloomSize)
+		dedupBloomSize = 0
+	}
+	switch status := envInt("DELETE_SUCCESS_STATUS", deleteSuccessStatus); status {
+	case http.StatusOK, http.StatusNoContent:
+		deleteSuccessStatus = status
+	default:
+		log.Printf("Invalid value for DELETE_SUCCESS_STATUS: %d, using %d", status, deleteSuccessStatus)
+	}
+	switch output := strings.ToLower(strings.TrimSpace(os.Getenv("MONITOR_OUTPUT"))); output {
+	case "":
+	case MonitorOutputLog, MonitorOutputMetric, MonitorOutputBoth:
+		monitorOutput = output
+	default:
+		log.Printf("Invalid value for MONITOR_OUTPUT: %q, using %s", output, monitorOutput)
+	}
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv("STORAGE_MODE"))); mode {
+	case "":
+	case StorageModeTiKV, StorageModeMemory, StorageModeAuto:
+		storageMode = mode
+	default:
+		log.Printf("Invalid value for STORAGE_MODE: %q, using %s", mode, storageMode)
+	}
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv("POOL_ACQUIRE_MODE"))); mode {
+	case "":
+	case PoolAcquireWait, PoolAcquireFailFast:
+		poolAcquireMode = mode
+	default:
+		log.Printf("Invalid value for POOL_ACQUIRE_MODE: %q, using %s", mode, poolAcquireMode)
+	}
+	poolAcquireTimeout = envDuration("POOL_ACQUIRE_TIMEOUT", poolAcquireTimeout)
+	poolRefillInterval = envDuration("POOL_REFILL_INTERVAL", poolRefillInterval)
+	switch behavior := strings.ToLower(strings.TrimSpace(os.Getenv("ROOT_GET_BEHAVIOR"))); behavior {
+	case "":
+	case RootGetRandom, RootGetList, RootGetCount, RootGetNoop:
+		rootGetBehavior = behavior
+	default:
+		log.Printf("Invalid value for ROOT_GET_BEHAVIOR: %q, using %s", behavior, rootGetBehavior)
+	}
+	keyPartitions = envInt("KEY_PARTITIONS", keyPartitions)
+	if keyPartitions < 0 || keyPartitions > MaxKeyPartitions {
+		log.Printf("Invalid value for KEY_PARTITIONS: %d, using 0", keyPartitions)
+		keyPartitions = 0
+	}
+	if maxQueryParamLength < 0 {
+		log.Printf("Invalid value for MAX_QUERY_PARAM_LENGTH: %d, using 0", maxQueryParamLength)
+		maxQueryParamLength = 0
+	}
+}
+
+// envBool returns the boolean value of the named environment variable, or def if it is unset or invalid.
+func envBool(name string, def bool) bool {
+	raw, ok := os.LookupEnv(name)
+	if !ok || strings.TrimSpace(raw) == "" {
+		return def
+	}
+	value, err := strconv.ParseBool(strings.TrimSpace(raw))
+	if err != nil {
+		log.Printf("Invalid value for %s: %q, using default %v", name, raw, def)
+		return def
+	}
+	return value
+}
+
+// envInt returns the integer value of the named environment variable, or def if it is unset or invalid.
+func envInt(name string, def int) int {
+	raw, ok := os.LookupEnv(name)
+	if !ok || strings.TrimSpace(raw) == "" {
+		return def
+	}
+	value, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil {
+		log.Printf("Invalid value for %s: %q, using default %v", name, raw, def)
+		return def
+	}
+	return value
+}
+
+// envList returns the comma-separated values of the named environment variable, or def if it is unset.
+// Set it to "none" to get an empty list.
+func envList(name string, def []string) []string {
+	raw, ok := os.LookupEnv(name)
+	if !ok || strings.TrimSpace(raw) == "" {
+		return def
+	}
+	if strings.EqualFold(strings.TrimSpace(raw), "none") {
+		return nil
+	}
+	var values []string
+	for _, value := range strings.Split(raw, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// envBuckets returns the comma-separated histogram bucket bounds of the named environment variable,
+// or def if it is unset, empty, or not a strictly increasing list of numbers.
+func envBuckets(name string, def []float64) []float64 {
+	var buckets []float64
+	for _, raw := range envList(name, nil) {
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil || (len(buckets) > 0 && value <= buckets[len(buckets)-1]) {
+			log.Printf("Invalid value for %s: %q, using default %v", name, os.Getenv(name), def)
+			return def
+		}
+		buckets = append(buckets, value)
+	}
+	if len(buckets) == 0 {
+		return def
+	}
+	return buckets
+}
+
+// envDuration returns the duration value of the named environment variable, such as "500ms" or "2s",
+// or def if it is unset, unparseable or negative.
+func envDuration(name string, def time.Duration) time.Duration {
+	raw, ok := os.LookupEnv(name)
+	if !ok || strings.TrimSpace(raw) == "" {
+		return def
+	}
+	value, err := time.ParseDuration(strings.TrimSpace(raw))
+	if err != nil || value < 0 {
+		log.Printf("Invalid value for %s: %q, using default %v", name, raw, def)
+		return def
+	}
+	return value
+}
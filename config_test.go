@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// envBool falls back to the default for unset and invalid values
+func TestEnvBool(t *testing.T) {
+	t.Setenv("TIKVAPI_TEST_BOOL", "")
+	assert.True(t, envBool("TIKVAPI_TEST_BOOL", true))
+
+	t.Setenv("TIKVAPI_TEST_BOOL", "true")
+	assert.True(t, envBool("TIKVAPI_TEST_BOOL", false))
+
+	t.Setenv("TIKVAPI_TEST_BOOL", "0")
+	assert.False(t, envBool("TIKVAPI_TEST_BOOL", true))
+
+	t.Setenv("TIKVAPI_TEST_BOOL", "maybe")
+	assert.True(t, envBool("TIKVAPI_TEST_BOOL", true))
+}
+
+// loadConfig picks up NORMALIZE_WHITESPACE
+func TestLoadConfigNormalizeWhitespace(t *testing.T) {
+	defer func() { normalizeWhitespace = false }()
+
+	t.Setenv("NORMALIZE_WHITESPACE", "true")
+	loadConfig()
+	assert.True(t, normalizeWhitespace)
+}
+
+// envList splits on commas and treats "none" as an empty list
+func TestEnvList(t *testing.T) {
+	def := []string{"gzip"}
+
+	t.Setenv("TIKVAPI_TEST_LIST", "")
+	assert.Equal(t, def, envList("TIKVAPI_TEST_LIST", def))
+
+	t.Setenv("TIKVAPI_TEST_LIST", " br, gzip ,,")
+	assert.Equal(t, []string{"br", "gzip"}, envList("TIKVAPI_TEST_LIST", def))
+
+	t.Setenv("TIKVAPI_TEST_LIST", "none")
+	assert.Empty(t, envList("TIKVAPI_TEST_LIST", def))
+}
+
+// loadConfig drops unsupported compression algorithms
+func TestLoadConfigCompressionAlgorithms(t *testing.T) {
+	defer func() { compressionAlgorithms = []string{"gzip", "deflate", "br"} }()
+
+	t.Setenv("COMPRESSION_ALGORITHMS", "br,zstd,GZIP")
+	loadConfig()
+	assert.Equal(t, []string{"br", "gzip"}, compressionAlgorithms)
+}
+
+// envDuration rejects unparseable and negative durations
+func TestEnvDuration(t *testing.T) {
+	t.Setenv("TIKVAPI_TEST_DURATION", "250ms")
+	assert.Equal(t, 250*time.Millisecond, envDuration("TIKVAPI_TEST_DURATION", time.Second))
+
+	t.Setenv("TIKVAPI_TEST_DURATION", "soon")
+	assert.Equal(t, time.Second, envDuration("TIKVAPI_TEST_DURATION", time.Second))
+
+	t.Setenv("TIKVAPI_TEST_DURATION", "-5s")
+	assert.Equal(t, time.Second, envDuration("TIKVAPI_TEST_DURATION", time.Second))
+}
+
+// envBuckets accepts increasing numbers and falls back to the default otherwise
+func TestEnvBuckets(t *testing.T) {
+	def := []float64{1, 2}
+
+	t.Setenv("TIKVAPI_TEST_BUCKETS", "100, 1000,1e4")
+	assert.Equal(t, []float64{100, 1000, 10000}, envBuckets("TIKVAPI_TEST_BUCKETS", def))
+
+	t.Setenv("TIKVAPI_TEST_BUCKETS", "100,50")
+	assert.Equal(t, def, envBuckets("TIKVAPI_TEST_BUCKETS", def))
+
+	t.Setenv("TIKVAPI_TEST_BUCKETS", "small")
+	assert.Equal(t, def, envBuckets("TIKVAPI_TEST_BUCKETS", def))
+}
+
+// loadConfig accepts the known POOL_ACQUIRE_MODE values and keeps the default otherwise
+func TestLoadConfigPoolAcquireMode(t *testing.T) {
+	defer func(old string) { poolAcquireMode = old }(poolAcquireMode)
+
+	t.Setenv("POOL_ACQUIRE_MODE", "FailFast")
+	loadConfig()
+	assert.Equal(t, PoolAcquireFailFast, poolAcquireMode)
+
+	poolAcquireMode = PoolAcquireWait
+	t.Setenv("POOL_ACQUIRE_MODE", "sometimes")
+	loadConfig()
+	assert.Equal(t, PoolAcquireWait, poolAcquireMode)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+)
+
+// blobCountKey holds the number of stored blobs, in decimal, when BLOB_COUNTER is set.
+// It lies outside the "blob:" and "meta:" ranges, so no scan sees it and no blob id can collide with it.
+var blobCountKey = []byte("counter:blobs")
+
+// blobCountMu keeps concurrent counts in this process from each rebuilding a missing counter with a full scan.
+var blobCountMu sync.Mutex
+
+// MaxCounterAttempts is how many times adjustBlobCount tries its compare-and-swap while other writers keep changing
+// the counter, before it gives up and drops the counter to be rebuilt.
+const MaxCounterAttempts = 10
+
+// adjustBlobCount adds delta to the stored blob count when BLOB_COUNTER is set. The counter is updated with a
+// CompareAndSwap against the value read, tried again on the value found whenever another writer, in this process
+// or another instance, changed it in between, so concurrent adjustments are never lost. A missing counter is left
+// missing, to be rebuilt by the next count. Failures are only logged, as the blob itself was already written or
+// deleted; a counter that cannot be read as a number, or cannot be swapped within MaxCounterAttempts, is deleted
+// so that it gets rebuilt.
+func adjustBlobCount(ctx context.Context, client RawKVClientInterface, delta int) {
+	if !blobCounter {
+		return
+	}
+	raw, err := client.Get(ctx, blobCountKey)
+	if err != nil {
+		log.Printf("Failed to read the blob counter: %v", err)
+		return
+	}
+	for attempt := 0; attempt < MaxCounterAttempts; attempt++ {
+		if raw == nil {
+			return
+		}
+		count, err := strconv.Atoi(string(raw))
+		if err != nil {
+			log.Printf("Invalid blob counter %q, dropping it to be rebuilt", raw)
+			dropBlobCount(ctx, client)
+			return
+		}
+		previous, swapped, err := client.CompareAndSwap(ctx, blobCountKey, raw, []byte(strconv.Itoa(count+delta)))
+		if err != nil {
+			log.Printf("Failed to update the blob counter: %v", err)
+			return
+		}
+		if swapped {
+			return
+		}
+		raw = previous
+	}
+	log.Printf("Blob counter still changing after %d attempts, dropping it to be rebuilt", MaxCounterAttempts)
+	dropBlobCount(ctx, client)
+}
+
+// dropBlobCount deletes the blob counter, so the next count rebuilds it.
+func dropBlobCount(ctx context.Context, client RawKVClientInterface) {
+	if err := client.Delete(ctx, blobCountKey); err != nil {
+		log.Printf("Failed to delete the blob counter: %v", err)
+	}
+}
+
+// storedBlobCount returns the count held in blobCountKey, a single read. If the key is missing or invalid,
+// the blobs are counted with a full scan, regardless of COUNT_LIMIT, and the result is stored for the next time,
+// unless another instance stored a counter meanwhile. A blob created or deleted during the scan may be missed,
+// as adjustBlobCount leaves a missing counter alone; deleting the key makes the next count rebuild it again.
+// It returns -1 if the client is nil or TiKV fails.
+func storedBlobCount(ctx context.Context, client RawKVClientInterface) int {
+	if client == nil {
+		log.Println("Client is nil")
+		return -1
+	}
+	blobCountMu.Lock()
+	defer blobCountMu.Unlock()
+
+	raw, err := client.Get(ctx, blobCountKey)
+	if err != nil {
+		log.Printf("Failed to read the blob counter: %v", err)
+		return -1
+	}
+	if raw != nil {
+		if count, err := strconv.Atoi(string(raw)); err == nil {
+			return count
+		}
+		log.Printf("Invalid blob counter %q, rebuilding it", raw)
+	}
+
+	count, err := rebuildBlobCount(ctx, client)
+	if err != nil {
+		log.Printf("Failed to count blobs: %v", err)
+		return -1
+	}
+	_, swapped, err := client.CompareAndSwap(ctx, blobCountKey, raw, []byte(strconv.Itoa(count)))
+	if err != nil {
+		log.Printf("Failed to store the blob counter: %v", err)
+	} else if swapped {
+		log.Printf("Blob counter rebuilt with %d blobs", count)
+	}
+	return count
+}
+
+// rebuildBlobCount counts every key in the "blob:" range, scanned a page at a time.
+func rebuildBlobCount(ctx context.Context, client RawKVClientInterface) (int, error) {
+	count := 0
+	startKey := blobStart
+	for {
+		keys, _, err := client.Scan(ctx, startKey, blobEnd, SearchPageSize)
+		if err != nil {
+			return count, err
+		}
+		count += len(keys)
+		if len(keys) < SearchPageSize {
+			return count, nil
+		}
+		startKey = nextScanKey(keys[len(keys)-1])
+	}
+}
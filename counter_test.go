@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/tikv/client-go/v2/rawkv"
+)
+
+// With the counter in place, count is a single read and never scans
+func TestHandleGETCountReadsCounter(t *testing.T) {
+	defer func(old bool) { blobCounter = old }(blobCounter)
+	blobCounter = true
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), blobCountKey).Return([]byte("12345"), nil)
+
+	w := httptest.NewRecorder()
+	handleGETCount(w, mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"count":12345}`, w.Body.String())
+}
+
+// A missing counter is rebuilt from every page of blobs, past COUNT_LIMIT, and stored for the next count
+func TestStoredBlobCountRebuildsMissingCounter(t *testing.T) {
+	defer func(old bool) { blobCounter = old }(blobCounter)
+	defer func(old int) { countLimit = old }(countLimit)
+	blobCounter = true
+	countLimit = 10
+	client := newMemoryStore()
+	for i := 0; i < SearchPageSize+5; i++ {
+		client.Put(ctx, []byte(fmt.Sprintf("blob:%04d", i)), []byte("value"))
+	}
+	client.Put(ctx, []byte("meta:0000"), []byte("{}"))
+
+	assert.Equal(t, SearchPageSize+5, storedBlobCount(ctx, client))
+	assert.Equal(t, fmt.Sprint(SearchPageSize+5), string(client.values[string(blobCountKey)]))
+}
+
+// A counter that is not a number is rebuilt rather than trusted
+func TestStoredBlobCountRebuildsInvalidCounter(t *testing.T) {
+	client := newMemoryStore()
+	client.Put(ctx, []byte("blob:1"), []byte("one"))
+	client.Put(ctx, blobCountKey, []byte("lots"))
+
+	assert.Equal(t, 1, storedBlobCount(ctx, client))
+	assert.Equal(t, "1", string(client.values[string(blobCountKey)]))
+}
+
+// POST and DELETE keep the counter in step, and a missing counter is left for the next count to rebuild
+func TestBlobCounterFollowsPOSTAndDELETE(t *testing.T) {
+	defer func(old bool) { blobCounter = old }(blobCounter)
+	blobCounter = true
+	client := newMemoryStore()
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=one", nil), client)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, client.values, string(blobCountKey))
+
+	assert.Equal(t, 1, storedBlobCount(ctx, client))
+	handlePOST(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/?blob=two", nil), client)
+	handlePOST(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/?blob=two", nil), client)
+	assert.Equal(t, "2", string(client.values[string(blobCountKey)]))
+
+	w = httptest.NewRecorder()
+	handleDELETE(w, httptest.NewRequest(http.MethodDelete, "/?blob=one", nil), client)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", string(client.values[string(blobCountKey)]))
+}
+
+// An adjustment that loses the compare-and-swap to another writer is applied again on the value that writer left
+func TestAdjustBlobCountRetriesChangedCounter(t *testing.T) {
+	defer func(old bool) { blobCounter = old }(blobCounter)
+	blobCounter = true
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	gomock.InOrder(
+		mockClient.EXPECT().Get(gomock.Any(), blobCountKey).Return([]byte("5"), nil),
+		mockClient.EXPECT().CompareAndSwap(gomock.Any(), blobCountKey, []byte("5"), []byte("6")).Return([]byte("7"), false, nil),
+		mockClient.EXPECT().CompareAndSwap(gomock.Any(), blobCountKey, []byte("7"), []byte("8")).Return([]byte("7"), true, nil),
+	)
+
+	adjustBlobCount(ctx, mockClient, 1)
+}
+
+// A counter that keeps changing under every attempt is dropped, to be rebuilt by the next count
+func TestAdjustBlobCountDropsContendedCounter(t *testing.T) {
+	defer func(old bool) { blobCounter = old }(blobCounter)
+	blobCounter = true
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), blobCountKey).Return([]byte("5"), nil)
+	mockClient.EXPECT().CompareAndSwap(gomock.Any(), blobCountKey, []byte("5"), []byte("4")).Return([]byte("5"), false, nil).Times(MaxCounterAttempts)
+	mockClient.EXPECT().Delete(gomock.Any(), blobCountKey).Return(nil)
+
+	adjustBlobCount(ctx, mockClient, -1)
+}
+
+// Without BLOB_COUNTER the counter key is never touched
+func TestAdjustBlobCountDisabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	adjustBlobCount(ctx, NewMockRawKVClientInterface(ctrl), 1)
+}
+
+// atomicOnlyKV is an in-memory store whose CompareAndSwap fails unless atomic mode was enabled, as rawkv.Client's does.
+type atomicOnlyKV struct {
+	*memoryKV
+	atomic bool
+}
+
+func (a *atomicOnlyKV) SetAtomicForCAS(b bool) *rawkv.Client {
+	a.atomic = b
+	return nil
+}
+
+func (a *atomicOnlyKV) CompareAndSwap(ctx context.Context, key, previousValue, newValue []byte, options ...rawkv.RawOption) ([]byte, bool, error) {
+	if !a.atomic {
+		return nil, false, errors.New("using CompareAndSwap without enable atomic mode")
+	}
+	return a.memoryKV.CompareAndSwap(ctx, key, previousValue, newValue, options...)
+}
+
+// BLOB_COUNTER alone puts clients in atomic mode, so the counter is stored and adjusted on a real TiKV client
+func TestBlobCounterEnablesAtomicCAS(t *testing.T) {
+	defer func(old bool) { blobCounter = old }(blobCounter)
+	defer func(old bool) { requireClientID = old }(requireClientID)
+	blobCounter = true
+	requireClientID = false
+	client := &atomicOnlyKV{memoryKV: newMemoryStore()}
+	client.Put(ctx, []byte("blob:1"), []byte("one"))
+
+	enableAtomicCAS(client)
+	assert.True(t, client.atomic)
+
+	assert.Equal(t, 1, storedBlobCount(ctx, client))
+	adjustBlobCount(ctx, client, 1)
+	assert.Equal(t, "2", string(client.values[string(blobCountKey)]))
+}
+
+// Without a feature using CompareAndSwap, clients stay in their default mode
+func TestEnableAtomicCASOffByDefault(t *testing.T) {
+	defer func(old bool) { blobCounter = old }(blobCounter)
+	defer func(old bool) { requireClientID = old }(requireClientID)
+	blobCounter = false
+	requireClientID = false
+	client := &atomicOnlyKV{memoryKV: newMemoryStore()}
+
+	enableAtomicCAS(client)
+	assert.False(t, client.atomic)
+}
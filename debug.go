@@ -0,0 +1,42 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync/atomic"
+)
+
+// TiKVAPIVersion is the TiKV API version the clients speak. rawkv.NewClient always uses API V1,
+// which has no keyspaces, so the keyspace reported by /debug/cluster is always empty.
+const TiKVAPIVersion = "V1"
+
+// clusterID is the id of the TiKV cluster the last client was created against, or 0 before the first one.
+var clusterID atomic.Uint64
+
+// handleGETDebugCluster reports which TiKV cluster the API talks to and how, for support. It lists the PD addresses,
+// the cluster id, the API version, the keyspace and the pool size. TLS is only reported as on or off: certificate
+// and key paths are never included. The endpoint answers 404 unless DEBUG_ENDPOINTS is set.
+func handleGETDebugCluster(w http.ResponseWriter, clientPool chan RawKVClientInterface) {
+	if !debugEndpoints {
+		writeError(w, http.StatusNotFound, "Not found")
+		log.Println("Debug endpoint requested but DEBUG_ENDPOINTS is not set")
+		return
+	}
+
+	resp := map[string]interface{}{
+		"pdAddrs":          pdAddrs,
+		"secondaryPDAddrs": secondaryPDAddrs,
+		"activePDAddrs":    activePDAddrs,
+		"apiVersion":       TiKVAPIVersion,
+		"keyspace":         "",
+		"tls":              security.ClusterSSLCA != "",
+		"pool": map[string]int{
+			"size":       cap(clientPool),
+			"minClients": minPoolClients,
+		},
+	}
+	if id := clusterID.Load(); id != 0 {
+		resp["clusterId"] = id
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
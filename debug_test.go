@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tikv/client-go/v2/config"
+)
+
+// /debug/cluster reports the configured cluster and pool, and leaves TLS file paths out
+func TestHandleGETDebugCluster(t *testing.T) {
+	defer func(old bool) { debugEndpoints = old }(debugEndpoints)
+	defer func(primary, secondary, active []string) {
+		pdAddrs, secondaryPDAddrs, activePDAddrs = primary, secondary, active
+	}(pdAddrs, secondaryPDAddrs, activePDAddrs)
+	defer func(old config.Security) { security = old }(security)
+	defer func(old uint64) { clusterID.Store(old) }(clusterID.Load())
+	debugEndpoints = true
+	pdAddrs = []string{"pd-1:2379", "pd-2:2379"}
+	secondaryPDAddrs = []string{"standby:2379"}
+	activePDAddrs = pdAddrs
+	security = config.NewSecurity("/etc/tikv/ca.pem", "/etc/tikv/client.pem", "/etc/tikv/client-key.pem", nil)
+	clusterID.Store(42)
+	handler := setupServer(make(chan RawKVClientInterface, 3))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/cluster", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"pdAddrs": ["pd-1:2379", "pd-2:2379"],
+		"secondaryPDAddrs": ["standby:2379"],
+		"activePDAddrs": ["pd-1:2379", "pd-2:2379"],
+		"clusterId": 42,
+		"apiVersion": "V1",
+		"keyspace": "",
+		"tls": true,
+		"pool": {"size": 3, "minClients": 10}
+	}`, w.Body.String())
+	assert.NotContains(t, w.Body.String(), "/etc/tikv")
+
+	var resp map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	for _, field := range []string{"security", "cluster-ssl-key", "cluster-ssl-cert", "cluster-ssl-ca"} {
+		assert.NotContains(t, resp, field)
+	}
+}
+
+// Without DEBUG_ENDPOINTS the endpoint does not exist
+func TestHandleGETDebugClusterDisabled(t *testing.T) {
+	handler := setupServer(make(chan RawKVClientInterface, 3))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/cluster", nil))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, `{"error":"Not found"}`, w.Body.String())
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"net/http"
+	"regexp"
+)
+
+// drawSessionPattern restricts session ids to characters that are safe inside a key prefix.
+var drawSessionPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// drawPrefix returns the key prefix under which the keys already drawn in session are recorded.
+func drawPrefix(session string) string {
+	return "draw:" + session + ":"
+}
+
+// handleGETDraw returns a random blob that has not been drawn yet in the session given by ?session=,
+// like dealing from a shuffled deck. Each drawn key is recorded under "draw:<session>:" with a TTL of drawSessionTTL,
+// so abandoned sessions expire on their own. Once every blob has been drawn it responds 404 and resets the session,
+// so the next draw starts a new round.
+func handleGETDraw(w http.ResponseWriter, r *http.Request, client RawKVClientInterface) {
+	session := r.URL.Query().Get("session")
+	if !drawSessionPattern.MatchString(session) {
+		writeError(w, http.StatusBadRequest, "Invalid session")
+		log.Printf("Invalid session: %q", session)
+		return
+	}
+	prefix := drawPrefix(session)
+
+	keys, err := scanKeys(r.Context(), client, blobStart, blobEnd)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve blobs")
+		log.Printf("Failed to retrieve blobs: %v", err)
+		return
+	}
+	drawStart, drawEnd := rangeFor([]byte(prefix))
+	drawnKeys, err := scanKeys(r.Context(), client, drawStart, drawEnd)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve draw session")
+		log.Printf("Failed to retrieve draw session: %v", err)
+		return
+	}
+	drawn := map[string]bool{}
+	for _, key := range drawnKeys {
+		drawn[string(key[len(prefix):])] = true
+	}
+
+	var candidates [][]byte
+	for _, key := range keys {
+		if !drawn[string(key)] {
+			candidates = append(candidates, key)
+		}
+	}
+
+	// Keys deleted since the scan are skipped, as for random blobs.
+	for len(candidates) > 0 {
+		i := rand.Intn(len(candidates))
+		key := candidates[i]
+		candidates = append(candidates[:i], candidates[i+1:]...)
+
+		value, err := client.Get(r.Context(), key)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to retrieve blob")
+			log.Printf("Failed to retrieve blob: %v", err)
+			return
+		}
+		if value == nil {
+			continue
+		}
+
+		ttl := uint64(drawSessionTTL.Seconds())
+		if err := client.PutWithTTL(r.Context(), []byte(prefix+string(key)), []byte{}, ttl); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to record draw")
+			log.Printf("Failed to record draw: %v", err)
+			return
+		}
+		resp := map[string]string{blobFieldName: string(value)}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	for _, key := range drawnKeys {
+		if err := client.Delete(r.Context(), key); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to reset draw session")
+			log.Printf("Failed to reset draw session: %v", err)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "No blobs left to draw")
+	log.Printf("Draw session %s exhausted", session)
+}
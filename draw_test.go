@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func draw(t *testing.T, client RawKVClientInterface, session string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handleGET(w, httptest.NewRequest(http.MethodGet, "/draw?session="+session, nil), client)
+	return w
+}
+
+// A session draws every blob exactly once, then is told it is exhausted and starts over
+func TestHandleGETDrawEachBlobOnce(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "one"
+	store["blob:2"] = "two"
+	store["blob:3"] = "three"
+
+	var drawn []string
+	for i := 0; i < 3; i++ {
+		w := draw(t, mockClient, "s1")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp map[string]string
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		drawn = append(drawn, resp["blob"])
+	}
+	sort.Strings(drawn)
+	assert.Equal(t, []string{"one", "three", "two"}, drawn)
+
+	w := draw(t, mockClient, "s1")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, `{"error":"No blobs left to draw"}`, w.Body.String())
+	assert.Len(t, store, 3)
+
+	// The next round starts over.
+	assert.Equal(t, http.StatusOK, draw(t, mockClient, "s1").Code)
+}
+
+// Sessions are independent of each other
+func TestHandleGETDrawSessionsAreIndependent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "one"
+
+	assert.Equal(t, `{"blob":"one"}`, draw(t, mockClient, "a").Body.String())
+	assert.Equal(t, `{"blob":"one"}`, draw(t, mockClient, "b").Body.String())
+	assert.Equal(t, http.StatusNotFound, draw(t, mockClient, "a").Code)
+}
+
+// Drawn keys are recorded with the session TTL
+func TestHandleGETDrawRecordsWithTTL(t *testing.T) {
+	defer func(old time.Duration) { drawSessionTTL = old }(drawSessionTTL)
+	drawSessionTTL = 90 * time.Second
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), SearchPageSize).Return([][]byte{[]byte("blob:1")}, nil, nil)
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("draw:s1:"), []byte("draw:s1;"), SearchPageSize).Return(nil, nil, nil)
+	mockClient.EXPECT().Get(gomock.Any(), []byte("blob:1")).Return([]byte("one"), nil)
+	mockClient.EXPECT().PutWithTTL(gomock.Any(), []byte("draw:s1:blob:1"), []byte{}, uint64(90)).Return(nil)
+
+	assert.Equal(t, http.StatusOK, draw(t, mockClient, "s1").Code)
+}
+
+// Missing and unsafe session ids respond 400
+func TestHandleGETDrawInvalidSession(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+
+	assert.Equal(t, http.StatusBadRequest, draw(t, mockClient, "").Code)
+	assert.Equal(t, `{"error":"Invalid session"}`, draw(t, mockClient, "a:b").Body.String())
+}
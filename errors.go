@@ -0,0 +1,80 @@
+package main
+
+import "strings"
+
+// appErrors are the application-level error codes returned as "code" in error responses when ERROR_CODES is set,
+// so clients can branch on a stable number instead of parsing the message. The codes are independent of the HTTP status:
+// 1xxx are problems with the request, 2xxx missing or conflicting blobs, 3xxx failed TiKV operations
+// and 4xxx the service itself. A code never changes meaning once published.
+var appErrors = []*CustomError{
+	{message: "No blob provided", code: 1001},
+	{message: "No old blob provided", code: 1002},
+	{message: "No blob id provided", code: 1003},
+	{message: "Malformed URL encoding in", code: 1004},
+	{message: "Blob too long for the URL, send it in the body of a POST /rpc call instead", code: 1005},
+	{message: "Invalid cursor", code: 1006},
+	{message: "Invalid sort", code: 1007},
+	{message: "Invalid n", code: 1008},
+	{message: "Invalid session", code: 1009},
+	{message: "No regex provided", code: 1010},
+	{message: "Regex too long", code: 1011},
+	{message: "Invalid regex", code: 1012},
+	{message: "Blob TTL is not configured", code: 1013},
+	{message: "Invalid request method", code: 1015},
+	{message: "Unsupported Content-Type", code: 1016},
+	{message: "Key migration needs KEY_SCHEME=content", code: 1017},
+	{message: "Invalid limit", code: 1018},
+	{message: "Invalid blob id", code: 1019},
+	{message: "Invalid onDuplicate", code: 1020},
+	{message: "Invalid sha256", code: 1021},
+	{message: "Blob does not match sha256", code: 1022},
+	{message: "Invalid request body", code: 1023},
+	{message: "Too many ids", code: 1024},
+	{message: "Blob too large for TiKV", code: 1025},
+	{message: "Invalid format", code: 1026},
+	{message: "No key provided", code: 1027},
+	{message: "Invalid key", code: 1028},
+
+	{message: "Blob not found", code: 2001},
+	{message: "No blobs found", code: 2002},
+	{message: "No blobs left to draw", code: 2003},
+	{message: "Not found", code: 2004},
+	{message: "Blob already exists", code: 2005},
+
+	{message: "Failed to retrieve blob", code: 3001},
+	{message: "Failed to retrieve blobs", code: 3002},
+	{message: "Failed to save blob", code: 3003},
+	{message: "Failed to update blob", code: 3004},
+	{message: "Failed to delete blob", code: 3005},
+	{message: "Failed to touch blob", code: 3006},
+	{message: "Failed to read back blob", code: 3007},
+	{message: "Failed to record blob history", code: 3008},
+	{message: "Failed to retrieve blob metadata", code: 3009},
+	{message: "Failed to save blob metadata", code: 3010},
+	{message: "Failed to delete blob metadata", code: 3011},
+	{message: "Failed to touch blob metadata", code: 3012},
+	{message: "Failed to retrieve draw session", code: 3013},
+	{message: "Failed to record draw", code: 3014},
+	{message: "Failed to reset draw session", code: 3015},
+	{message: "Failed to retrieve blob checksum", code: 3016},
+
+	{message: "Internal server error", code: 4001},
+	{message: "Search timed out", code: 4002},
+	{message: "No TiKV client available", code: 4003},
+}
+
+// errorCode returns the application-level code for an error message. Messages that carry details after
+// a known message, such as "Malformed URL encoding in blob", get the code of the known message.
+func errorCode(message string) (int, bool) {
+	for _, e := range appErrors {
+		if message == e.message {
+			return e.code, true
+		}
+	}
+	for _, e := range appErrors {
+		if strings.HasPrefix(message, e.message+" ") {
+			return e.code, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Known messages map to their codes, including ones with details appended
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		message string
+		code    int
+		ok      bool
+	}{
+		{"No blob provided", 1001, true},
+		{"Malformed URL encoding in blob", 1004, true},
+		{"Blob not found", 2001, true},
+		{"Failed to retrieve blob", 3001, true},
+		{"Failed to retrieve blobs", 3002, true},
+		{"Failed to retrieve blob metadata", 3009, true},
+		{"Something else", 0, false},
+	}
+	for _, tt := range tests {
+		code, ok := errorCode(tt.message)
+		assert.Equal(t, tt.ok, ok, tt.message)
+		assert.Equal(t, tt.code, code, tt.message)
+	}
+}
+
+// No two errors share a code
+func TestAppErrorCodesAreUnique(t *testing.T) {
+	seen := map[int]string{}
+	for _, e := range appErrors {
+		assert.NotContains(t, seen, e.code, "code %d used by %q and %q", e.code, seen[e.code], e.message)
+		seen[e.code] = e.message
+	}
+}
+
+// With ERROR_CODES the code is added to error responses, with the HTTP status unchanged
+func TestWriteErrorIncludesCode(t *testing.T) {
+	defer func(old bool) { errorCodes = old }(errorCodes)
+	errorCodes = true
+
+	w := httptest.NewRecorder()
+	writeError(w, http.StatusNotFound, "Blob not found")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, `{"code":2001,"error":"Blob not found"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/", nil), nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `{"code":1001,"error":"No blob provided"}`, w.Body.String())
+}
+
+// Without ERROR_CODES error responses are unchanged
+func TestWriteErrorWithoutCode(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeError(w, http.StatusNotFound, "Blob not found")
+
+	assert.Equal(t, `{"error":"Blob not found"}`, w.Body.String())
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// listETag returns a weak ETag for a list page from its keys and values, its sort order, its format and the cursor
+// to the next page. Any change to the blobs on the page changes it.
+func listETag(keys, values [][]byte, sortOrder, format, cursor string) string {
+	h := sha256.New()
+	for i, key := range keys {
+		h.Write(key)
+		h.Write([]byte{0})
+		h.Write(values[i])
+		h.Write([]byte{0})
+	}
+	h.Write([]byte(sortOrder))
+	h.Write([]byte{0})
+	h.Write([]byte(format))
+	h.Write([]byte{0})
+	h.Write([]byte(cursor))
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// etagMatches reports whether the If-None-Match header of r lists etag, or is "*".
+// Tags are compared weakly, so W/"x" and "x" match.
+func etagMatches(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// If-None-Match matches weakly, in a list, or with "*"
+func TestETagMatches(t *testing.T) {
+	etag := `W/"abc"`
+	for header, expected := range map[string]bool{
+		"":               false,
+		`W/"abc"`:        true,
+		`"abc"`:          true,
+		`"xyz", W/"abc"`: true,
+		`*`:              true,
+		`W/"xyz"`:        false,
+		`W/"abcd"`:       false,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/all", nil)
+		if header != "" {
+			r.Header.Set("If-None-Match", header)
+		}
+		assert.Equal(t, expected, etagMatches(r, etag), header)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// orderedBlobs is a JSON object of blobs by id that keeps its ids in the order they were requested,
+// where a map would come out sorted.
+type orderedBlobs struct {
+	ids   []string
+	blobs map[string]string
+}
+
+func (o orderedBlobs) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, id := range o.ids {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(id)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(o.blobs[id])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// handlePOSTGetMany reads the blobs whose ids are listed in the JSON body, {"ids": [...]}, with a single BatchGet.
+// It responds {"blobs": {"<id>": "<blob>", ...}, "missing": [...]}, both in the order the ids were given.
+// Repeated ids are looked up once, and at most maxBatchSize distinct ids are accepted.
+func handlePOSTGetMany(w http.ResponseWriter, r *http.Request, client RawKVClientInterface) {
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		log.Printf("Invalid request body: %v", err)
+		return
+	}
+
+	var ids []string
+	seen := map[string]bool{}
+	for _, id := range req.IDs {
+		if id == "" || strings.Contains(id, "/") {
+			writeError(w, http.StatusBadRequest, "Invalid blob id")
+			log.Printf("Invalid blob id: %q", id)
+			return
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		writeError(w, http.StatusBadRequest, "No blob id provided")
+		log.Println("No blob id provided")
+		return
+	}
+	if len(ids) > maxBatchSize {
+		writeError(w, http.StatusBadRequest, "Too many ids")
+		log.Printf("Too many ids: %d", len(ids))
+		return
+	}
+
+	keys := make([][]byte, len(ids))
+	for i, id := range ids {
+		keys[i] = idKey(id)
+	}
+	values, err := client.BatchGet(r.Context(), keys)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve blobs")
+		log.Printf("Failed to retrieve blobs: %v", err)
+		return
+	}
+
+	found := orderedBlobs{blobs: map[string]string{}}
+	missing := []string{}
+	for i, id := range ids {
+		if i >= len(values) || values[i] == nil {
+			missing = append(missing, id)
+			continue
+		}
+		found.ids = append(found.ids, id)
+		found.blobs[id] = string(values[i])
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"blobs": found, "missing": missing})
+}
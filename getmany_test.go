@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/tikv/client-go/v2/rawkv"
+)
+
+// Present blobs come back keyed by id and absent ones are listed as missing, both in request order
+func TestHandlePOSTGetManyMixed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().BatchGet(gomock.Any(), [][]byte{[]byte("blob:3"), []byte("blob:9"), []byte("blob:1"), []byte("blob:8")}).
+		Return([][]byte{[]byte("three"), nil, []byte("one"), nil}, nil)
+
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- mockClient
+
+	body := `{"ids":["3","9","1","3","8"]}`
+	w := httptest.NewRecorder()
+	handleBlobRequest(w, httptest.NewRequest(http.MethodPost, "/blobs?action=getMany", strings.NewReader(body)), clientPool)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"blobs":{"3":"three","1":"one"},"missing":["9","8"]}`, w.Body.String())
+}
+
+// When nothing is found the response still has an empty blobs object
+func TestHandlePOSTGetManyNoneFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().BatchGet(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, keys [][]byte, options ...rawkv.RawOption) ([][]byte, error) {
+			return make([][]byte, len(keys)), nil
+		})
+
+	w := httptest.NewRecorder()
+	handlePOSTGetMany(w, httptest.NewRequest(http.MethodPost, "/blobs?action=getMany", strings.NewReader(`{"ids":["1","2"]}`)), mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"blobs":{},"missing":["1","2"]}`, w.Body.String())
+}
+
+// Bad bodies and id lists are rejected without touching TiKV
+func TestHandlePOSTGetManyRejectsRequest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	tooMany := `{"ids":["0"`
+	for i := 1; i <= maxBatchSize; i++ {
+		tooMany += fmt.Sprintf(`,"%d"`, i)
+	}
+	tooMany += `]}`
+
+	for _, tc := range []struct {
+		body     string
+		expected string
+	}{
+		{`not json`, `{"error":"Invalid request body"}`},
+		{`{}`, `{"error":"No blob id provided"}`},
+		{`{"ids":[]}`, `{"error":"No blob id provided"}`},
+		{`{"ids":["1",""]}`, `{"error":"Invalid blob id"}`},
+		{`{"ids":["a/b"]}`, `{"error":"Invalid blob id"}`},
+		{tooMany, `{"error":"Too many ids"}`},
+	} {
+		w := httptest.NewRecorder()
+		handlePOSTGetMany(w, httptest.NewRequest(http.MethodPost, "/blobs?action=getMany", strings.NewReader(tc.body)), mockClient)
+		assert.Equal(t, http.StatusBadRequest, w.Code, tc.body)
+		assert.Equal(t, tc.expected, w.Body.String(), tc.body)
+	}
+}
+
+// A failed batch read responds 500
+func TestHandlePOSTGetManyTiKVError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().BatchGet(gomock.Any(), gomock.Any()).Return(nil, errors.New("tikv down"))
+
+	w := httptest.NewRecorder()
+	handlePOSTGetMany(w, httptest.NewRequest(http.MethodPost, "/blobs?action=getMany", strings.NewReader(`{"ids":["1"]}`)), mockClient)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, `{"error":"Failed to retrieve blobs"}`, w.Body.String())
+}
+
+// A request naming exactly MAX_BATCH_SIZE ids succeeds, and one more is rejected
+func TestHandlePOSTGetManyMaxBatchSize(t *testing.T) {
+	defer func(old int) { maxBatchSize = old }(maxBatchSize)
+	maxBatchSize = 3
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().BatchGet(gomock.Any(), gomock.Len(3)).Return([][]byte{[]byte("one"), []byte("two"), []byte("three")}, nil)
+
+	w := httptest.NewRecorder()
+	handlePOSTGetMany(w, httptest.NewRequest(http.MethodPost, "/blobs?action=getMany", strings.NewReader(`{"ids":["1","2","3","2"]}`)), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"blobs":{"1":"one","2":"two","3":"three"},"missing":[]}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handlePOSTGetMany(w, httptest.NewRequest(http.MethodPost, "/blobs?action=getMany", strings.NewReader(`{"ids":["1","2","3","4"]}`)), mockClient)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `{"error":"Too many ids"}`, w.Body.String())
+}
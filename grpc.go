@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"tikvapi/blobpb"
+)
+
+// blobServer implements the gRPC BlobService. Each RPC borrows a client from the pool and runs the same handler
+// as the matching HTTP endpoint, so both interfaces behave the same way.
+type blobServer struct {
+	blobpb.UnimplementedBlobServiceServer
+	clientPool chan RawKVClientInterface
+}
+
+// newGRPCServer returns a gRPC server with the BlobService registered against clientPool.
+func newGRPCServer(clientPool chan RawKVClientInterface) *grpc.Server {
+	server := grpc.NewServer()
+	blobpb.RegisterBlobServiceServer(server, &blobServer{clientPool: clientPool})
+	return server
+}
+
+// serveGRPC listens on addr and serves the BlobService until the listener fails.
+func serveGRPC(addr string, clientPool chan RawKVClientInterface) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("Serving gRPC on %s", addr)
+	return newGRPCServer(clientPool).Serve(lis)
+}
+
+func (s *blobServer) Create(ctx context.Context, req *blobpb.CreateRequest) (*blobpb.Blob, error) {
+	if req.GetValue() == "" {
+		return nil, status.Error(codes.InvalidArgument, "No blob provided")
+	}
+	body, err := s.call(ctx, http.MethodPost, nil, func(w http.ResponseWriter, r *http.Request, client RawKVClientInterface) {
+		createBlob(w, r, client, req.GetValue(), "")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &blobpb.Blob{Value: body[blobFieldName].(string)}, nil
+}
+
+func (s *blobServer) Get(ctx context.Context, req *blobpb.GetRequest) (*blobpb.Blob, error) {
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "No blob id provided")
+	}
+	body, err := s.call(ctx, http.MethodGet, nil, func(w http.ResponseWriter, r *http.Request, client RawKVClientInterface) {
+		handleGETByID(w, r, client, req.GetId())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &blobpb.Blob{Value: body[blobFieldName].(string)}, nil
+}
+
+func (s *blobServer) Delete(ctx context.Context, req *blobpb.DeleteRequest) (*blobpb.DeleteResponse, error) {
+	_, err := s.call(ctx, http.MethodDelete, url.Values{blobFieldName: {req.GetValue()}}, handleDELETE)
+	if err != nil {
+		return nil, err
+	}
+	return &blobpb.DeleteResponse{}, nil
+}
+
+func (s *blobServer) Update(ctx context.Context, req *blobpb.UpdateRequest) (*blobpb.Blob, error) {
+	if req.GetOldValue() == "" || req.GetNewValue() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Old and new blob are required")
+	}
+	body, err := s.call(ctx, http.MethodPut, nil, func(w http.ResponseWriter, r *http.Request, client RawKVClientInterface) {
+		r.URL.Path = "/" + req.GetOldValue()
+		r.URL.RawQuery = url.Values{"newBlob": {req.GetNewValue()}}.Encode()
+		handlePUT(w, r, client)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &blobpb.Blob{Value: body[blobFieldName].(string)}, nil
+}
+
+func (s *blobServer) List(ctx context.Context, req *blobpb.ListRequest) (*blobpb.ListResponse, error) {
+	query := url.Values{}
+	if req.GetCursor() != "" {
+		query.Set("cursor", req.GetCursor())
+	}
+	body, err := s.call(ctx, http.MethodGet, query, handleGETAll)
+	if status.Code(err) == codes.NotFound {
+		// An empty store is an empty list over gRPC rather than an error.
+		return &blobpb.ListResponse{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp := &blobpb.ListResponse{}
+	for _, value := range body["blobs"].([]interface{}) {
+		resp.Values = append(resp.Values, value.(string))
+	}
+	if cursor, ok := body["cursor"].(string); ok {
+		resp.Cursor = cursor
+	}
+	return resp, nil
+}
+
+func (s *blobServer) Count(ctx context.Context, req *blobpb.CountRequest) (*blobpb.CountResponse, error) {
+	body, err := s.call(ctx, http.MethodGet, nil, func(w http.ResponseWriter, r *http.Request, client RawKVClientInterface) {
+		handleGETCount(w, client)
+	})
+	if err != nil {
+		return nil, err
+	}
+	count := int64(body["count"].(float64))
+	if count < 0 {
+		return nil, status.Error(codes.Internal, "Failed to count blobs")
+	}
+	return &blobpb.CountResponse{Count: count}, nil
+}
+
+// call runs handler with a pooled client on a request carrying ctx and query, and decodes its JSON response.
+// Error responses are turned into gRPC status errors with the handler's error message.
+func (s *blobServer) call(ctx context.Context, method string, query url.Values,
+	handler func(w http.ResponseWriter, r *http.Request, client RawKVClientInterface)) (map[string]interface{}, error) {
+	r, err := http.NewRequestWithContext(ctx, method, "/?"+query.Encode(), nil)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	capture := newCaptureWriter()
+	withPooledClient(capture, r, s.clientPool, handler)
+
+	if capture.status == http.StatusNoContent {
+		return map[string]interface{}{}, nil
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(capture.body.Bytes(), &body); err != nil {
+		return nil, status.Error(codes.Internal, "Failed to decode response")
+	}
+	if capture.status < http.StatusBadRequest {
+		return body, nil
+	}
+	message, _ := body["error"].(string)
+	return nil, status.Error(grpcCode(capture.status), message)
+}
+
+// grpcCode maps an HTTP status from the blob handlers to the matching gRPC code.
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"tikvapi/blobpb"
+)
+
+// newTestBlobClient serves the BlobService over an in-process connection backed by client.
+func newTestBlobClient(t *testing.T, client RawKVClientInterface) blobpb.BlobServiceClient {
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- client
+
+	lis := bufconn.Listen(1 << 20)
+	server := newGRPCServer(clientPool)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return blobpb.NewBlobServiceClient(conn)
+}
+
+// Every RPC runs against the store the same way as its HTTP endpoint
+func TestGRPCBlobService(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	client := newTestBlobClient(t, mockClient)
+	ctx := context.Background()
+
+	blob, err := client.Create(ctx, &blobpb.CreateRequest{Value: "one"})
+	assert.NoError(t, err)
+	assert.Equal(t, "one", blob.GetValue())
+
+	count, err := client.Count(ctx, &blobpb.CountRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count.GetCount())
+
+	var id string
+	for key := range store {
+		id = key[len("blob:"):]
+	}
+	blob, err = client.Get(ctx, &blobpb.GetRequest{Id: id})
+	assert.NoError(t, err)
+	assert.Equal(t, "one", blob.GetValue())
+
+	blob, err = client.Update(ctx, &blobpb.UpdateRequest{OldValue: "one", NewValue: "two"})
+	assert.NoError(t, err)
+	assert.Equal(t, "two", blob.GetValue())
+
+	list, err := client.List(ctx, &blobpb.ListRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"two"}, list.GetValues())
+
+	_, err = client.Delete(ctx, &blobpb.DeleteRequest{Value: "two"})
+	assert.NoError(t, err)
+	assert.Empty(t, store)
+
+	list, err = client.List(ctx, &blobpb.ListRequest{})
+	assert.NoError(t, err)
+	assert.Empty(t, list.GetValues())
+}
+
+// Handler errors come back as the matching gRPC status codes
+func TestGRPCBlobServiceErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "one"
+	client := newTestBlobClient(t, mockClient)
+	ctx := context.Background()
+
+	_, err := client.Get(ctx, &blobpb.GetRequest{Id: "404"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, "Blob not found", status.Convert(err).Message())
+
+	_, err = client.Create(ctx, &blobpb.CreateRequest{Value: "one"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	_, err = client.Create(ctx, &blobpb.CreateRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Delete(ctx, &blobpb.DeleteRequest{Value: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.Update(ctx, &blobpb.UpdateRequest{OldValue: "missing", NewValue: "two"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
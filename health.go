@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Component states reported by /healthz and /readyz, from best to worst.
+const (
+	HealthOK = "ok"
+	// HealthDegraded means the component works but cannot take more work right now, such as an exhausted pool.
+	HealthDegraded = "degraded"
+	// HealthUnknown means the component could not be checked, such as TiKV when no client was free to check it with.
+	HealthUnknown = "unknown"
+	HealthDown    = "down"
+)
+
+// healthRank orders the component states so the worst one decides the overall status.
+var healthRank = map[string]int{HealthOK: 0, HealthDegraded: 1, HealthUnknown: 2, HealthDown: 3}
+
+// HealthProbeTimeout bounds the TiKV read made by a health check.
+const HealthProbeTimeout = 2 * time.Second
+
+// healthProbeKey is read to check that TiKV answers. It lies outside the "blob:" range and is never written.
+var healthProbeKey = []byte("health:probe")
+
+// handleHealth reports the status of the client pool and of TiKV, and an overall status that is the worst of the two.
+// The pool is degraded when every client is in use and down when it has none at all. TiKV is checked with a single
+// read using a free client, and is unknown when there is none. The response is 200 only when everything is ok, and 503 otherwise.
+func handleHealth(w http.ResponseWriter, r *http.Request, clientPool chan RawKVClientInterface) {
+	available := len(clientPool)
+	pool := HealthOK
+	switch {
+	case cap(clientPool) == 0:
+		pool = HealthDown
+	case available == 0:
+		pool = HealthDegraded
+	}
+
+	tikv := HealthUnknown
+	select {
+	case client := <-clientPool:
+		tikv = probeTiKV(r.Context(), client)
+		clientPool <- client
+	default:
+	}
+
+	status := pool
+	if healthRank[tikv] > healthRank[status] {
+		status = tikv
+	}
+	code := http.StatusOK
+	if status != HealthOK {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]interface{}{
+		"status":    status,
+		"pool":      pool,
+		"tikv":      tikv,
+		"available": available,
+		"size":      cap(clientPool),
+	})
+}
+
+// probeTiKV reads healthProbeKey with client and reports TiKV as ok if the read succeeds in time, or down if not.
+func probeTiKV(ctx context.Context, client RawKVClientInterface) string {
+	ctx, cancel := context.WithTimeout(ctx, HealthProbeTimeout)
+	defer cancel()
+	if _, err := client.Get(ctx, healthProbeKey); err != nil {
+		return HealthDown
+	}
+	return HealthOK
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleHealth(t *testing.T) {
+	tests := []struct {
+		name     string
+		poolSize int
+		clients  int
+		probeErr error
+		status   int
+		body     string
+	}{
+		{"healthy", 2, 2, nil, http.StatusOK,
+			`{"status":"ok","pool":"ok","tikv":"ok","available":2,"size":2}`},
+		{"pool exhausted", 2, 0, nil, http.StatusServiceUnavailable,
+			`{"status":"unknown","pool":"degraded","tikv":"unknown","available":0,"size":2}`},
+		{"tikv unreachable", 2, 2, assert.AnError, http.StatusServiceUnavailable,
+			`{"status":"down","pool":"ok","tikv":"down","available":2,"size":2}`},
+		{"no pool", 0, 0, nil, http.StatusServiceUnavailable,
+			`{"status":"down","pool":"down","tikv":"unknown","available":0,"size":0}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockClient := NewMockRawKVClientInterface(ctrl)
+			if test.clients > 0 {
+				mockClient.EXPECT().Get(gomock.Any(), healthProbeKey).Return(nil, test.probeErr).Times(2)
+			}
+			clientPool := make(chan RawKVClientInterface, test.poolSize)
+			for i := 0; i < test.clients; i++ {
+				clientPool <- mockClient
+			}
+
+			for _, path := range []string{"/healthz", "/readyz"} {
+				w := httptest.NewRecorder()
+				setupServer(clientPool).ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+				assert.Equal(t, test.status, w.Code, path)
+				assert.JSONEq(t, test.body, w.Body.String(), path)
+			}
+			assert.Len(t, clientPool, test.clients)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// HistoryPruneBatch is how many history entries beyond the cap are pruned in a single write.
+// It only matters after MAX_HISTORY_VERSIONS has been lowered; otherwise each write leaves at most one extra entry.
+const HistoryPruneBatch = 100
+
+// historyPrefix returns the key prefix under which the previous values of the blob stored at key are kept.
+// History keys live outside the "blob:" range, so they are never listed, counted or picked as random blobs.
+func historyPrefix(key []byte) string {
+	return "history:" + strings.TrimPrefix(string(key), "blob:") + ":"
+}
+
+// recordHistory saves value as the newest history entry of the blob stored at key,
+// then deletes the oldest entries so that at most maxHistoryVersions remain.
+func recordHistory(ctx context.Context, client RawKVClientInterface, key []byte, value []byte) error {
+	if maxHistoryVersions <= 0 {
+		return nil
+	}
+
+	prefix := historyPrefix(key)
+	// Zero-padded so that entries sort by the time they were written.
+	entry := fmt.Sprintf("%s%020d", prefix, time.Now().UnixNano())
+	if err := client.Put(ctx, []byte(entry), value); err != nil {
+		return err
+	}
+
+	start, end := rangeFor([]byte(prefix))
+	keys, _, err := client.Scan(ctx, start, end, maxHistoryVersions+HistoryPruneBatch)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(keys)-maxHistoryVersions; i++ {
+		if err := client.Delete(ctx, keys[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
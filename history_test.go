@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/tikv/client-go/v2/rawkv"
+)
+
+// newMemoryClient returns a mock client backed by an in-memory map, for tests that make many calls.
+// TTLs are accepted but never expire.
+func newMemoryClient(ctrl *gomock.Controller) (*MockRawKVClientInterface, map[string]string) {
+	store := map[string]string{}
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, key []byte, options ...rawkv.RawOption) ([]byte, error) {
+			value, ok := store[string(key)]
+			if !ok {
+				return nil, nil
+			}
+			return []byte(value), nil
+		}).AnyTimes()
+	mockClient.EXPECT().Put(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, key []byte, value []byte, options ...rawkv.RawOption) error {
+			store[string(key)] = string(value)
+			return nil
+		}).AnyTimes()
+	mockClient.EXPECT().PutWithTTL(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, key []byte, value []byte, ttl uint64, options ...rawkv.RawOption) error {
+			store[string(key)] = string(value)
+			return nil
+		}).AnyTimes()
+	mockClient.EXPECT().Delete(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, key []byte, options ...rawkv.RawOption) error {
+			delete(store, string(key))
+			return nil
+		}).AnyTimes()
+	mockClient.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, startKey []byte, endKey []byte, limit int, options ...rawkv.RawOption) ([][]byte, [][]byte, error) {
+			var keys []string
+			for key := range store {
+				if key >= string(startKey) && key < string(endKey) {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			if len(keys) > limit {
+				keys = keys[:limit]
+			}
+			var rawKeys, values [][]byte
+			for _, key := range keys {
+				rawKeys = append(rawKeys, []byte(key))
+				values = append(values, []byte(store[key]))
+			}
+			return rawKeys, values, nil
+		}).AnyTimes()
+	mockClient.EXPECT().ReverseScan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, startKey []byte, endKey []byte, limit int, options ...rawkv.RawOption) ([][]byte, [][]byte, error) {
+			var keys []string
+			for key := range store {
+				if key >= string(endKey) && key < string(startKey) {
+					keys = append(keys, key)
+				}
+			}
+			sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+			if len(keys) > limit {
+				keys = keys[:limit]
+			}
+			var rawKeys, values [][]byte
+			for _, key := range keys {
+				rawKeys = append(rawKeys, []byte(key))
+				values = append(values, []byte(store[key]))
+			}
+			return rawKeys, values, nil
+		}).AnyTimes()
+	return mockClient, store
+}
+
+// historyEntries returns the stored history values of the blob with the given id, oldest first.
+func historyEntries(store map[string]string, id string) []string {
+	var keys []string
+	for key := range store {
+		if strings.HasPrefix(key, "history:"+id+":") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var values []string
+	for _, key := range keys {
+		values = append(values, store[key])
+	}
+	return values
+}
+
+// History never grows beyond MAX_HISTORY_VERSIONS and keeps the most recent values
+func TestHandlePUTHistoryIsCapped(t *testing.T) {
+	defer func(old int) { maxHistoryVersions = old }(maxHistoryVersions)
+	maxHistoryVersions = 3
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "v0"
+
+	for i := 1; i <= 10; i++ {
+		path := "/" + url.PathEscape(fmt.Sprintf("v%d", i-1)) + "?newBlob=" + fmt.Sprintf("v%d", i)
+		w := httptest.NewRecorder()
+		handlePUT(w, httptest.NewRequest(http.MethodPut, path, nil), mockClient)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.LessOrEqual(t, len(historyEntries(store, "1")), 3)
+	}
+
+	assert.Equal(t, "v10", store["blob:1"])
+	assert.Equal(t, []string{"v7", "v8", "v9"}, historyEntries(store, "1"))
+}
+
+// With MAX_HISTORY_VERSIONS at 0 no history is written
+func TestHandlePUTHistoryDisabled(t *testing.T) {
+	defer func(old int) { maxHistoryVersions = old }(maxHistoryVersions)
+	maxHistoryVersions = 0
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "old"
+
+	w := httptest.NewRecorder()
+	handlePUT(w, httptest.NewRequest(http.MethodPut, "/old?newBlob=new", nil), mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]string{"blob:1": "new"}, store)
+}
+
+// Lowering the cap prunes the excess entries on the next update
+func TestRecordHistoryPrunesAfterCapIsLowered(t *testing.T) {
+	defer func(old int) { maxHistoryVersions = old }(maxHistoryVersions)
+	maxHistoryVersions = 2
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	for i := 0; i < 5; i++ {
+		store[fmt.Sprintf("history:1:%020d", i)] = fmt.Sprintf("h%d", i)
+	}
+
+	assert.NoError(t, recordHistory(context.Background(), mockClient, []byte("blob:1"), []byte("latest")))
+	assert.Equal(t, []string{"h4", "latest"}, historyEntries(store, "1"))
+}
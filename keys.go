@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Key schemes for new blobs, selected with KEY_SCHEME.
+//
+// KeySchemeTime stores each blob under "blob:<UnixNano>", so keys sort by creation time.
+// Consecutive keys fall into the same TiKV region, which KEY_PARTITIONS spreads out at the cost of that ordering.
+// KeySchemeContent stores each blob under "blob:<sha256 of the blob>". Identical blobs map to the same key,
+// which makes duplicate detection and lookups by value a single Get, but keys no longer sort by creation time.
+const (
+	KeySchemeTime    = "time"
+	KeySchemeContent = "content"
+)
+
+// MaxKeyPartitions is the most shards KEY_PARTITIONS may spread time-based keys over.
+const MaxKeyPartitions = 1000
+
+// newBlobKey returns the key a new blob is stored under with the configured key scheme.
+// With keyPartitions set, time-based keys get a shard prefix, as in "blob:007:<UnixNano>".
+func newBlobKey(blob string) []byte {
+	if keyScheme == KeySchemeContent {
+		return contentKey(blob)
+	}
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+	if keyPartitions > 1 {
+		id = keyShard(id) + ":" + id
+	}
+	return []byte("blob:" + id)
+}
+
+// idKey returns the key of the blob with the given id. With CASE_INSENSITIVE_IDS the id is lowercased first,
+// so ids differing only in case address the same blob.
+func idKey(id string) []byte {
+	if caseInsensitiveIDs {
+		id = strings.ToLower(id)
+	}
+	return []byte("blob:" + id)
+}
+
+// keyShard returns the zero-padded shard prefix for id, derived from its hash so consecutive ids land on different shards.
+// Shard prefixes sort inside the "blob:" range, so scans of that range still cover every shard.
+func keyShard(id string) string {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return fmt.Sprintf("%03d", h.Sum32()%uint32(keyPartitions))
+}
+
+// contentKey returns the content-addressed key for blob. The hash is taken over the blob's dedup form,
+// so blobs that count as duplicates share a key.
+func contentKey(blob string) []byte {
+	sum := sha256.Sum256([]byte(dedupKey(blob)))
+	return []byte("blob:" + hex.EncodeToString(sum[:]))
+}
+
+// lookupContentKey returns the content-addressed key of blob if a blob is stored under it, or nil if not.
+func lookupContentKey(ctx context.Context, client RawKVClientInterface, blob string) ([]byte, error) {
+	key := contentKey(blob)
+	value, err := client.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, nil
+	}
+	return key, nil
+}
+
+// blobStart and blobEnd bound the "blob:" range that every blob is stored in.
+var blobStart, blobEnd = rangeFor([]byte("blob:"))
+
+// rangeFor returns the scan bounds covering exactly the keys that start with prefix.
+// start is the prefix itself and end is the first key after all of them, for use as an exclusive end key:
+// the prefix with trailing 0xFF bytes dropped and its last remaining byte incremented.
+// An empty prefix, or one made only of 0xFF bytes, has no such key, so end is nil, which TiKV reads as unbounded.
+func rangeFor(prefix []byte) (start, end []byte) {
+	start = append([]byte{}, prefix...)
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xff {
+			end = append([]byte{}, prefix[:i+1]...)
+			end[i]++
+			return start, end
+		}
+	}
+	return start, nil
+}
+
+// nextScanKey returns the smallest key after key, for continuing a scan after the last key of a page.
+func nextScanKey(key []byte) []byte {
+	next := make([]byte, 0, len(key)+1)
+	next = append(next, key...)
+	return append(next, 0)
+}
+
+// scanKeys returns every key in [startKey, endKey), scanning a page at a time.
+func scanKeys(ctx context.Context, client RawKVClientInterface, startKey, endKey []byte) ([][]byte, error) {
+	keys, _, err := scanRange(ctx, client, startKey, endKey)
+	return keys, err
+}
+
+// scanAllBlobs returns every key in the "blob:" range along with its value, scanning a page at a time,
+// so handlers see the whole store rather than the first page of it.
+func scanAllBlobs(ctx context.Context, client RawKVClientInterface) ([][]byte, [][]byte, error) {
+	return scanRange(ctx, client, blobStart, blobEnd)
+}
+
+// scanRange returns every key in [startKey, endKey) and its value, scanning a page at a time.
+// Each page starts just after the last key of the previous one, and a short page means the range is done.
+func scanRange(ctx context.Context, client RawKVClientInterface, startKey, endKey []byte) ([][]byte, [][]byte, error) {
+	var keys, values [][]byte
+	for {
+		pageKeys, pageValues, err := client.Scan(ctx, startKey, endKey, SearchPageSize)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, pageKeys...)
+		values = append(values, pageValues...)
+		if len(pageKeys) < SearchPageSize {
+			return keys, values, nil
+		}
+		startKey = nextScanKey(pageKeys[len(pageKeys)-1])
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRangeFor(t *testing.T) {
+	tests := []struct {
+		prefix []byte
+		end    []byte
+	}{
+		{[]byte("blob:"), []byte("blob;")},
+		{[]byte("history:1:"), []byte("history:1;")},
+		{[]byte("a"), []byte("b")},
+		{[]byte{'a', 0xff}, []byte("b")},
+		{[]byte{'a', 0xfe, 0xff, 0xff}, []byte{'a', 0xff}},
+		{[]byte{0xff}, nil},
+		{[]byte{0xff, 0xff}, nil},
+		{[]byte{}, nil},
+		{nil, nil},
+	}
+
+	for _, test := range tests {
+		start, end := rangeFor(test.prefix)
+		assert.Equal(t, len(test.prefix), len(start), "%q", test.prefix)
+		assert.Equal(t, string(test.prefix), string(start), "%q", test.prefix)
+		assert.Equal(t, test.end, end, "%q", test.prefix)
+	}
+}
+
+// rangeFor never writes into the caller's prefix
+func TestRangeForLeavesPrefixUnchanged(t *testing.T) {
+	prefix := []byte{'a', 'b', 0xff}
+	_, end := rangeFor(prefix)
+
+	end[len(end)-1] = 'z'
+	assert.Equal(t, []byte{'a', 'b', 0xff}, prefix)
+}
+
+// scanAllBlobs follows the pages past the first, keeping each value with its key and leaving other prefixes out
+func TestScanAllBlobs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	for i := 0; i < SearchPageSize*2+5; i++ {
+		store[fmt.Sprintf("blob:%04d", i)] = fmt.Sprintf("value %d", i)
+	}
+	store["meta:0000"] = "{}"
+
+	keys, values, err := scanAllBlobs(ctx, mockClient)
+	assert.NoError(t, err)
+	assert.Len(t, keys, SearchPageSize*2+5)
+	assert.Len(t, values, SearchPageSize*2+5)
+	for i, key := range keys {
+		assert.Equal(t, store[string(key)], string(values[i]))
+	}
+}
@@ -26,49 +26,245 @@
 //
 // POST /blobs
 //   - Add a new blob to the TiKV store.
-//   - Request body should be a JSON object with a "blob" field.
+//   - With BLOB_TTL set, the blob expires that long after it was last written or touched.
+//   - The blob is stored under "blob:<UnixNano>", or under "blob:<sha256 of the blob>" with KEY_SCHEME=content.
+//     With KEY_PARTITIONS set, time-based keys get a hash-derived shard prefix, "blob:<shard>:<UnixNano>", to spread writes
+//     across regions. Listing and random reads then scan every shard and no longer return blobs in creation order.
+//     Content-addressed keys make duplicate checks and lookups by value a single Get, but lose creation ordering.
+//   - If the blob is already stored, responds 409 with the existing blob's id in the body
+//     and its location (/blobs/<id>) in the Location header.
+//   - ?onDuplicate=overwrite writes the blob over the stored duplicate instead, keeping its id but refreshing its TTL
+//     and metadata. ?onDuplicate=ignore leaves it and responds 200 with {"id", "blob"}. Both set the Location header.
+//     ?onDuplicate=conflict is the default 409.
+//   - A blob TiKV refuses to store for its size responds 413 "Blob too large for TiKV", as do updates by PUT.
+//   - With DEDUP_BLOOM_SIZE and content keys, the duplicate lookup is skipped for keys an in-memory filter has never seen.
+//   - With time-based keys every blob is checked for a duplicate, or only the first DEDUP_SCAN_LIMIT when it is set.
+//     When the store holds that many or more, the response carries an X-Dedup-Warning header, as a duplicate beyond
+//     them is not detected.
+//   - ?sha256=<hex> is checked against the blob received, and a blob that does not match is rejected with 400
+//     before anything is written.
+//   - With REQUIRE_CLIENT_ID set, the client chooses the id, as ?id=<id> or with POST /blobs/<id>, and the blob is
+//     stored under "blob:<id>". A request without an id is rejected with 400, and an id already in use with 409.
+//     With CASE_INSENSITIVE_IDS set the id is lowercased first, here and wherever a blob is looked up by id.
+//   - Request body should be a JSON object with a "blob" field. Malformed JSON responds 400, as does a body
+//     without the field unless ?blob= is given, which is still accepted for requests without a body.
 //   - Example: {"blob": "To be or not to be, that is the question."}
+//   - Responds with the blob as sent, and its location (/blobs/<id>) in the Location header. With ?echo=stored
+//     it is read back from TiKV after writing, so the response shows exactly what was stored. The same applies to PUT.
 //
 // DELETE /blobs?blob=<query>
 //   - Delete a blob from the TiKV store.
 //   - Query parameter "blob" should be the exact blob to delete.
+//   - Blobs too long for the URL can be sent in a JSON body instead, {"blob": "<blob>"}. The query parameter wins
+//     when both are given.
+//   - Responds 200 with {"message": "Blob deleted successfully"}, or 204 with no body with DELETE_SUCCESS_STATUS=204.
 //   - Example: /blobs?blob=To%20be%20or%20not%20to%20be%2C%20that%20is%20the%20question.
 //
 // PUT /blobs?oldBlob=<oldBlob>&newBlob=<newBlob>
 //   - Update a blob in the TiKV store.
 //   - Query parameter "oldBlob" should be the exact blob to update.
 //   - Query parameter "newBlob" should be the new blob to replace the old blob.
+//   - With MAX_HISTORY_VERSIONS set, the replaced value is kept under "history:<id>:<UnixNano>",
+//     and only the most recent MAX_HISTORY_VERSIONS entries per blob are kept.
+//   - If another blob already holds newBlob, responds 409 with that blob's id, like POST. ?onDuplicate=overwrite
+//     updates anyway, leaving two blobs with the same value, and ?onDuplicate=merge updates and deletes the other blob.
+//     The check covers the same blobs as POST's: one lookup with content keys, a scan otherwise.
 //   - Example: /blobs?oldBlob=To%20be%20or%20not%20to%20be%2C%20that%20is%20the%20question.&newBlob=To%20be%20or%20not%20to%20be%2C%20that%20is%20the%20answer.
 //
 // GET /?action=count
 //   - Get the number of blobs in the TiKV store.
+//   - Responds {"count": <n>}. With COUNT_LIMIT set (100000 by default) counting stops at that many blobs,
+//     and the response adds "atLeast": true. COUNT_LIMIT=0 always counts every blob.
+//   - With BLOB_COUNTER set the count is read from a single counter key kept up to date by every create and delete,
+//     and rebuilt with a full scan when it is missing.
 //
 // GET /?action=<random>
 //   - Get a random blob from the TiKV store.
+//   - ROOT_GET_BEHAVIOR changes what GET / itself does: list lists the blobs like /all, count counts them,
+//     and noop responds 204. Any other unrecognised path, such as /random, still returns a random blob.
+//   - ?withId=true adds the blob's id, {"id": "<id>", "blob": "<blob>"}, so it can be fetched or deleted later.
 //
 // GET /?action=all
 //   - Get all blobs from the TiKV store.
+//   - With MAX_ALL_RESULTS set, at most that many blobs are returned. If more remain, the response includes
+//     "truncated": true and a "cursor" to pass back as ?cursor=<cursor> for the next page.
+//   - ?sort=value or ?sort=-value orders the blobs by value, ascending or descending, instead of by key.
+//     Sorting buffers the results and applies to each page on its own, not across pages.
+//   - ?format=withKeys lists each blob with its stored key, {"blobs": [{"key": "blob:<id>", "blob": "<blob>"}, ...]},
+//     instead of as a flat array of values.
+//   - With LIST_ETAGS=true the response carries a weak ETag computed from the ids and values on the page.
+//     A request whose If-None-Match lists it gets 304 Not Modified with no body.
+//
+// GET /get?key=<key>
+//   - Get the blob stored under key, such as "blob:1699999999000000000", with a single Get, as GET /blobs/<id> does.
+//   - Keys outside the "blob:" range are rejected with 400, and a key with no blob responds 404.
+//   - The key is used exactly as given, even with CASE_INSENSITIVE_IDS.
+//
+// GET /first and GET /last
+//   - Get the oldest or newest blob as {"id": "<id>", "blob": "<blob>"}, or 404 if there are none.
+//   - Oldest and newest follow key order, so they only hold for time-based keys without KEY_PARTITIONS.
+//
+// GET /search?regex=<pattern>
+//   - Get all blobs matching a regular expression in RE2 syntax, as {"blobs": [...]}.
+//   - Patterns longer than 256 bytes or that fail to compile are rejected with 400.
+//   - The search scans the whole store page by page and gives up with 503 after SEARCH_TIMEOUT.
+//   - ?limit=<n> returns at most n matches, capped at 1000. If more remain, the response includes "truncated": true and
+//     a "cursor" to pass back as ?cursor=<cursor> for the next page. The cursor carries the pattern and limit along.
+//   - With PARTIAL_RESULTS set, a search that times out part way responds 200 with the matches found so far,
+//     "partial": true and a "cursor" to continue from. One that timed out before scanning anything still gets 503.
+//
+// GET /draw?session=<id>
+//   - Get a random blob not yet drawn in the session, so each blob is drawn once per round.
+//   - Responds 404 once every blob has been drawn, and the session starts over on the next draw.
+//   - Drawn keys are kept under "draw:<session>:" and expire after DRAW_SESSION_TTL. This needs TTL enabled in TiKV.
+//
+// GET /blobs?action=recent&n=<n>
+//   - Get the newest n blobs, newest first, as {"blobs": [{"id": "<id>", "blob": "<blob>", "created": "<RFC 3339 time>"}, ...]}.
+//   - n defaults to 10 and is capped at 100. Like GET /last, newest follows key order, and "created" is only set for time-based keys.
+//
+// GET /blobs?action=archive
+//   - Download every blob as blobs.tar.gz, a gzipped tar archive with one file per blob named by its id.
+//   - The archive is streamed a page of blobs at a time. If TiKV fails partway through, the download ends early
+//     and the archive is truncated.
+//
+// POST /blobs?action=getMany
+//   - Get up to MAX_BATCH_SIZE (100 by default) blobs by id in one call. Request body should be a JSON object with an "ids" array.
+//   - Responds {"blobs": {"<id>": "<blob>", ...}, "missing": ["<id>", ...]}, both in the order the ids were given.
+//
+// GET /blobs/<id>
+//   - Get the blob stored under key "blob:<id>", or 404 if there is none.
+//   - ?meta=true responds {"id": "<id>", "blob": "<blob>", "created": "<RFC 3339 time>"}, with the creation time
+//     read from the time-based key. "created" is left out for keys that carry no time, such as content keys.
+//   - With SPLIT_METADATA set, ?meta=true also adds {"meta": {"created", "updated", "size"}}, kept under "meta:<id>"
+//     so the stored value stays raw. "meta" is null for blobs written before SPLIT_METADATA was turned on.
+//   - With STORE_CHECKSUMS set, the response adds "sha256", the checksum kept under "sum:<id>" since the blob was
+//     written. Blobs written before STORE_CHECKSUMS was turned on get theirs computed and stored on first read.
+//   - With INCLUDE_SIZE set, the response adds "size", the stored value's length in bytes, as does each entry of
+//     GET /blobs?action=recent.
+//
+// GET /blobs/<id>/exists
+//   - Check whether the blob stored under key "blob:<id>" exists.
+//   - Always responds 200 with {"exists": true} or {"exists": false}.
+//
+// POST /blobs/<id>/touch
+//   - Rewrite the blob with a fresh BLOB_TTL, for sliding expiration. Responds {"id": "<id>", "ttl": <seconds>},
+//     404 if the blob is absent, or 400 if BLOB_TTL is not set.
+//
+// POST /admin/migrate-keys?cursor=<cursor>&limit=<n>&delete=true
+//   - After switching to KEY_SCHEME=content, rewrite up to limit (default 100, at most 1000) time-based blobs under
+//     their content keys. With delete=true the time-based keys are deleted once rewritten.
+//   - Responds {"migrated", "duplicates", "deleted", "done"} and, until done, a "cursor" for the next batch.
+//     Re-running a batch is harmless: blobs already under their content key count as duplicates.
+//
+// POST /rpc
+//   - JSON-RPC 2.0 interface to the same operations: blob.create {"blob"}, blob.get {"id"}, blob.delete {"blob"},
+//     blob.list {"cursor", "sort"} and blob.count. The result is what the matching REST endpoint would return.
+//   - Handler errors map to JSON-RPC error codes: 400 to -32602, 404 to -32001, 409 to -32002, anything else to -32603.
+//     The error's data holds the HTTP status.
+//
+// GET /ws
+//   - Upgrades to a WebSocket that takes JSON command frames such as {"op": "create", "blob": "..."}.
+//   - The ops create, get, delete, list and count take the same parameters as the JSON-RPC methods above.
+//   - Each command is answered with {"op", "status", "result"} or {"op", "status", "error"}.
+//   - Frames are limited to 1 MiB, and the server pings every 30s and closes connections that stop answering.
+//
+// GET /
+//   - With ENABLE_UI set, a plain GET of / without a query serves a small HTML page for listing, adding and deleting blobs.
+//     GET / with any query, and every other route, behaves as documented here.
+//
+// GET /metrics
+//   - Prometheus metrics, including the tikvapi_blob_size_bytes histogram of blob sizes written by POST and PUT.
+//   - The gauges tikvapi_blobs, tikvapi_blob_bytes, tikvapi_newest_blob_age_seconds and tikvapi_blobs_delta
+//     (the change in blob count since the previous check) are refreshed every 30s by the monitoring goroutine,
+//     from a single scan of the store.
+//   - tikvapi_http_requests_total counts the HTTP requests served, by status code.
+//   - tikvapi_dedup_checks_total counts the duplicate checks made by POST, by method: "lookup" for the single Get
+//     of KEY_SCHEME=content and "scan" for the scan time-based keys need.
+//
+// GET /healthz and GET /readyz
+//   - Component status as {"status", "pool", "tikv", "available", "size"}, where each status is "ok", "degraded",
+//     "unknown" or "down" and "status" is the worst of "pool" and "tikv". Responds 200 when all are ok, 503 otherwise.
+//   - The pool is degraded when every client is in use. TiKV is checked with one read on a free client,
+//     and is unknown when no client is free.
+//
+// GET /stats
+//   - Pool and request figures in one JSON response, for deployments without Prometheus:
+//     {"pool": {"size", "available", "inUse", "uses"}, "requests": {"total", "clientErrors", "serverErrors", "byStatus"}}.
+//   - "uses" lists how many times each client has been taken from the pool, lowest first.
+//   - Request counts are read from tikvapi_http_requests_total, which is also served on /metrics.
+//
+// GET /debug/cluster
+//   - With DEBUG_ENDPOINTS set, the PD addresses (configured, secondary and in use), the TiKV cluster id, API version
+//     and keyspace, whether TLS is on, and the pool size. Certificate and key paths are never included.
+//   - 404 without DEBUG_ENDPOINTS.
+//
+// gRPC:
+//
+// With GRPC_ADDR set, the BlobService in blobpb/blobs.proto is served on that address alongside the HTTP server,
+// with Create, Get, Delete, Update, List and Count RPCs running the same logic as the endpoints above.
+//
+// Redis protocol:
+//
+// With REDIS_ADDR set, Redis clients can connect on that address and use PING, SET, GET, DEL and KEYS.
+// Redis key k maps to TiKV key "blob:k", so blobs created over HTTP show up under their ids.
+//
+// Responses:
+//
+// Every response body is compact JSON with Content-Type application/json and no trailing newline.
+// Add ?pretty=true to any request to get the body indented for reading instead.
+// Errors are reported as {"error": "<message>", "requestId": "<id>"} with the matching HTTP status.
+// The request ID is taken from the X-Request-ID request header or generated, and is returned in the X-Request-ID response header.
+// Server errors are logged with the same ID.
+// With ERROR_CODES set, errors also carry a numeric "code" that stays the same regardless of the HTTP status; see appErrors.
+// A method a route does not support is answered with 405 and an Allow header listing the ones it does.
+// A blob query parameter that is not valid URL encoding, such as "%zz", is rejected with 400 rather than read as empty.
+// One longer than MAX_QUERY_PARAM_LENGTH bytes once URL-encoded is rejected with 414; such blobs can be sent through POST /rpc.
+// The "blob" field and query parameter name can be changed with BLOB_FIELD_NAME, e.g. to "value" or "content".
 
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/tikv/client-go/v2/config"
 	"github.com/tikv/client-go/v2/rawkv"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/net/netutil"
 )
 
 const ClientPoolSize = 10
 const DefaultMonitoringInterval = 30 * time.Second
 const LogFile = "tikvApi.log"
 
+// RandomBlobAttempts is how many keys handleGETRandom tries before giving up when picked keys turn out to be deleted.
+const RandomBlobAttempts = 5
+
+// DedupWarningHeader is set on POST responses when the duplicate check stopped at DEDUP_SCAN_LIMIT blobs,
+// so a duplicate stored beyond them may have gone undetected.
+const DedupWarningHeader = "X-Dedup-Warning"
+
+// RetriesHeader is the response header reporting how many TiKV calls were retried while serving the request.
+const RetriesHeader = "X-TiKV-Retries"
+
 var clientPool chan RawKVClientInterface
 var ctx = context.Background()
 var pdAddrs = []string{"pd-server:2379"}
@@ -78,55 +274,347 @@ var security = config.Security{}
 // creates a pool of TiKV clients, and handles HTTP requests for retrieving, saving, and deleting blobs.
 // It uses the rawkv package to interact with TiKV.
 func main() {
+	loadConfig()
 	setupLogging(LogFile)
 	clientPool := setupClientPool(false) // not mock
+	if startupSelfCheck {
+		if err := runSelfCheck(clientPool); err != nil {
+			log.Fatalf("Startup self-check failed: %v", err)
+		}
+		log.Println("Startup self-check passed")
+	}
 	setupMonitoring(clientPool)
+	setupSweeper(clientPool)
+	setupPoolRefiller(clientPool)
+	setupDedupBloom(clientPool)
+	registerMetrics()
+
+	if grpcAddr != "" {
+		go func() {
+			log.Fatal(serveGRPC(grpcAddr, clientPool))
+		}()
+	}
+	if redisAddr != "" {
+		go func() {
+			log.Fatal(serveRESP(redisAddr, clientPool))
+		}()
+	}
 
 	mux := setupServer(clientPool)
-	log.Fatal(http.ListenAndServe(":8080", mux))
+	server := newHTTPServer(":8080", withMiddleware(mux))
+	lis, err := newListener(server.Addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Fatal(server.Serve(lis))
+}
+
+// withMiddleware wraps the routes in handler with the middleware every request goes through.
+func withMiddleware(handler http.Handler) http.Handler {
+	return withRequestMetrics(withRequestID(withCompression(withContentTypeCheck(withPrettyJSON(handler)))))
+}
+
+// newListener listens on addr. With MAX_CONNS set, at most that many connections are open at once;
+// further connections wait in the accept queue until one closes.
+func newListener(addr string) (net.Listener, error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if maxConns > 0 {
+		lis = netutil.LimitListener(lis, maxConns)
+	}
+	return lis, nil
+}
+
+// newHTTPServer returns the HTTP server for handler, with the connection timeouts from the configuration applied.
+// With ENABLE_H2C the server also speaks HTTP/2 without TLS, to clients that start with HTTP/2 prior knowledge
+// or upgrade with "Upgrade: h2c". HTTP/1.1 requests are served as before.
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	if enableH2C {
+		handler = h2c.NewHandler(handler, &http2.Server{IdleTimeout: serverIdleTimeout})
+	}
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: serverReadHeaderTimeout,
+		ReadTimeout:       serverReadTimeout,
+		WriteTimeout:      serverWriteTimeout,
+		IdleTimeout:       serverIdleTimeout,
+	}
 }
 
 func setupServer(clientPool chan RawKVClientInterface) *http.ServeMux {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if isUIRequest(r) {
+			handleUI(w, r)
+			return
+		}
 		handleRequest(w, r, clientPool)
 	})
+	mux.HandleFunc("/blobs", func(w http.ResponseWriter, r *http.Request) {
+		handleBlobRequest(w, r, clientPool)
+	})
+	mux.HandleFunc("/blobs/", func(w http.ResponseWriter, r *http.Request) {
+		handleBlobRequest(w, r, clientPool)
+	})
+	mux.HandleFunc("/admin/migrate-keys", func(w http.ResponseWriter, r *http.Request) {
+		withPooledClient(w, r, clientPool, handlePOSTMigrateKeys)
+	})
+	mux.HandleFunc("/rpc", func(w http.ResponseWriter, r *http.Request) {
+		withPooledClient(w, r, clientPool, handleRPC)
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		handleWebSocket(w, r, clientPool)
+	})
+	for _, path := range []string{"/healthz", "/readyz"} {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if !allowMethods(w, r, http.MethodGet) {
+				return
+			}
+			handleHealth(w, r, clientPool)
+		})
+	}
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethods(w, r, http.MethodGet) {
+			return
+		}
+		handleGETStats(w, clientPool)
+	})
+	mux.HandleFunc("/debug/cluster", func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethods(w, r, http.MethodGet) {
+			return
+		}
+		handleGETDebugCluster(w, clientPool)
+	})
+	mux.Handle("/metrics", metricsHandler)
 	return mux
 }
 
 // setupClientPool creates a pool of TiKV clients and returns a channel of clients.
 // The size of the pool is determined by the clientPoolSize variable.
-// Each client is created using the rawkv.NewClient function with the provided context, PD addresses, and security options.
-// If an error occurs while creating a client, the function will log a fatal error and exit.
+// Each client is created with createClient, which fails over to the secondary PD addresses if the primary cluster is unreachable.
+// If fewer than minPoolClients clients can be created, the function will log a fatal error and exit.
+// Otherwise the shortfall is logged and the missing clients are created in the background by fillClientPool.
+// With STORAGE_MODE=auto, a pool that ends up without any client is filled with the in-memory store instead.
 // The function returns a channel of clients that can be used to perform operations on TiKV.
 func setupClientPool(useMock bool) chan RawKVClientInterface {
 	clientPool := make(chan RawKVClientInterface, ClientPoolSize)
+	activePDAddrs = pdAddrs
+	var lastErr error
 	for i := 0; i < ClientPoolSize; i++ {
 		var client RawKVClientInterface
 		if useMock {
 			client = NewMockRawKVClientInterface(nil) // Assuming you have the mock generated
 		} else {
-			actualClient, err := rawkv.NewClient(ctx, pdAddrs, security)
+			var err error
+			client, err = createClient()
 			if err != nil {
-				log.Fatalf("Failed to create TiKV client: %v", err)
-			}
-			client = &RawKVClientWrapper{
-				client: actualClient,
+				log.Printf("Failed to create TiKV client: %v", err)
+				lastErr = err
+				continue
 			}
 		}
 		clientPool <- client
 	}
+
+	if len(clientPool) == 0 && storageMode == StorageModeAuto {
+		log.Printf("No TiKV client could be created, falling back to the in-memory store: %v", lastErr)
+		storageMode = StorageModeMemory
+		for len(clientPool) < ClientPoolSize {
+			clientPool <- memoryStore
+		}
+	}
+	if missing := ClientPoolSize - len(clientPool); missing > 0 {
+		if len(clientPool) < minPoolClients {
+			log.Fatalf("Failed to create TiKV client: only %d of the required %d clients could be created: %v", len(clientPool), minPoolClients, lastErr)
+		}
+		log.Printf("Started with %d of %d TiKV clients, creating the remaining %d in the background", len(clientPool), ClientPoolSize, missing)
+		go fillClientPool(clientPool, missing)
+	}
 	return clientPool
 }
 
+// clientReconnectInterval is how long fillClientPool waits between attempts to create a missing client.
+var clientReconnectInterval = 5 * time.Second
+
+// fillClientPool creates missing clients one at a time and adds them to the pool, retrying every
+// clientReconnectInterval until all of them exist.
+func fillClientPool(clientPool chan RawKVClientInterface, missing int) {
+	for missing > 0 {
+		time.Sleep(clientReconnectInterval)
+		client, err := createClient()
+		if err != nil {
+			log.Printf("Failed to create TiKV client, retrying in %v: %v", clientReconnectInterval, err)
+			continue
+		}
+		clientPool <- client
+		missing--
+		log.Printf("Created a missing TiKV client, %d still missing", missing)
+	}
+}
+
+// discardedClients counts the clients dropped from the pool by discardClient that the refiller has not replaced yet.
+var discardedClients atomic.Int32
+
+// discardClient drops a client taken from the pool that is no longer usable, instead of putting it back.
+// The pool is one client short until setupPoolRefiller replaces it, so POOL_REFILL_INTERVAL must be set
+// wherever clients are discarded. No request path discards clients yet.
+func discardClient(clientPool chan RawKVClientInterface, client RawKVClientInterface) {
+	if client == nil {
+		return
+	}
+	forgetClientUses(clientPool, client)
+	log.Printf("Discarded a TiKV client, %d now missing from the pool", discardedClients.Add(1))
+}
+
+// setupPoolRefiller starts a goroutine that replaces discarded clients every poolRefillInterval, so the pool
+// returns to its full size. It does nothing if POOL_REFILL_INTERVAL is 0.
+func setupPoolRefiller(clientPool chan RawKVClientInterface) {
+	if poolRefillInterval <= 0 {
+		return
+	}
+
+	go func() {
+		for {
+			time.Sleep(poolRefillInterval)
+			refillClientPool(clientPool)
+		}
+	}()
+}
+
+// refillClientPool creates a client for each discarded one and adds it to the pool. It never grows the pool past
+// its capacity, and stops at the first client that cannot be created, leaving the rest for the next run.
+func refillClientPool(clientPool chan RawKVClientInterface) {
+	for discardedClients.Load() > 0 {
+		client, err := createClient()
+		if err != nil {
+			log.Printf("Failed to replace a discarded TiKV client, retrying in %v: %v", poolRefillInterval, err)
+			return
+		}
+		select {
+		case clientPool <- client:
+		default:
+			// The pool is already full, so there is nothing left to replace.
+			discardedClients.Store(0)
+			return
+		}
+		log.Printf("Replaced a discarded TiKV client, %d still missing", discardedClients.Add(-1))
+	}
+}
+
+// newTiKVClient creates a client connected to the TiKV cluster behind the given PD addresses.
+// It is a variable so tests can substitute a fake factory.
+var newTiKVClient = func(addrs []string) (RawKVClientInterface, error) {
+	client, err := rawkv.NewClient(ctx, addrs, security)
+	if err != nil {
+		return nil, err
+	}
+	clusterID.Store(client.ClusterID())
+	enableAtomicCAS(client)
+	return NewRawKVClientWrapper(client), nil
+}
+
+// atomicCASSetter is the part of *rawkv.Client that switches it to atomic mode.
+type atomicCASSetter interface {
+	SetAtomicForCAS(b bool) *rawkv.Client
+}
+
+// enableAtomicCAS puts client in atomic mode when a feature relies on CompareAndSwap, which fails in any other mode:
+// REQUIRE_CLIENT_ID creates blobs with it and BLOB_COUNTER updates the counter with it.
+// TiKV requires every client writing the keys to use the same mode.
+func enableAtomicCAS(client atomicCASSetter) {
+	if requireClientID || blobCounter {
+		client.SetAtomicForCAS(true)
+	}
+}
+
+// activePDAddrs holds the PD addresses new clients are created against. It starts as pdAddrs and
+// switches to secondaryPDAddrs for good once a client cannot be created against the primary cluster.
+var activePDAddrs []string
+
+// createClient creates a client against the active cluster, failing over to the secondary cluster if that fails.
+// With STORAGE_MODE=memory it returns the shared in-memory store instead.
+func createClient() (RawKVClientInterface, error) {
+	if storageMode == StorageModeMemory {
+		return memoryStore, nil
+	}
+	client, err := newTiKVClient(activePDAddrs)
+	if err == nil || len(secondaryPDAddrs) == 0 || strings.Join(activePDAddrs, ",") == strings.Join(secondaryPDAddrs, ",") {
+		return client, err
+	}
+
+	log.Printf("Failed to create TiKV client against PD %v: %v. Failing over to secondary PD %v", activePDAddrs, err, secondaryPDAddrs)
+	activePDAddrs = secondaryPDAddrs
+	return newTiKVClient(activePDAddrs)
+}
+
+// Pool acquire modes, chosen with POOL_ACQUIRE_MODE.
+const (
+	// PoolAcquireWait waits up to poolAcquireTimeout for a client to be returned to an empty pool.
+	PoolAcquireWait = "wait"
+	// PoolAcquireFailFast gives up as soon as the pool is empty.
+	PoolAcquireFailFast = "failfast"
+)
+
+// getClientFromPool takes a client from the pool. If the pool is empty it returns nil immediately
+// in failfast mode, and otherwise waits up to poolAcquireTimeout for a client to be put back.
 func getClientFromPool(clientPool chan RawKVClientInterface) RawKVClientInterface {
-	if len(clientPool) > 0 && cap(clientPool) > 0 {
-		return <-clientPool
-	} else {
+	if cap(clientPool) == 0 {
+		return nil
+	}
+	select {
+	case client := <-clientPool:
+		recordClientUse(clientPool, client)
+		return client
+	default:
+	}
+	if poolAcquireMode == PoolAcquireFailFast || poolAcquireTimeout <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(poolAcquireTimeout)
+	defer timer.Stop()
+	select {
+	case client := <-clientPool:
+		recordClientUse(clientPool, client)
+		return client
+	case <-timer.C:
 		return nil
 	}
 }
 
+// runSelfCheck verifies that TiKV is reachable and writable by writing a sentinel key with a pooled client,
+// reading it back and deleting it again. The sentinel lives outside the "blob:" range so it is never counted as a blob.
+// The first failing step is returned as an error.
+func runSelfCheck(clientPool chan RawKVClientInterface) error {
+	client := getClientFromPool(clientPool)
+	if client == nil {
+		return fmt.Errorf("no client available in pool")
+	}
+	defer func() {
+		clientPool <- client
+	}()
+
+	key := []byte(fmt.Sprintf("selfcheck:%d", time.Now().UnixNano()))
+	value := []byte("ok")
+	if err := client.Put(ctx, key, value); err != nil {
+		return fmt.Errorf("write sentinel key: %w", err)
+	}
+	got, err := client.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("read sentinel key: %w", err)
+	}
+	if !bytes.Equal(got, value) {
+		return fmt.Errorf("read sentinel key: got %q, want %q", got, value)
+	}
+	if err := client.Delete(ctx, key); err != nil {
+		return fmt.Errorf("delete sentinel key: %w", err)
+	}
+	return nil
+}
+
 // setupLogging initializes a new logger and returns it.
 // The logger writes to a file named "tikvApi.log" in the current directory.
 // If the file does not exist, it will be created.
@@ -149,21 +637,272 @@ func setupMonitoring(clientPool chan RawKVClientInterface, interval ...time.Dura
 	}
 
 	go func() {
+		monitor := &blobMonitor{}
 		for {
 			time.Sleep(sleepDuration)
-			log.Printf("Number of keys in TiKV: %d", countBlobs(<-clientPool))
+			monitor.tickFromPool(clientPool)
 		}
 	}()
 }
 
+// Monitoring outputs, chosen with MONITOR_OUTPUT.
+const (
+	// MonitorOutputLog writes the stats of each monitoring tick to the log only.
+	MonitorOutputLog = "log"
+	// MonitorOutputMetric only sets the monitoring gauges, keeping the periodic stats out of the log.
+	MonitorOutputMetric = "metric"
+	// MonitorOutputBoth does both. It is the default.
+	MonitorOutputBoth = "both"
+)
+
+// blobStats summarizes the stored blobs for monitoring.
+type blobStats struct {
+	count int
+	bytes int
+	// capped is set when the scan stopped at countLimit, so count and bytes only cover the blobs seen up to then.
+	capped bool
+	// newest is the creation time of the newest blob, or zero if no blob has a time-based key.
+	newest time.Time
+}
+
+// blobMonitor carries what the monitoring goroutine remembers between ticks.
+type blobMonitor struct {
+	// previous is the blob count of the last successful tick, valid once hasPrevious is set.
+	previous    int
+	hasPrevious bool
+
+	// lastErr is the error of the last tick if it failed, and suppressed counts how often it has repeated
+	// since it was last logged.
+	lastErr    string
+	suppressed int
+}
+
+// logError logs a failed tick. An error identical to the previous tick's is only counted, and logged again
+// every monitoringErrorRepeat repeats if that is set, so an outage does not flood the log.
+func (m *blobMonitor) logError(err error) {
+	if err.Error() == m.lastErr {
+		m.suppressed++
+		if monitoringErrorRepeat > 0 && m.suppressed%monitoringErrorRepeat == 0 {
+			log.Printf("Failed to collect blob stats: %v (repeated %d times)", err, m.suppressed)
+		}
+		return
+	}
+	m.flushSuppressed()
+	m.lastErr = err.Error()
+	log.Printf("Failed to collect blob stats: %v", err)
+	log.Printf("Number of keys in TiKV: %d", -1)
+}
+
+// recover ends a run of failed ticks, logging how many repeats were suppressed.
+func (m *blobMonitor) recover() {
+	if m.lastErr == "" {
+		return
+	}
+	m.flushSuppressed()
+	log.Println("Collecting blob stats works again")
+	m.lastErr = ""
+}
+
+// flushSuppressed logs how many times the current error repeated without being logged.
+func (m *blobMonitor) flushSuppressed() {
+	if m.suppressed > 0 {
+		log.Printf("Previous blob stats error repeated %d more times: %s", m.suppressed, m.lastErr)
+	}
+	m.suppressed = 0
+}
+
+// tickFromPool runs a tick with a client borrowed from clientPool, returning the client once the tick is done.
+func (m *blobMonitor) tickFromPool(clientPool chan RawKVClientInterface) {
+	client := <-clientPool
+	m.tick(client)
+	clientPool <- client
+}
+
+// tick gathers blobStats in a single scan, logs them and updates the matching gauges, including the change
+// in blob count since the last successful tick. The first tick has nothing to compare with and reports no change.
+// The count is logged on its own line, as it always has been, and is -1 if the scan failed.
+// Repeats of the same failure are not logged on every tick; see logError.
+// MONITOR_OUTPUT chooses whether the stats are logged, set on the gauges, or both. Failures are logged either way.
+func (m *blobMonitor) tick(client RawKVClientInterface) {
+	stats, err := collectBlobStats(client)
+	if err != nil {
+		m.logError(err)
+		return
+	}
+	m.recover()
+	logStats := monitorOutput != MonitorOutputMetric
+	setGauges := monitorOutput != MonitorOutputLog
+
+	if logStats {
+		if stats.capped {
+			log.Printf("Number of keys in TiKV: at least %d (COUNT_LIMIT reached)", stats.count)
+		} else {
+			log.Printf("Number of keys in TiKV: %d", stats.count)
+		}
+	}
+	if setGauges {
+		blobsGauge.Set(float64(stats.count))
+		blobBytesGauge.Set(float64(stats.bytes))
+	}
+	// A capped count says nothing about how many blobs were added or removed, so it is never compared.
+	if m.hasPrevious && !stats.capped {
+		delta := stats.count - m.previous
+		if logStats {
+			log.Printf("Change in number of blobs since last check: %+d", delta)
+		}
+		if setGauges {
+			blobsDeltaGauge.Set(float64(delta))
+		}
+	}
+	m.previous, m.hasPrevious = stats.count, !stats.capped
+
+	if stats.newest.IsZero() {
+		if logStats {
+			log.Printf("Total size of blobs in TiKV: %d bytes", stats.bytes)
+		}
+		return
+	}
+	age := time.Since(stats.newest)
+	if logStats {
+		log.Printf("Total size of blobs in TiKV: %d bytes, newest blob age: %v", stats.bytes, age.Round(time.Second))
+	}
+	if setGauges {
+		newestBlobAgeGauge.Set(age.Seconds())
+	}
+}
+
+// collectBlobStats scans the whole "blob:" range page by page, counting the blobs, adding up their sizes
+// and finding the newest creation time among time-based keys. Like countBlobs it stops at countLimit.
+func collectBlobStats(client RawKVClientInterface) (blobStats, error) {
+	var stats blobStats
+	if client == nil {
+		return stats, errors.New("client is nil")
+	}
+
+	start := blobStart
+	for {
+		limit := countPageSize(stats.count)
+		keys, values, err := client.Scan(ctx, start, blobEnd, limit)
+		if err != nil {
+			return stats, err
+		}
+		if countLimit > 0 && stats.count+len(keys) > countLimit {
+			keys = keys[:countLimit-stats.count]
+			stats.capped = true
+		}
+		for i, key := range keys {
+			stats.count++
+			if i < len(values) {
+				stats.bytes += len(values[i])
+			}
+			if created, ok := blobCreated(strings.TrimPrefix(string(key), "blob:")); ok && created.After(stats.newest) {
+				stats.newest = created
+			}
+		}
+		if stats.capped || len(keys) < limit {
+			return stats, nil
+		}
+		start = nextScanKey(keys[len(keys)-1])
+	}
+}
+
 // handleRequest handles incoming HTTP requests and routes them to the appropriate handler function based on the request method.
 // It also manages a pool of rawkv clients to handle the requests.
 func handleRequest(w http.ResponseWriter, r *http.Request, clientPool chan RawKVClientInterface) {
+	withPooledClient(w, r, clientPool, func(w http.ResponseWriter, r *http.Request, client RawKVClientInterface) {
+		if !allowMethods(w, r, http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete) {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			handleGET(w, r, client)
+		case http.MethodPost:
+			handlePOST(w, r, client)
+		case http.MethodDelete:
+			handleDELETE(w, r, client)
+		case http.MethodPut:
+			handlePUT(w, r, client)
+		}
+	})
+}
+
+// handleBlobRequest handles requests addressed to a single blob by id, i.e. paths of the form /blobs/{id}/...
+func handleBlobRequest(w http.ResponseWriter, r *http.Request, clientPool chan RawKVClientInterface) {
+	withPooledClient(w, r, clientPool, func(w http.ResponseWriter, r *http.Request, client RawKVClientInterface) {
+		id, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/blobs/"), "/")
+		if (r.URL.Path == "/blobs" || id == "") && r.Method == http.MethodPost && r.URL.Query().Get("action") == "getMany" {
+			handlePOSTGetMany(w, r, client)
+			return
+		}
+		if (r.URL.Path == "/blobs" || id == "") && r.Method == http.MethodGet {
+			switch r.URL.Query().Get("action") {
+			case "recent":
+				handleGETRecent(w, r, client)
+				return
+			case "archive":
+				handleGETArchive(w, r, client)
+				return
+			}
+		}
+		if id == "" {
+			writeError(w, http.StatusBadRequest, "No blob id provided")
+			log.Println("No blob id provided")
+			return
+		}
+
+		switch rest {
+		case "":
+			if requireClientID && r.Method == http.MethodPost {
+				handlePOSTWithID(w, r, client, id)
+				return
+			}
+			if !allowMethods(w, r, http.MethodGet) {
+				return
+			}
+			handleGETByID(w, r, client, id)
+		case "exists":
+			if !allowMethods(w, r, http.MethodGet) {
+				return
+			}
+			handleGETExists(w, r, client, id)
+		case "touch":
+			if !allowMethods(w, r, http.MethodPost) {
+				return
+			}
+			handlePOSTTouch(w, r, client, id)
+		default:
+			writeError(w, http.StatusNotFound, "Not found")
+		}
+	})
+}
+
+// allowMethods reports whether the request uses one of the methods allowed on its route.
+// If it does not, it responds 405 with the allowed methods in the Allow header.
+func allowMethods(w http.ResponseWriter, r *http.Request, allowed ...string) bool {
+	for _, method := range allowed {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "Invalid request method")
+	log.Println("Invalid request method")
+	return false
+}
+
+// withPooledClient borrows a client from the pool for the duration of handler and returns it afterwards.
+// If no client can be had, right away in failfast mode or within poolAcquireTimeout in wait mode, the request fails
+// with a 503 and handler is not called.
+// The client handed to handler applies the configured read, write and scan timeouts to each TiKV call,
+// and retries failed reads up to maxReadRetries times, each attempt with its own timeout.
+// The response carries the number of TiKV retries the request needed in the retries header.
+func withPooledClient(w http.ResponseWriter, r *http.Request, clientPool chan RawKVClientInterface,
+	handler func(w http.ResponseWriter, r *http.Request, client RawKVClientInterface)) {
 	client := getClientFromPool(clientPool)
 
 	if client == nil || cap(clientPool) == 0 {
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		log.Println("Internal server error: clientPool empty")
+		writeError(w, http.StatusServiceUnavailable, "No TiKV client available")
+		log.Println("No TiKV client available: clientPool empty")
 		return
 	}
 
@@ -171,296 +910,968 @@ func handleRequest(w http.ResponseWriter, r *http.Request, clientPool chan RawKV
 		clientPool <- client
 	}()
 
-	switch r.Method {
-	case http.MethodGet:
-		handleGET(w, r, client)
-	case http.MethodPost:
-		handlePOST(w, r, client)
-	case http.MethodDelete:
-		handleDELETE(w, r, client)
-	case http.MethodPut:
-		handlePUT(w, r, client)
-	default:
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		log.Println("Invalid request method")
-		return
+	retries := new(atomic.Int64)
+	w = &retryHeaderWriter{ResponseWriter: w, retries: retries}
+	requestClient := client
+	if wrapper, ok := client.(*RawKVClientWrapper); ok {
+		requestClient = wrapper.withRetryCounter(retries)
+	}
+	if readTimeout > 0 || writeTimeout > 0 || scanTimeout > 0 {
+		requestClient = &timeoutClient{
+			client:       requestClient,
+			readTimeout:  readTimeout,
+			writeTimeout: writeTimeout,
+			scanTimeout:  scanTimeout,
+		}
+	}
+	if maxReadRetries > 0 {
+		requestClient = newReadRetryClient(requestClient, maxReadRetries, retries)
+	}
+
+	handler(w, r, requestClient)
+}
+
+// retryHeaderWriter sets the retries header from the request's retry counter just before the response header is sent.
+type retryHeaderWriter struct {
+	http.ResponseWriter
+	retries     *atomic.Int64
+	wroteHeader bool
+}
+
+func (w *retryHeaderWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.Header().Set(RetriesHeader, strconv.FormatInt(w.retries.Load(), 10))
 	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *retryHeaderWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController and wantsPrettyJSON.
+func (w *retryHeaderWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
 }
 
 // Further break down each HTTP method handler into its own function, e.g.:
 func handleGET(w http.ResponseWriter, r *http.Request, client RawKVClientInterface) {
 	action := r.URL.Path
-	log.Printf("GET action: %v", action)
+	if logActions {
+		log.Printf("GET action: %v", action)
+	}
 	if action == "/count" {
 		handleGETCount(w, client)
 	} else if action == "/all" {
 		handleGETAll(w, r, client)
+	} else if action == "/search" {
+		handleGETSearch(w, r, client)
+	} else if action == "/draw" {
+		handleGETDraw(w, r, client)
+	} else if action == "/get" {
+		handleGETByKey(w, r, client)
+	} else if action == "/first" {
+		handleGETEdge(w, r, client, false)
+	} else if action == "/last" {
+		handleGETEdge(w, r, client, true)
+	} else if action == "/" {
+		handleGETRoot(w, r, client)
 	} else {
 		handleGETRandom(w, r, client)
 	}
 }
 
+// Root GET behaviors, chosen with ROOT_GET_BEHAVIOR.
+const (
+	// RootGetRandom returns a random blob, as every unrecognised path does. It is the default.
+	RootGetRandom = "random"
+	// RootGetList lists the blobs, as /all does.
+	RootGetList = "list"
+	// RootGetCount returns the number of blobs, as /count does.
+	RootGetCount = "count"
+	// RootGetNoop responds 204 without touching TiKV.
+	RootGetNoop = "noop"
+)
+
+// handleGETRoot serves GET / according to rootGetBehavior.
+func handleGETRoot(w http.ResponseWriter, r *http.Request, client RawKVClientInterface) {
+	switch rootGetBehavior {
+	case RootGetList:
+		handleGETAll(w, r, client)
+	case RootGetCount:
+		handleGETCount(w, client)
+	case RootGetNoop:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		handleGETRandom(w, r, client)
+	}
+}
+
+// handlePOST stores the blob sent in the JSON request body, {"blob": "<blob>"}. Requests that send no blob in the body
+// fall back to the ?blob= query parameter, which is how the API was first called.
 func handlePOST(w http.ResponseWriter, r *http.Request, client RawKVClientInterface) {
-	blob := r.URL.Query().Get("blob")
+	blob, ok := bodyBlob(w, r)
+	if !ok {
+		return
+	}
+	if blob == "" {
+		if blob, ok = blobParam(w, r, blobFieldName); !ok {
+			return
+		}
+	}
 	if blob == "" {
-		http.Error(w, "No blob provided", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "No blob provided")
 		log.Println("No blob provided")
 		return
 	}
+	if !checkContentHash(w, r, blob) {
+		return
+	}
+	createBlob(w, r, client, blob, r.URL.Query().Get("id"))
+}
+
+// checkContentHash verifies the blob against the optional ?sha256= the client computed before sending it,
+// so a blob truncated or corrupted in transit is never stored. It responds 400 and reports false on a malformed
+// or mismatching hash. Without ?sha256= nothing is checked.
+func checkContentHash(w http.ResponseWriter, r *http.Request, blob string) bool {
+	want := r.URL.Query().Get("sha256")
+	if want == "" {
+		return true
+	}
+	wantSum, err := hex.DecodeString(want)
+	if err != nil || len(wantSum) != sha256.Size {
+		writeError(w, http.StatusBadRequest, "Invalid sha256")
+		log.Printf("Invalid sha256: %q", want)
+		return false
+	}
+	if sum := sha256.Sum256([]byte(blob)); !bytes.Equal(sum[:], wantSum) {
+		writeError(w, http.StatusBadRequest, "Blob does not match sha256")
+		log.Printf("Blob does not match sha256 %s", want)
+		return false
+	}
+	return true
+}
+
+// createBlob stores a new blob. With REQUIRE_CLIENT_ID it is stored under the id the client chose;
+// otherwise id is ignored and the key is generated by insertBlob.
+func createBlob(w http.ResponseWriter, r *http.Request, client RawKVClientInterface, blob string, id string) {
+	if requireClientID {
+		insertBlobWithID(w, r, client, blob, id)
+		return
+	}
 	insertBlob(w, r, client, blob)
 }
 
+// What POST and PUT do when the blob, or for PUT the new blob, is already stored, chosen with ?onDuplicate=.
+const (
+	// OnDuplicateConflict responds 409 with the existing blob's id. It is the default.
+	OnDuplicateConflict = "conflict"
+	// OnDuplicateOverwrite writes the blob over the existing one, refreshing its TTL and metadata.
+	// For PUT it goes ahead with the update, leaving both blobs with the same value.
+	OnDuplicateOverwrite = "overwrite"
+	// OnDuplicateIgnore leaves the existing blob as it is and responds 200 with its id. POST only.
+	OnDuplicateIgnore = "ignore"
+	// OnDuplicateMerge goes ahead with the update and deletes the other blob, so only one holds the value. PUT only.
+	OnDuplicateMerge = "merge"
+)
+
 func insertBlob(w http.ResponseWriter, r *http.Request, client RawKVClientInterface, blob string) {
+	onDuplicate := r.URL.Query().Get("onDuplicate")
+	switch onDuplicate {
+	case "":
+		onDuplicate = OnDuplicateConflict
+	case OnDuplicateConflict, OnDuplicateOverwrite, OnDuplicateIgnore:
+	default:
+		writeError(w, http.StatusBadRequest, "Invalid onDuplicate")
+		log.Printf("Invalid onDuplicate: %q", onDuplicate)
+		return
+	}
+
 	// Check if the blob already exists
-	keys, _, err := client.Scan(r.Context(), []byte("blob:"), []byte("blob:~"), 100)
+	existingKey, ok := findDuplicate(w, r, client, blob, nil)
+	if !ok {
+		return
+	}
+	if existingKey != nil {
+		id := strings.TrimPrefix(string(existingKey), "blob:")
+		switch onDuplicate {
+		case OnDuplicateOverwrite:
+			w.Header().Set("Location", "/blobs/"+id)
+			overwriteBlob(w, r, client, existingKey, blob)
+		case OnDuplicateIgnore:
+			w.Header().Set("Location", "/blobs/"+id)
+			writeJSON(w, http.StatusOK, map[string]string{"id": id, blobFieldName: blob})
+		default:
+			writeBlobExists(w, id)
+		}
+		return
+	}
+
+	key := newBlobKey(blob)
+	err := putBlob(r.Context(), client, key, []byte(blob))
 	if err != nil {
-		http.Error(w, "Failed to retrieve blobs", http.StatusInternalServerError)
-		log.Printf("Failed to retrieve blobs: %v", err)
+		writeSaveError(w, err, "Failed to save blob")
 		return
 	}
-	for _, key := range keys {
-		value, err := client.Get(r.Context(), key)
+	dedupBloom.add(key)
+	adjustBlobCount(r.Context(), client, 1)
+	if err := recordMeta(r.Context(), client, nil, key, []byte(blob)); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to save blob metadata")
+		log.Printf("Failed to save blob metadata: %v", err)
+		return
+	}
+	blobSizeBytes.Observe(float64(len(blob)))
+
+	// Return the saved blob as JSON
+	writeSavedBlob(w, r, client, key, blob)
+}
+
+// findDuplicate returns the key of a stored blob equal to blob, other than exclude, or nil if there is none.
+// With content keys this is a single lookup, skipped when DEDUP_BLOOM_SIZE's filter has never seen the key. With time-based keys every blob is compared,
+// or only the first dedupScanLimit when it is set; if that scan fills up, later blobs went unchecked, which the response says in the DedupWarningHeader.
+// If TiKV fails, it writes the 500 response and returns false.
+func findDuplicate(w http.ResponseWriter, r *http.Request, client RawKVClientInterface, blob string, exclude []byte) ([]byte, bool) {
+	if keyScheme == KeySchemeContent {
+		if !dedupBloom.mayContain(contentKey(blob)) {
+			dedupChecksTotal.WithLabelValues("bloom").Inc()
+			return nil, true
+		}
+		dedupChecksTotal.WithLabelValues("lookup").Inc()
+		existingKey, err := lookupContentKey(r.Context(), client, blob)
 		if err != nil {
-			http.Error(w, "Failed to retrieve blob", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "Failed to retrieve blob")
 			log.Printf("Failed to retrieve blob: %v", err)
-			return
+			return nil, false
 		}
-		if string(value) == blob {
-			http.Error(w, "Blob already exists", http.StatusConflict)
-			log.Println("Blob already exists")
-			return
+		if bytes.Equal(existingKey, exclude) {
+			return nil, true
 		}
+		return existingKey, true
 	}
 
-	key := fmt.Sprintf("blob:%d", time.Now().UnixNano())
-	err = client.Put(r.Context(), []byte(key), []byte(blob))
+	dedupChecksTotal.WithLabelValues("scan").Inc()
+	var keys, values [][]byte
+	var err error
+	if dedupScanLimit > 0 {
+		keys, values, err = client.Scan(r.Context(), blobStart, blobEnd, dedupScanLimit)
+	} else {
+		keys, values, err = scanAllBlobs(r.Context(), client)
+	}
 	if err != nil {
-		http.Error(w, "Failed to save blob", http.StatusInternalServerError)
-		log.Printf("Failed to save blob: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve blobs")
+		log.Printf("Failed to retrieve blobs: %v", err)
+		return nil, false
+	}
+	for i, key := range keys {
+		if bytes.Equal(key, exclude) {
+			continue
+		}
+		if dedupKey(string(values[i])) == dedupKey(blob) {
+			return key, true
+		}
+	}
+	if dedupScanLimit > 0 && len(keys) >= dedupScanLimit {
+		w.Header().Set(DedupWarningHeader, fmt.Sprintf("Only the first %d blobs were checked for duplicates", dedupScanLimit))
+	}
+	return nil, true
+}
+
+// overwriteBlob writes blob over the duplicate stored at key, for ?onDuplicate=overwrite.
+// The key stays the same, while the TTL and the metadata's update time are refreshed.
+func overwriteBlob(w http.ResponseWriter, r *http.Request, client RawKVClientInterface, key []byte, blob string) {
+	if err := putBlob(r.Context(), client, key, []byte(blob)); err != nil {
+		writeSaveError(w, err, "Failed to update blob")
+		return
+	}
+	if err := recordMeta(r.Context(), client, key, key, []byte(blob)); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to save blob metadata")
+		log.Printf("Failed to save blob metadata: %v", err)
 		return
 	}
+	blobSizeBytes.Observe(float64(len(blob)))
 
-	// Return the saved blob as JSON
-	resp := map[string]string{"blob": blob}
-	jsonResp, _ := json.Marshal(resp)
-	// if err != nil {
-	// 	http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
-	// 	log.Printf("Failed to marshal response: %v", err)
-	// 	return
-	// }
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(jsonResp)
+	writeSavedBlob(w, r, client, key, blob)
+}
+
+// writeBlobExists responds 409 for a blob that is already stored under id,
+// pointing the client at it so it doesn't have to look it up.
+func writeBlobExists(w http.ResponseWriter, id string) {
+	w.Header().Set("Location", "/blobs/"+id)
+	resp := map[string]interface{}{"error": "Blob already exists", "id": id}
+	addErrorCode(resp, "Blob already exists")
+	writeJSON(w, http.StatusConflict, resp)
+	log.Println("Blob already exists")
+}
+
+// writeSavedBlob responds with the blob just written under key, with its location (/blobs/<id>) in the Location header.
+// With ?echo=stored the value is read back from TiKV first, so the client sees exactly what was stored rather than what it sent.
+func writeSavedBlob(w http.ResponseWriter, r *http.Request, client RawKVClientInterface, key []byte, blob string) {
+	if r.URL.Query().Get("echo") == "stored" {
+		value, err := client.Get(r.Context(), key)
+		if err != nil || value == nil {
+			writeError(w, http.StatusInternalServerError, "Failed to read back blob")
+			log.Printf("Failed to read back blob %s: %v", key, err)
+			return
+		}
+		blob = string(value)
+	}
+
+	w.Header().Set("Location", "/blobs/"+strings.TrimPrefix(string(key), "blob:"))
+	resp := map[string]string{blobFieldName: blob}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// dedupKey returns the form of a blob used when checking for duplicates.
+// With whitespace normalization enabled, surrounding whitespace is trimmed and internal runs are collapsed to a single space.
+func dedupKey(blob string) string {
+	if !normalizeWhitespace {
+		return blob
+	}
+	return strings.Join(strings.Fields(blob), " ")
 }
 
 func handleDELETE(w http.ResponseWriter, r *http.Request, client RawKVClientInterface) {
-	blob := r.URL.Query().Get("blob")
+	blob, ok := blobParam(w, r, blobFieldName)
+	if !ok {
+		return
+	}
+	if blob == "" {
+		if blob, ok = bodyBlob(w, r); !ok {
+			return
+		}
+	}
 	if blob == "" {
-		http.Error(w, "No blob provided", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "No blob provided")
 		log.Println("No blob provided")
 		return
 	}
 
-	keys, _, err := client.Scan(r.Context(), []byte("blob:"), []byte("blob:~"), 100)
-	if err != nil {
-		http.Error(w, "Failed to retrieve blobs", http.StatusInternalServerError)
-		log.Printf("Failed to retrieve blobs: %v", err)
-		return
-	}
 	var keyToDelete []byte
-	for _, key := range keys {
-		value, err := client.Get(r.Context(), key)
+	if keyScheme == KeySchemeContent {
+		var err error
+		keyToDelete, err = lookupContentKey(r.Context(), client, blob)
 		if err != nil {
-			http.Error(w, "Failed to retrieve blob", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "Failed to retrieve blob")
 			log.Printf("Failed to retrieve blob: %v", err)
 			return
 		}
-		if string(value) == blob {
-			keyToDelete = key
-			break
+	} else {
+		keys, values, err := scanAllBlobs(r.Context(), client)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to retrieve blobs")
+			log.Printf("Failed to retrieve blobs: %v", err)
+			return
+		}
+		for i, key := range keys {
+			if string(values[i]) == blob {
+				keyToDelete = key
+				break
+			}
 		}
 	}
 
 	if keyToDelete == nil {
-		http.Error(w, "Blob not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "Blob not found")
 		log.Println("Blob not found")
 		return
 	}
 
-	err = client.Delete(r.Context(), keyToDelete)
+	err := client.Delete(r.Context(), keyToDelete)
 	if err != nil {
-		http.Error(w, "Failed to delete blob", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Failed to delete blob")
 		log.Printf("Failed to delete blob: %v", err)
 		return
 	}
+	adjustBlobCount(r.Context(), client, -1)
+	if err := deleteMeta(r.Context(), client, keyToDelete); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to delete blob metadata")
+		log.Printf("Failed to delete blob metadata: %v", err)
+		return
+	}
+
+	if deleteSuccessStatus == http.StatusNoContent {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
 
 	// Return success message as JSON
 	resp := map[string]string{"message": "Blob deleted successfully"}
-	jsonResp, _ := json.Marshal(resp)
-	// if err != nil {
-	// 	http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
-	// 	log.Printf("Failed to marshal response: %v", err)
-	// 	return
-	// }
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(jsonResp)
+	writeJSON(w, http.StatusOK, resp)
 }
 
 func handlePUT(w http.ResponseWriter, r *http.Request, client RawKVClientInterface) {
 	oldBlob := r.URL.Path[1:]
 	if oldBlob == "" {
-		http.Error(w, "No old blob provided", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "No old blob provided")
 		log.Println("No old blob provided")
 		return
 	}
-	newBlob := r.URL.Query().Get("newBlob")
+	if maxQueryParamLength > 0 && len(r.URL.EscapedPath())-1 > maxQueryParamLength {
+		writeError(w, http.StatusRequestURITooLong, "Blob too long for the URL, send it in the body of a POST /rpc call instead")
+		log.Printf("Old blob too long: %d bytes", len(r.URL.EscapedPath())-1)
+		return
+	}
+	newBlob, ok := blobParam(w, r, "newBlob")
+	if !ok {
+		return
+	}
 	if newBlob == "" {
-		insertBlob(w, r, client, oldBlob)
+		createBlob(w, r, client, oldBlob, r.URL.Query().Get("id"))
 		return
 	}
-
-	keys, _, err := client.Scan(r.Context(), []byte("blob:"), []byte("blob:~"), 100)
-	if err != nil {
-		http.Error(w, "Failed to retrieve blobs", http.StatusInternalServerError)
-		log.Printf("Failed to retrieve blobs: %v", err)
+	onDuplicate := r.URL.Query().Get("onDuplicate")
+	switch onDuplicate {
+	case "":
+		onDuplicate = OnDuplicateConflict
+	case OnDuplicateConflict, OnDuplicateOverwrite, OnDuplicateMerge:
+	default:
+		writeError(w, http.StatusBadRequest, "Invalid onDuplicate")
+		log.Printf("Invalid onDuplicate: %q", onDuplicate)
 		return
 	}
+
 	var keyToUpdate []byte
-	for _, key := range keys {
-		value, err := client.Get(r.Context(), key)
+	if keyScheme == KeySchemeContent {
+		var err error
+		keyToUpdate, err = lookupContentKey(r.Context(), client, oldBlob)
 		if err != nil {
-			http.Error(w, "Failed to retrieve blob", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "Failed to retrieve blob")
 			log.Printf("Failed to retrieve blob: %v", err)
 			return
 		}
-		if string(value) == oldBlob {
-			keyToUpdate = key
-			break
+	} else {
+		keys, values, err := scanAllBlobs(r.Context(), client)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to retrieve blobs")
+			log.Printf("Failed to retrieve blobs: %v", err)
+			return
+		}
+		for i, key := range keys {
+			if string(values[i]) == oldBlob {
+				keyToUpdate = key
+				break
+			}
 		}
 	}
 
 	if keyToUpdate == nil {
-		http.Error(w, "Blob not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "Blob not found")
 		log.Println("Blob not found")
 		return
 	}
 
-	err = client.Put(r.Context(), keyToUpdate, []byte(newBlob))
+	// Another blob may already hold the new value.
+	duplicateKey, ok := findDuplicate(w, r, client, newBlob, keyToUpdate)
+	if !ok {
+		return
+	}
+	if duplicateKey != nil && onDuplicate == OnDuplicateConflict {
+		writeBlobExists(w, strings.TrimPrefix(string(duplicateKey), "blob:"))
+		return
+	}
+
+	if err := recordHistory(r.Context(), client, keyToUpdate, []byte(oldBlob)); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to record blob history")
+		log.Printf("Failed to record blob history: %v", err)
+		return
+	}
+
+	// Content-addressed blobs move to the key of their new content.
+	newKey := keyToUpdate
+	if keyScheme == KeySchemeContent {
+		newKey = contentKey(newBlob)
+	}
+	err := putBlob(r.Context(), client, newKey, []byte(newBlob))
 	if err != nil {
-		http.Error(w, "Failed to update blob", http.StatusInternalServerError)
-		log.Printf("Failed to update blob: %v", err)
+		writeSaveError(w, err, "Failed to update blob")
+		return
+	}
+	dedupBloom.add(newKey)
+	if err := recordMeta(r.Context(), client, keyToUpdate, newKey, []byte(newBlob)); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to save blob metadata")
+		log.Printf("Failed to save blob metadata: %v", err)
 		return
 	}
+	if !bytes.Equal(newKey, keyToUpdate) {
+		if err := client.Delete(r.Context(), keyToUpdate); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to update blob")
+			log.Printf("Failed to delete old blob key: %v", err)
+			return
+		}
+		// The new content key was already taken by the duplicate, so one blob fewer is stored.
+		if bytes.Equal(newKey, duplicateKey) {
+			adjustBlobCount(r.Context(), client, -1)
+		}
+	}
+	// A content key is the duplicate's own key, so the update has already merged into it.
+	if duplicateKey != nil && onDuplicate == OnDuplicateMerge && !bytes.Equal(duplicateKey, newKey) {
+		if err := client.Delete(r.Context(), duplicateKey); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to delete blob")
+			log.Printf("Failed to delete duplicate blob: %v", err)
+			return
+		}
+		adjustBlobCount(r.Context(), client, -1)
+		if err := deleteMeta(r.Context(), client, duplicateKey); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to delete blob metadata")
+			log.Printf("Failed to delete blob metadata: %v", err)
+			return
+		}
+	}
+	blobSizeBytes.Observe(float64(len(newBlob)))
 
 	// Return the updated blob as JSON
-	resp := map[string]string{"blob": newBlob}
-	jsonResp, _ := json.Marshal(resp)
-	// if err != nil {
-	// 	http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
-	// 	log.Printf("Failed to marshal response: %v", err)
-	// 	return
-	// }
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(jsonResp)
+	writeSavedBlob(w, r, client, newKey, newBlob)
 }
 
 func handleGETCount(w http.ResponseWriter, client RawKVClientInterface) {
-	count := countBlobs(client)
-	resp := map[string]int{"count": count}
-	jsonResp, _ := json.Marshal(resp)
-	// if err != nil {
-	// 	http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
-	// 	log.Printf("Failed to marshal response: %v", err)
-	// 	return
-	// }
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(jsonResp)
+	if blobCounter {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"count": storedBlobCount(ctx, client)})
+		return
+	}
+	count, atLeast := countBlobs(client)
+	resp := map[string]interface{}{"count": count}
+	if atLeast {
+		resp["atLeast"] = true
+	}
+	writeJSON(w, http.StatusOK, resp)
 }
 
+// List formats for GET /all, chosen with ?format=. Without it the blobs are a flat array of values.
+const (
+	// ListFormatWithKeys lists each blob as {"key": "blob:<id>", "blob": "<blob>"}, so it can be updated or deleted by key.
+	ListFormatWithKeys = "withKeys"
+)
+
+// handleGETAll returns the stored blobs in key order.
+// When maxAllResults is set, at most that many blobs are returned; if more remain, the response is marked
+// truncated and carries a cursor which can be passed back as ?cursor= to continue from the next blob.
 func handleGETAll(w http.ResponseWriter, r *http.Request, client RawKVClientInterface) {
-	keys, _, err := client.Scan(r.Context(), []byte("blob:"), []byte("blob:~"), 100)
+	sortOrder := r.URL.Query().Get("sort")
+	if sortOrder != "" && sortOrder != "value" && sortOrder != "-value" {
+		writeError(w, http.StatusBadRequest, "Invalid sort")
+		log.Printf("Invalid sort: %q", sortOrder)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != ListFormatWithKeys {
+		writeError(w, http.StatusBadRequest, "Invalid format")
+		log.Printf("Invalid format: %q", format)
+		return
+	}
+
+	startKey := blobStart
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		if !strings.HasPrefix(cursor, "blob:") {
+			writeError(w, http.StatusBadRequest, "Invalid cursor")
+			log.Printf("Invalid cursor: %q", cursor)
+			return
+		}
+		startKey = []byte(cursor)
+	}
+
+	var keys, values [][]byte
+	var err error
+	if maxAllResults > 0 {
+		// Fetch one extra key to find out whether anything is left after this page.
+		keys, values, err = client.Scan(r.Context(), startKey, blobEnd, maxAllResults+1)
+	} else {
+		keys, values, err = scanRange(r.Context(), client, startKey, blobEnd)
+	}
 	if err != nil {
-		http.Error(w, "Failed to retrieve blobs", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve blobs")
 		log.Printf("Failed to retrieve blobs: %v", err)
 		return
 	}
 	if len(keys) == 0 {
-		http.Error(w, "No blobs found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "No blobs found")
 		log.Println("No blobs found")
 		return
 	}
 
-	// Retrieve all blobs' values
-	var blobs []string
-	for _, key := range keys {
-		value, err := client.Get(r.Context(), key)
-		if err != nil {
-			http.Error(w, "Failed to retrieve blob", http.StatusInternalServerError)
-			log.Printf("Failed to retrieve blob: %v", err)
+	var nextCursor string
+	if maxAllResults > 0 && len(keys) > maxAllResults {
+		nextCursor = string(keys[maxAllResults])
+		keys = keys[:maxAllResults]
+		values = values[:maxAllResults]
+	}
+
+	// The scan returns the values along with the keys, so no further reads are needed.
+	blobs := make([]string, len(values))
+	for i, value := range values {
+		blobs[i] = string(value)
+	}
+
+	if listETags {
+		etag := listETag(keys, values, sortOrder, format, nextCursor)
+		w.Header().Set("ETag", etag)
+		if etagMatches(r, etag) {
+			w.WriteHeader(http.StatusNotModified)
 			return
 		}
-		blobs = append(blobs, string(value))
 	}
 
-	// Return all blobs as JSON array
-	resp := map[string][]string{"blobs": blobs}
-	jsonResp, _ := json.Marshal(resp)
-	// if err != nil {
-	// 	http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
-	// 	log.Printf("Failed to marshal response: %v", err)
-	// 	return
-	// }
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(jsonResp)
+	resp := map[string]interface{}{}
+	if format == ListFormatWithKeys {
+		entries := make([]map[string]string, len(keys))
+		for i, key := range keys {
+			entries[i] = map[string]string{"key": string(key), blobFieldName: blobs[i]}
+		}
+		// Sorting needs the whole page in memory, which the response already does.
+		switch sortOrder {
+		case "value":
+			sort.SliceStable(entries, func(i, j int) bool { return entries[i][blobFieldName] < entries[j][blobFieldName] })
+		case "-value":
+			sort.SliceStable(entries, func(i, j int) bool { return entries[i][blobFieldName] > entries[j][blobFieldName] })
+		}
+		resp["blobs"] = entries
+	} else {
+		switch sortOrder {
+		case "value":
+			sort.Strings(blobs)
+		case "-value":
+			sort.Sort(sort.Reverse(sort.StringSlice(blobs)))
+		}
+		// Return all blobs as JSON array
+		resp["blobs"] = blobs
+	}
+	if nextCursor != "" {
+		resp["truncated"] = true
+		resp["cursor"] = nextCursor
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleGETEdge returns the blob with the lowest key, or the highest when last is set, as {"id": ..., "blob": ...}.
+// With time-based keys these are the oldest and newest blobs, found with a single one-key scan.
+func handleGETEdge(w http.ResponseWriter, r *http.Request, client RawKVClientInterface, last bool) {
+	var keys, values [][]byte
+	var err error
+	if last {
+		keys, values, err = client.ReverseScan(r.Context(), blobEnd, blobStart, 1)
+	} else {
+		keys, values, err = client.Scan(r.Context(), blobStart, blobEnd, 1)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve blobs")
+		log.Printf("Failed to retrieve blobs: %v", err)
+		return
+	}
+	if len(keys) == 0 {
+		writeError(w, http.StatusNotFound, "No blobs found")
+		log.Println("No blobs found")
+		return
+	}
+
+	resp := map[string]string{"id": strings.TrimPrefix(string(keys[0]), "blob:"), blobFieldName: string(values[0])}
+	writeJSON(w, http.StatusOK, resp)
 }
 
 func handleGETRandom(w http.ResponseWriter, r *http.Request, client RawKVClientInterface) {
-	keys, _, err := client.Scan(r.Context(), []byte("blob:"), []byte("blob:~"), 100)
+	keys, _, err := scanAllBlobs(r.Context(), client)
 	if err != nil {
-		http.Error(w, "Failed to retrieve blobs", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve blobs")
 		log.Printf("Failed to retrieve blobs: %v", err)
 		return
 	}
 	if len(keys) == 0 {
-		http.Error(w, "No blobs found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "No blobs found")
 		log.Println("No blobs found")
 		return
 	}
 
-	// Use local random generator to select a random blob
+	// Use local random generator to select a random blob.
+	// A key can be deleted between the scan and the Get, in which case the Get comes back empty;
+	// drop that key and pick another, up to RandomBlobAttempts times.
 	randGen := rand.New(rand.NewSource(time.Now().UnixNano()))
-	randomIndex := randGen.Intn(len(keys))
-	randomKey := keys[randomIndex]
-	value, err := client.Get(r.Context(), randomKey)
-	if err != nil {
-		http.Error(w, "Failed to retrieve blob", http.StatusInternalServerError)
-		log.Printf("Failed to retrieve blob: %v", err)
+	var value, randomKey []byte
+	for attempt := 0; attempt < RandomBlobAttempts && len(keys) > 0; attempt++ {
+		randomIndex := randGen.Intn(len(keys))
+		randomKey = keys[randomIndex]
+		value, err = client.Get(r.Context(), randomKey)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to retrieve blob")
+			log.Printf("Failed to retrieve blob: %v", err)
+			return
+		}
+		if len(value) > 0 {
+			break
+		}
+		log.Printf("Blob %s disappeared before it could be read, picking another", randomKey)
+		keys = append(keys[:randomIndex], keys[randomIndex+1:]...)
+	}
+	if len(value) == 0 {
+		writeError(w, http.StatusNotFound, "No blobs found")
+		log.Println("No blobs found")
 		return
 	}
 	blob := string(value)
 
 	// Return the blob (either provided or retrieved) as JSON
-	resp := map[string]string{"blob": blob}
-	jsonResp, _ := json.Marshal(resp)
-	// if err != nil {
-	// 	http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
-	// 	log.Printf("Failed to marshal response: %v", err)
-	// 	return
-	// }
+	resp := map[string]string{blobFieldName: blob}
+	if withID, _ := strconv.ParseBool(r.URL.Query().Get("withId")); withID {
+		resp["id"] = strings.TrimPrefix(string(randomKey), "blob:")
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleGETByKey returns the blob stored under the "key" query parameter with a single Get, as GET /blobs/<id> does.
+// The key must lie in the "blob:" range, so other keys such as metadata cannot be read through it. It is read exactly
+// as given: unlike an id, it is not lowercased under CASE_INSENSITIVE_IDS.
+func handleGETByKey(w http.ResponseWriter, r *http.Request, client RawKVClientInterface) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		writeError(w, http.StatusBadRequest, "No key provided")
+		log.Println("No key provided")
+		return
+	}
+	if !strings.HasPrefix(key, "blob:") {
+		writeError(w, http.StatusBadRequest, "Invalid key")
+		log.Printf("Invalid key: %q", key)
+		return
+	}
+	handleGETBlob(w, r, client, strings.TrimPrefix(key, "blob:"), []byte(key))
+}
+
+// handleGETByID returns the blob stored under the given id, or 404 if there is none.
+func handleGETByID(w http.ResponseWriter, r *http.Request, client RawKVClientInterface, id string) {
+	handleGETBlob(w, r, client, id, idKey(id))
+}
+
+// handleGETBlob returns the blob with the given id stored under key, or 404 if there is none.
+func handleGETBlob(w http.ResponseWriter, r *http.Request, client RawKVClientInterface, id string, key []byte) {
+	withMeta, _ := strconv.ParseBool(r.URL.Query().Get("meta"))
+
+	value, err := client.Get(r.Context(), key)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve blob")
+		log.Printf("Failed to retrieve blob: %v", err)
+		return
+	}
+	if value == nil {
+		writeError(w, http.StatusNotFound, "Blob not found")
+		log.Println("Blob not found")
+		return
+	}
+
+	var sum string
+	if storeChecksums {
+		sum, err = blobChecksum(r.Context(), client, key, value)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to retrieve blob checksum")
+			log.Printf("Failed to retrieve blob checksum: %v", err)
+			return
+		}
+	}
+
+	if withMeta {
+		resp := map[string]interface{}{"id": id, blobFieldName: string(value)}
+		if sum != "" {
+			resp["sha256"] = sum
+		}
+		if includeSize {
+			resp["size"] = len(value)
+		}
+		if created, ok := blobCreated(id); ok {
+			resp["created"] = created.Format(time.RFC3339Nano)
+		}
+		if splitMetadata {
+			meta, err := getMeta(r.Context(), client, key)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "Failed to retrieve blob metadata")
+				log.Printf("Failed to retrieve blob metadata: %v", err)
+				return
+			}
+			resp["meta"] = meta
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	resp := map[string]interface{}{blobFieldName: string(value)}
+	if sum != "" {
+		resp["sha256"] = sum
+	}
+	if includeSize {
+		resp["size"] = len(value)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleGETExists reports whether the blob with the given id exists, using a single Get.
+// The response is 200 with {"exists": true|false} either way.
+func handleGETExists(w http.ResponseWriter, r *http.Request, client RawKVClientInterface, id string) {
+	value, err := client.Get(r.Context(), idKey(id))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve blob")
+		log.Printf("Failed to retrieve blob: %v", err)
+		return
+	}
+
+	resp := map[string]bool{"exists": value != nil}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// errQueryParamTooLong is returned by queryParam for values longer than maxQueryParamLength.
+var errQueryParamTooLong = errors.New("query parameter too long")
+
+// blobParam returns the blob passed in the named query parameter. If the value is malformed or too long,
+// it writes the 400 or 414 response and returns false.
+func blobParam(w http.ResponseWriter, r *http.Request, name string) (string, bool) {
+	blob, err := queryParam(r, name)
+	if errors.Is(err, errQueryParamTooLong) {
+		writeError(w, http.StatusRequestURITooLong, "Blob too long for the URL, send it in the body of a POST /rpc call instead")
+		log.Printf("%s too long for the URL", name)
+		return "", false
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Malformed URL encoding in %s", name))
+		log.Printf("Malformed URL encoding in %s: %v", name, err)
+		return "", false
+	}
+	return blob, true
+}
+
+// bodyBlob returns the blob sent in the JSON request body as {"blob": "<blob>"}, for blobs too long for the URL.
+// The field is named after blobFieldName, like the query parameter. A request without a body yields "".
+// If the body is not such an object, it writes the 400 response and returns false.
+func bodyBlob(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if r.Body == nil || r.ContentLength == 0 {
+		return "", true
+	}
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		if errors.Is(err, io.EOF) {
+			return "", true
+		}
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		log.Printf("Invalid request body: %v", err)
+		return "", false
+	}
+	var blob string
+	if raw, ok := body[blobFieldName]; ok {
+		if err := json.Unmarshal(raw, &blob); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request body")
+			log.Printf("Invalid request body: %s is not a string", blobFieldName)
+			return "", false
+		}
+	}
+	return blob, true
+}
+
+// queryParam returns the named query parameter of r. Unlike r.URL.Query, which silently drops pairs it cannot decode,
+// it returns an error if the parameter is present but its value is not valid URL encoding.
+func queryParam(r *http.Request, name string) (string, error) {
+	for _, pair := range strings.Split(r.URL.RawQuery, "&") {
+		rawKey, rawValue, _ := strings.Cut(pair, "=")
+		if key, err := url.QueryUnescape(rawKey); err != nil || key != name {
+			continue
+		}
+		// The encoded length is what makes URLs too long for proxies, so that is what is limited.
+		if maxQueryParamLength > 0 && len(rawValue) > maxQueryParamLength {
+			return "", errQueryParamTooLong
+		}
+		return url.QueryUnescape(rawValue)
+	}
+	return "", nil
+}
+
+// writeJSON writes v as the compact JSON response body with the given status.
+// Bodies never end in a trailing newline, so every response, success or error, has the same byte-exact format.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	var jsonResp []byte
+	var err error
+	if wantsPrettyJSON(w) {
+		jsonResp, err = json.MarshalIndent(v, "", "  ")
+	} else {
+		jsonResp, err = json.Marshal(v)
+	}
+	if err != nil {
+		log.Printf("Failed to marshal response: %v", err)
+		status = http.StatusInternalServerError
+		jsonResp = []byte(`{"error":"Failed to marshal response"}`)
+	}
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	w.Write(jsonResp)
 }
 
-// Implement countBlobs function to count the number of blobs in the TiKV store.
-func countBlobs(client RawKVClientInterface) int {
+// writeError writes an error response of the form {"error": message}.
+// With ERROR_CODES set, the message's application-level code from appErrors is included as "code".
+// If the request has an ID, it is included as "requestId", and server errors are logged with it
+// so the response can be matched to the log lines around it.
+func writeError(w http.ResponseWriter, status int, message string) {
+	resp := map[string]interface{}{"error": message}
+	addErrorCode(resp, message)
+	id := requestID(w)
+	if id == "" {
+		writeJSON(w, status, resp)
+		return
+	}
+	if status >= http.StatusInternalServerError {
+		log.Printf("Request %s failed with %d: %s", id, status, message)
+	}
+	resp["requestId"] = id
+	writeJSON(w, status, resp)
+}
+
+// writeSaveError responds to a failed write of a blob. TiKV refusing the blob for its size is the client's to fix,
+// so it gets 413 with a message of its own. Any other failure gets 500 with message.
+func writeSaveError(w http.ResponseWriter, err error, message string) {
+	if isEntryTooLarge(err) {
+		writeError(w, http.StatusRequestEntityTooLarge, "Blob too large for TiKV")
+		log.Printf("Blob too large for TiKV: %v", err)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, message)
+	log.Printf("%s: %v", message, err)
+}
+
+// addErrorCode sets "code" in an error response to the code of message, when ERROR_CODES is set and the message has one.
+func addErrorCode(resp map[string]interface{}, message string) {
+	if !errorCodes {
+		return
+	}
+	if code, ok := errorCode(message); ok {
+		resp["code"] = code
+	}
+}
+
+// countBlobs counts the blobs in the TiKV store a page at a time, returning -1 if the client is nil or a scan fails.
+// With countLimit set it stops once that many have been counted and reports atLeast, so large stores stay cheap to count.
+func countBlobs(client RawKVClientInterface) (count int, atLeast bool) {
 	if client == nil {
 		log.Println("Client is nil")
-		return -1
+		return -1, false
 	}
 
-	keys, _, err := client.Scan(ctx, []byte("blob:"), []byte("blob:~"), 100)
-	if err != nil {
-		log.Printf("Failed to count blobs: %v", err)
-		return -1
+	start := blobStart
+	for {
+		limit := countPageSize(count)
+		keys, _, err := client.Scan(ctx, start, blobEnd, limit)
+		if err != nil {
+			log.Printf("Failed to count blobs: %v", err)
+			return -1, false
+		}
+		count += len(keys)
+		if countLimit > 0 && count > countLimit {
+			return countLimit, true
+		}
+		if len(keys) < limit {
+			return count, false
+		}
+		start = nextScanKey(keys[len(keys)-1])
+	}
+}
+
+// countPageSize is how many keys to scan next when counted keys have been counted so far.
+// Near countLimit it asks for one key past the limit, which tells a store of exactly countLimit blobs
+// apart from a larger one.
+func countPageSize(counted int) int {
+	if countLimit > 0 && countLimit-counted+1 < SearchPageSize {
+		return countLimit - counted + 1
 	}
-	return len(keys)
+	return SearchPageSize
 }
@@ -4,19 +4,25 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
 )
 
 func TestServer(t *testing.T) {
@@ -46,7 +52,7 @@ func TestServer(t *testing.T) {
 		[]byte("blob:2"),
 		[]byte("blob:3"),
 	}
-	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, nil).AnyTimes()
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, nil, nil).AnyTimes()
 
 	// Mock the Get method for the GET request.
 	mockClient.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]byte("randomValue"), nil).AnyTimes()
@@ -61,6 +67,16 @@ func TestServer(t *testing.T) {
 	// Assert that the response status code is 200.
 	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
 }
+
+// repeatValue returns n copies of value, as the values of a mocked Scan whose blobs all hold the same value.
+func repeatValue(value string, n int) [][]byte {
+	values := make([][]byte, n)
+	for i := range values {
+		values[i] = []byte(value)
+	}
+	return values
+}
+
 func TestHandleRequest(t *testing.T) {
 	// Create a mock controller
 	ctrl := gomock.NewController(t)
@@ -81,7 +97,7 @@ func TestHandleRequest(t *testing.T) {
 		[]byte("blob:2"),
 		[]byte("blob:3"),
 	}
-	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, nil).AnyTimes()
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, repeatValue("randomValue", len(mockKeys)), nil).AnyTimes()
 
 	// Mock the Get method for the GET request.
 	mockClient.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]byte("randomValue"), nil).AnyTimes()
@@ -244,7 +260,6 @@ func TestSetupMonitoring(t *testing.T) {
 	// Mock client pool.
 	clientPool := make(chan RawKVClientInterface, 1)
 	clientPool <- mockClient
-	defer close(clientPool)
 
 	// Set expectations on the mock client
 	mockKeys := [][]byte{[]byte("key1"), []byte("key2")}
@@ -263,6 +278,14 @@ func TestSetupMonitoring(t *testing.T) {
 	// Sleep for a duration longer than the monitoring interval to ensure the monitoring goroutine runs
 	time.Sleep(150 * time.Millisecond)
 
+	// Take the client back, so the monitoring goroutine waits for it from now on
+	select {
+	case client := <-clientPool:
+		assert.Equal(t, mockClient, client)
+	case <-time.After(time.Second):
+		t.Fatal("Monitoring did not return its client to the pool")
+	}
+
 	// Check if the log contains the expected output
 	expectedLog := fmt.Sprintf("Number of keys in TiKV: %d", len(mockKeys))
 	if !strings.Contains(buf.String(), expectedLog) {
@@ -290,10 +313,8 @@ func TestHandlePOST(t *testing.T) {
 		[]byte("blob:2"),
 		[]byte("blob:3"),
 	}
-	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, nil)
-
-	// Mock the Get method to return different values for each key to simulate that the blob doesn't exist.
-	mockClient.EXPECT().Get(context.Background(), gomock.Any()).Return([]byte("notPostMe"), nil).AnyTimes()
+	// The scan returns the values with the keys, all different from the new blob, so no Get is needed.
+	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, repeatValue("notPostMe", len(mockKeys)), nil)
 
 	// Mock the Put method to save the blob.
 	mockClient.EXPECT().Put(context.Background(), gomock.Any(), []byte("postMe")).Return(nil)
@@ -343,18 +364,13 @@ func TestHandleDELETE(t *testing.T) {
 		[]byte("blob:2"),
 		[]byte("blob:3"),
 	}
-	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, nil)
-
-	// Mock the Get method for each key.
-	// For the first key, return a blob that doesn't match the one in the request.
-	mockClient.EXPECT().Get(context.Background(), mockKeys[0]).Return([]byte("notTheBlobToDelete"), nil)
-
-	// For the second key, return the blob that matches the one in the request.
-	mockClient.EXPECT().Get(context.Background(), mockKeys[1]).Return([]byte("deleteMe"), nil)
-
-	// For the third key, return another blob that doesn't match the one in the request.
-	// This expectation might not be called, so we use AnyTimes().
-	mockClient.EXPECT().Get(context.Background(), mockKeys[2]).Return([]byte("anotherBlob"), nil).AnyTimes()
+	// The scan returns each key's value, and the second one matches the blob to delete.
+	mockValues := [][]byte{
+		[]byte("notTheBlobToDelete"),
+		[]byte("deleteMe"),
+		[]byte("anotherBlob"),
+	}
+	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, mockValues, nil)
 
 	// Mock the Delete method to delete the blob.
 	mockClient.EXPECT().Delete(context.Background(), mockKeys[1]).Return(nil)
@@ -392,10 +408,13 @@ func TestHandlePUT(t *testing.T) {
 		[]byte("blob:2"),
 		[]byte("blob:3"),
 	}
-	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, nil)
-
-	// Mock the Get method to return the old value for the key "blob:1".
-	mockClient.EXPECT().Get(context.Background(), mockKeys[0]).Return([]byte("oldValue"), nil)
+	// "blob:1" holds the old value. The same scan also shows that no other blob holds "newValue".
+	mockValues := [][]byte{
+		[]byte("oldValue"),
+		[]byte("two"),
+		[]byte("three"),
+	}
+	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, mockValues, nil).Times(2)
 
 	// Mock the Put method to update the blob for the key "blob:1".
 	mockClient.EXPECT().Put(context.Background(), mockKeys[0], []byte("newValue")).Return(nil)
@@ -433,10 +452,13 @@ func TestPutErrorHandlePUT(t *testing.T) {
 		[]byte("blob:2"),
 		[]byte("blob:3"),
 	}
-	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, nil)
-
-	// Mock the Get method to return the old value for the key "blob:1".
-	mockClient.EXPECT().Get(context.Background(), mockKeys[0]).Return([]byte("oldValue"), nil)
+	// "blob:1" holds the old value. The same scan also shows that no other blob holds "newValue".
+	mockValues := [][]byte{
+		[]byte("oldValue"),
+		[]byte("two"),
+		[]byte("three"),
+	}
+	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, mockValues, nil).Times(2)
 
 	// Mock the Put method to update the blob for the key "blob:1".
 	mockClient.EXPECT().Put(context.Background(), mockKeys[0], []byte("newValue")).Return(errors.New("Failed to update blob"))
@@ -466,10 +488,9 @@ func TestMatchErrorHandlePUT(t *testing.T) {
 	mockKeys := [][]byte{
 		[]byte("blob:1"),
 	}
-	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, nil)
+	// The only blob holds a different value than the old one.
+	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, [][]byte{[]byte("oldestValue")}, nil)
 
-	// Mock the Get method to return the old value for the key "blob:1".
-	mockClient.EXPECT().Get(context.Background(), mockKeys[0]).Return([]byte("oldestValue"), nil)
 	// Handle the request.
 	handlePUT(w, req, mockClient)
 
@@ -477,34 +498,6 @@ func TestMatchErrorHandlePUT(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
 }
 
-func TestGetErrorHandlePUT(t *testing.T) {
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
-
-	// Create a mock response writer.
-	w := httptest.NewRecorder()
-
-	// Create a mock client.
-	mockClient := NewMockRawKVClientInterface(ctrl)
-
-	// Mock request with oldBlob and newBlob query parameters.
-	req, err := http.NewRequest("PUT", "/oldValue?newBlob=newValue", nil)
-	assert.NoError(t, err)
-
-	// Mock the Scan method to return a slice of keys.
-	mockKeys := [][]byte{
-		[]byte("blob:1"),
-	}
-	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, nil)
-
-	// Mock the Get method to return the old value for the key "blob:1".
-	mockClient.EXPECT().Get(context.Background(), mockKeys[0]).Return([]byte("oldestValue"), errors.New("Failed to get blob"))
-	// Handle the request.
-	handlePUT(w, req, mockClient)
-
-	// Assert that the response status code is 200.
-	assert.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
-}
 func TestScanErrorHandlePUT(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -523,7 +516,7 @@ func TestScanErrorHandlePUT(t *testing.T) {
 	mockKeys := [][]byte{
 		[]byte("blob:1"),
 	}
-	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, errors.New("Failed to scan"))
+	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, nil, errors.New("Failed to scan"))
 
 	// Handle the request.
 	handlePUT(w, req, mockClient)
@@ -598,8 +591,8 @@ func TestInvalidRequestMethod(t *testing.T) {
 	// Assert that the response status code is 405.
 	assert.Equal(t, http.StatusMethodNotAllowed, w.Result().StatusCode)
 
-	// Assert that the response body contains an error message.
-	assert.Contains(t, w.Body.String(), "Invalid request method")
+	// Assert that the response body is the error message.
+	assert.Equal(t, `{"error":"Invalid request method"}`, w.Body.String())
 }
 
 func TestCountBlobs(t *testing.T) {
@@ -615,14 +608,14 @@ func TestCountBlobs(t *testing.T) {
 		[]byte("blob:2"),
 		[]byte("blob:3"),
 	}
-	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, nil)
+	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, nil, nil)
 
 	// Replace the global clientPool with a channel that returns the mock client
 	clientPool = make(chan RawKVClientInterface, 1)
 	clientPool <- mockClient
 
 	// Call the function
-	count := countBlobs(mockClient)
+	count, _ := countBlobs(mockClient)
 
 	// Check the result
 	if count != len(mockKeys) {
@@ -643,14 +636,14 @@ func TestCountBlobsScanError(t *testing.T) {
 		[]byte("blob:2"),
 		[]byte("blob:3"),
 	}
-	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, errors.New("Failed to scan"))
+	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, nil, errors.New("Failed to scan"))
 
 	// Replace the global clientPool with a channel that returns the mock client
 	clientPool = make(chan RawKVClientInterface, 1)
 	clientPool <- mockClient
 
 	// Call the function
-	count := countBlobs(mockClient)
+	count, _ := countBlobs(mockClient)
 
 	// Check the result
 	if count != -1 {
@@ -663,7 +656,7 @@ func TestCountBlobsClientError(t *testing.T) {
 	defer ctrl.Finish()
 
 	// Call the function
-	count := countBlobs(nil)
+	count, _ := countBlobs(nil)
 
 	// Check the result
 	if count != -1 {
@@ -707,6 +700,71 @@ func TestSetupServer_ClientPoolParameterIsFull(t *testing.T) {
 	assert.NotNil(t, mux)
 }
 
+// newHTTPServer applies the configured connection timeouts
+func TestNewHTTPServerAppliesTimeouts(t *testing.T) {
+	defer func(header, read, write, idle time.Duration) {
+		serverReadHeaderTimeout, serverReadTimeout, serverWriteTimeout, serverIdleTimeout = header, read, write, idle
+	}(serverReadHeaderTimeout, serverReadTimeout, serverWriteTimeout, serverIdleTimeout)
+	serverReadHeaderTimeout = 2 * time.Second
+	serverReadTimeout = 10 * time.Second
+	serverWriteTimeout = 15 * time.Second
+	serverIdleTimeout = time.Minute
+
+	handler := setupServer(nil)
+	server := newHTTPServer(":8080", handler)
+
+	assert.Equal(t, ":8080", server.Addr)
+	assert.Equal(t, handler, server.Handler)
+	assert.Equal(t, 2*time.Second, server.ReadHeaderTimeout)
+	assert.Equal(t, 10*time.Second, server.ReadTimeout)
+	assert.Equal(t, 15*time.Second, server.WriteTimeout)
+	assert.Equal(t, time.Minute, server.IdleTimeout)
+}
+
+// The server has connection timeouts by default
+func TestNewHTTPServerDefaultTimeouts(t *testing.T) {
+	server := newHTTPServer(":8080", setupServer(nil))
+
+	assert.NotZero(t, server.ReadHeaderTimeout)
+	assert.NotZero(t, server.ReadTimeout)
+	assert.NotZero(t, server.WriteTimeout)
+	assert.NotZero(t, server.IdleTimeout)
+}
+
+// With ENABLE_H2C an HTTP/2 prior-knowledge client completes a request, and HTTP/1.1 still works
+func TestNewHTTPServerH2C(t *testing.T) {
+	defer func(old bool) { enableH2C = old }(enableH2C)
+	enableH2C = true
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Proto)
+	})
+	server := newHTTPServer("", handler)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go server.Serve(lis)
+	defer server.Close()
+	url := "http://" + lis.Addr().String() + "/"
+
+	h2 := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	resp, err := h2.Get(url)
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, 2, resp.ProtoMajor)
+	assert.Equal(t, "HTTP/2.0", string(body))
+
+	resp, err = http.Get(url)
+	assert.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "HTTP/1.1", string(body))
+}
+
 ////////////////////////////////////////////////////////////////
 
 // Use mock client if useMock is true
@@ -783,7 +841,7 @@ func TestHandlePOSTReturnsErrorIfNoBlobProvided(t *testing.T) {
 
 	// Assert that the response writer received the correct response
 	assert.Equal(t, http.StatusBadRequest, w.Code)
-	assert.Equal(t, "No blob provided\n", w.Body.String())
+	assert.Equal(t, `{"error":"No blob provided"}`, w.Body.String())
 }
 
 // handleDELETE returns an error if no blob is provided
@@ -800,7 +858,7 @@ func TestHandleDELETEReturnsErrorIfNoBlobProvided(t *testing.T) {
 
 	// Assert that the response writer received the correct response
 	assert.Equal(t, http.StatusBadRequest, w.Code)
-	assert.Equal(t, "No blob provided\n", w.Body.String())
+	assert.Equal(t, `{"error":"No blob provided"}`, w.Body.String())
 }
 
 ////////////////////////////////////////////////////////////////
@@ -1011,7 +1069,7 @@ func TestValidGetRequest(t *testing.T) {
 	mockClient.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]byte("randomValue"), nil).AnyTimes()
 
 	// Mock the Scan method for the GET request.
-	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, nil)
+	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, nil, nil)
 
 	// Create a mock response writer.
 	w := httptest.NewRecorder()
@@ -1048,10 +1106,7 @@ func TestValidPostRequest(t *testing.T) {
 		[]byte("blob:3"),
 	}
 
-	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, nil)
-
-	// Mock the Get method to return different values for each key to simulate that the blob doesn't exist.
-	mockClient.EXPECT().Get(context.Background(), gomock.Any()).Return([]byte("notPostMe"), nil).AnyTimes()
+	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, repeatValue("notPostMe", len(mockKeys)), nil)
 
 	expectedBlobForPost := "postBlobValue"
 	// Mock the Put method to save the blob.
@@ -1092,45 +1147,7 @@ func TestErrorScanPostRequest(t *testing.T) {
 		[]byte("blob:3"),
 	}
 
-	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, errors.New("failed to retrieve blobs"))
-
-	// Create a mock response writer.
-	w := httptest.NewRecorder()
-
-	// Mock request with HTTP POST method.
-	req, err := http.NewRequest(http.MethodPost, "/?blob=postBlobValue", nil)
-	assert.NoError(t, err)
-
-	// Handle the request.
-	handleRequest(w, req, clientPool)
-
-	// Assert that the response status code is 200.
-	assert.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
-}
-
-func TestErrorFetchPostRequest(t *testing.T) {
-	// Create a mock controller
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
-
-	// Create the mock client using the mock controller
-	mockClient := NewMockRawKVClientInterface(ctrl)
-
-	// Mock client pool.
-	clientPool := make(chan RawKVClientInterface, 1)
-	clientPool <- mockClient
-	defer close(clientPool)
-
-	// Mock the Scan method to return a slice of keys.
-	mockKeys := [][]byte{
-		[]byte("blob:1"),
-		[]byte("blob:2"),
-		[]byte("blob:3"),
-	}
-
-	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, nil)
-	// Mock the Get method to return different values for each key to simulate that the blob doesn't exist.
-	mockClient.EXPECT().Get(context.Background(), gomock.Any()).Return([]byte("notPostMe"), errors.New("failed to retrieve blob")).AnyTimes()
+	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, nil, errors.New("failed to retrieve blobs"))
 
 	// Create a mock response writer.
 	w := httptest.NewRecorder()
@@ -1166,9 +1183,7 @@ func TestErrorDuplicatePostRequest(t *testing.T) {
 		[]byte("blob:3"),
 	}
 
-	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, nil)
-	// Mock the Get method to return different values for each key to simulate that the blob doesn't exist.
-	mockClient.EXPECT().Get(context.Background(), gomock.Any()).Return([]byte("postBlobValue"), nil).AnyTimes()
+	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, repeatValue("postBlobValue", len(mockKeys)), nil)
 
 	// Create a mock response writer.
 	w := httptest.NewRecorder()
@@ -1204,10 +1219,7 @@ func TestErrorPostRequest(t *testing.T) {
 		[]byte("blob:3"),
 	}
 
-	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, nil)
-
-	// Mock the Get method to return different values for each key to simulate that the blob doesn't exist.
-	mockClient.EXPECT().Get(context.Background(), gomock.Any()).Return([]byte("notPostMe"), nil).AnyTimes()
+	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, repeatValue("notPostMe", len(mockKeys)), nil)
 
 	expectedBlobForPost := "postBlobValue"
 	// Mock the Put method to save the blob.
@@ -1248,18 +1260,13 @@ func TestValidDeleteRequest(t *testing.T) {
 		[]byte("blob:2"),
 		[]byte("blob:3"),
 	}
-	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, nil)
-
-	// Mock the Get method for each key.
-	// For the first key, return a blob that doesn't match the one in the request.
-	mockClient.EXPECT().Get(context.Background(), mockKeys[0]).Return([]byte("notTheBlobToDelete"), nil)
-
-	// For the second key, return the blob that matches the one in the request.
-	mockClient.EXPECT().Get(context.Background(), mockKeys[1]).Return([]byte("deleteMe"), nil)
-
-	// For the third key, return another blob that doesn't match the one in the request.
-	// This expectation might not be called, so we use AnyTimes().
-	mockClient.EXPECT().Get(context.Background(), mockKeys[2]).Return([]byte("anotherBlob"), nil).AnyTimes()
+	// The scan returns each key's value, and the second one matches the blob to delete.
+	mockValues := [][]byte{
+		[]byte("notTheBlobToDelete"),
+		[]byte("deleteMe"),
+		[]byte("anotherBlob"),
+	}
+	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, mockValues, nil)
 
 	// Mock the Delete method to delete the blob.
 	mockClient.EXPECT().Delete(context.Background(), mockKeys[1]).Return(nil)
@@ -1297,18 +1304,13 @@ func TestInvalidDeleteRequest(t *testing.T) {
 		[]byte("blob:2"),
 		[]byte("blob:3"),
 	}
-	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, nil)
-
-	// Mock the Get method for each key.
-	// For the first key, return a blob that doesn't match the one in the request.
-	mockClient.EXPECT().Get(context.Background(), mockKeys[0]).Return([]byte("notTheBlobToDelete"), nil)
-
-	// For the second key, return the blob that matches the one in the request.
-	mockClient.EXPECT().Get(context.Background(), mockKeys[1]).Return([]byte("deleteMe"), nil)
-
-	// For the third key, return another blob that doesn't match the one in the request.
-	// This expectation might not be called, so we use AnyTimes().
-	mockClient.EXPECT().Get(context.Background(), mockKeys[2]).Return([]byte("anotherBlob"), nil).AnyTimes()
+	// The scan returns each key's value, and the second one matches the blob to delete.
+	mockValues := [][]byte{
+		[]byte("notTheBlobToDelete"),
+		[]byte("deleteMe"),
+		[]byte("anotherBlob"),
+	}
+	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, mockValues, nil)
 
 	// Create a mock response writer.
 	w := httptest.NewRecorder()
@@ -1343,46 +1345,7 @@ func TestScanErrorDeleteRequest(t *testing.T) {
 		[]byte("blob:2"),
 		[]byte("blob:3"),
 	}
-	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, errors.New("failed to retrieve blobs"))
-
-	// Create a mock response writer.
-	w := httptest.NewRecorder()
-
-	// Mock request with HTTP DELETE method.
-	req, err := http.NewRequest(http.MethodDelete, "/?blob=deleteMe", nil)
-	assert.NoError(t, err)
-
-	// Handle the request.
-	handleRequest(w, req, clientPool)
-
-	// Assert that the response status code is 200.
-	assert.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
-}
-
-func TestGetErrorDeleteRequest(t *testing.T) {
-	// Create a mock controller
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
-
-	// Create the mock client using the mock controller
-	mockClient := NewMockRawKVClientInterface(ctrl)
-
-	// Mock client pool.
-	clientPool := make(chan RawKVClientInterface, 1)
-	clientPool <- mockClient
-	defer close(clientPool)
-
-	// Mock the Scan method to return a slice of keys.
-	mockKeys := [][]byte{
-		[]byte("blob:1"),
-		[]byte("blob:2"),
-		[]byte("blob:3"),
-	}
-	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, nil)
-
-	// Mock the Get method for each key.
-	// For the first key, return a blob that doesn't match the one in the request.
-	mockClient.EXPECT().Get(context.Background(), mockKeys[0]).Return([]byte("notTheBlobToDelete"), errors.New("Failed to retrieve blob"))
+	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, nil, errors.New("failed to retrieve blobs"))
 
 	// Create a mock response writer.
 	w := httptest.NewRecorder()
@@ -1417,18 +1380,13 @@ func TestDeleteErrorDeleteRequest(t *testing.T) {
 		[]byte("blob:2"),
 		[]byte("blob:3"),
 	}
-	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, nil)
-
-	// Mock the Get method for each key.
-	// For the first key, return a blob that doesn't match the one in the request.
-	mockClient.EXPECT().Get(context.Background(), mockKeys[0]).Return([]byte("notTheBlobToDelete"), nil)
-
-	// For the second key, return the blob that matches the one in the request.
-	mockClient.EXPECT().Get(context.Background(), mockKeys[1]).Return([]byte("deleteMe"), nil)
-
-	// For the third key, return another blob that doesn't match the one in the request.
-	// This expectation might not be called, so we use AnyTimes().
-	mockClient.EXPECT().Get(context.Background(), mockKeys[2]).Return([]byte("anotherBlob"), nil).AnyTimes()
+	// The scan returns each key's value, and the second one matches the blob to delete.
+	mockValues := [][]byte{
+		[]byte("notTheBlobToDelete"),
+		[]byte("deleteMe"),
+		[]byte("anotherBlob"),
+	}
+	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, mockValues, nil)
 
 	// Mock the Delete method to delete the blob.
 	mockClient.EXPECT().Delete(context.Background(), mockKeys[1]).Return(errors.New("Failed to retrieve blob"))
@@ -1456,6 +1414,8 @@ func TestEmptyClientPool(t *testing.T) {
 	// Mock client pool.
 	clientPool := make(chan RawKVClientInterface, 1)
 	defer close(clientPool)
+	defer func(old time.Duration) { poolAcquireTimeout = old }(poolAcquireTimeout)
+	poolAcquireTimeout = 10 * time.Millisecond
 
 	// Create a mock response writer.
 	w := httptest.NewRecorder()
@@ -1467,8 +1427,8 @@ func TestEmptyClientPool(t *testing.T) {
 	// Handle the request.
 	handleRequest(w, req, clientPool)
 
-	// Assert that the response status code is 500 (Internal Server Error).
-	assert.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
+	// Assert that the response status code is 503 (Service Unavailable).
+	assert.Equal(t, http.StatusServiceUnavailable, w.Result().StatusCode)
 }
 
 // TODO: Invalid clientPool
@@ -1498,7 +1458,7 @@ func TestInvalidGetRequest(t *testing.T) {
 	mockClient.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil, errors.New("Error getting value")).AnyTimes()
 
 	// Mock the Scan method for the GET request.
-	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, nil)
+	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, nil, nil)
 
 	// Create a mock response writer.
 	w := httptest.NewRecorder()
@@ -1587,13 +1547,8 @@ func TestHandleGETAllError(t *testing.T) {
 	// Create a mock client.
 	mockClient := NewMockRawKVClientInterface(ctrl)
 
-	// Set up a common expectation for the Scan method
-	mockKeys := [][]byte{[]byte("key1"), []byte("key2")}
-	mockClient.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(mockKeys, nil, nil).AnyTimes()
-
-	// Set up an expectation for the Get method for the "all" action
-	mockValue := []byte("value1")
-	mockClient.EXPECT().Get(gomock.Any(), gomock.Eq(mockKeys[0])).Return(mockValue, errors.New("blob not found")).AnyTimes()
+	// The values come with the scan, so a failing scan is the only way listing can fail.
+	mockClient.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil, errors.New("scan failed"))
 
 	// Create a mock response writer.
 	w := httptest.NewRecorder()
@@ -1768,7 +1723,7 @@ func TestHandleGET_ValidRequestMethod(t *testing.T) {
 	mockClient.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]byte("randomValue"), nil).AnyTimes()
 
 	// Mock the Scan method for the GET request.
-	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob:~"), 100).Return(mockKeys, nil, nil)
+	mockClient.EXPECT().Scan(context.Background(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, nil, nil)
 	// Create a mock response writer.
 	w := httptest.NewRecorder()
 
@@ -2174,7 +2129,7 @@ func TestSaveBlobWithEmptyString(t *testing.T) {
 	}
 
 	// Check the response body
-	expectedBody := "No blob provided\n"
+	expectedBody := `{"error":"No blob provided"}`
 	if rr.Body.String() != expectedBody {
 		t.Errorf("Expected response body %q, got %q", expectedBody, rr.Body.String())
 	}
@@ -2186,7 +2141,7 @@ func TestGetAllScanError(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockClient := NewMockRawKVClientInterface(ctrl)
-	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob:~"), 100).Return(nil, nil, errors.New("failed to retrieve blobs"))
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 100).Return(nil, nil, errors.New("failed to retrieve blobs"))
 
 	req, err := http.NewRequest(http.MethodGet, "/all", nil)
 	if err != nil {
@@ -2198,5 +2153,2323 @@ func TestGetAllScanError(t *testing.T) {
 	handleGETAll(w, req, mockClient)
 
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
-	assert.Equal(t, "Failed to retrieve blobs\n", w.Body.String())
+	assert.Equal(t, `{"error":"Failed to retrieve blobs"}`, w.Body.String())
+}
+
+////////////////////////////////////////////////////////////////
+/// test whitespace normalization in duplicate detection
+////////////////////////////////////////////////////////////////
+
+// Whitespace variants collide when normalization is enabled
+func TestHandlePOSTNormalizeWhitespaceDetectsDuplicate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	normalizeWhitespace = true
+	defer func() { normalizeWhitespace = false }()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockKeys := [][]byte{[]byte("blob:1")}
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, repeatValue("hello   world", 1), nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/?blob=%20hello%20world%20%20", nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+
+	handlePOST(w, req, mockClient)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+// Whitespace variants are distinct blobs when normalization is disabled
+func TestHandlePOSTWithoutNormalizeWhitespaceStoresVariant(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockKeys := [][]byte{[]byte("blob:1")}
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, [][]byte{[]byte("hello   world")}, nil)
+	mockClient.EXPECT().Put(gomock.Any(), gomock.Any(), []byte(" hello world  ")).Return(nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/?blob=%20hello%20world%20%20", nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+
+	handlePOST(w, req, mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// The original value is stored even when normalization is enabled
+func TestHandlePOSTNormalizeWhitespaceStoresOriginal(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	normalizeWhitespace = true
+	defer func() { normalizeWhitespace = false }()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockKeys := [][]byte{[]byte("blob:1")}
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, [][]byte{[]byte("something else")}, nil)
+	mockClient.EXPECT().Put(gomock.Any(), gomock.Any(), []byte(" hello\tworld ")).Return(nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/?blob=%20hello%09world%20", nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+
+	handlePOST(w, req, mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+////////////////////////////////////////////////////////////////
+/// test retries header
+////////////////////////////////////////////////////////////////
+
+// The retries header reports how many transient failures were retried
+func TestHandleRequestReportsRetriesHeader(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	wrapper := &RawKVClientWrapper{client: mockClient, maxRetries: 3}
+
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- wrapper
+
+	mockKeys := [][]byte{[]byte("blob:1")}
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, nil, nil)
+	gomock.InOrder(
+		mockClient.EXPECT().Get(gomock.Any(), mockKeys[0]).Return(nil, errors.New("region unavailable")).Times(2),
+		mockClient.EXPECT().Get(gomock.Any(), mockKeys[0]).Return([]byte("value1"), nil),
+	)
+
+	req, err := http.NewRequest(http.MethodGet, "/", nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+
+	handleRequest(w, req, clientPool)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get(RetriesHeader))
+}
+
+// The retries header is zero when nothing was retried, including on errors
+func TestHandleRequestReportsZeroRetries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- NewRawKVClientWrapper(mockClient)
+
+	req, err := http.NewRequest(http.MethodPost, "/", nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+
+	handleRequest(w, req, clientPool)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "0", w.Header().Get(RetriesHeader))
+}
+
+////////////////////////////////////////////////////////////////
+/// test runSelfCheck
+////////////////////////////////////////////////////////////////
+
+// Self-check succeeds when the sentinel round-trips
+func TestRunSelfCheckSucceeds(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- mockClient
+
+	var sentinel []byte
+	mockClient.EXPECT().Put(gomock.Any(), gomock.Any(), []byte("ok")).DoAndReturn(
+		func(ctx context.Context, key, value []byte, options ...interface{}) error {
+			sentinel = key
+			return nil
+		})
+	mockClient.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]byte("ok"), nil)
+	mockClient.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(nil)
+
+	err := runSelfCheck(clientPool)
+
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(sentinel), "selfcheck:"))
+	assert.Equal(t, 1, len(clientPool))
+}
+
+// Self-check reports a failed write and skips the remaining steps
+func TestRunSelfCheckWriteFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- mockClient
+
+	mockClient.EXPECT().Put(gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("permission denied"))
+
+	err := runSelfCheck(clientPool)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "write sentinel key")
+	assert.Equal(t, 1, len(clientPool))
+}
+
+// Self-check fails when the pool is empty
+func TestRunSelfCheckEmptyPool(t *testing.T) {
+	defer func(old time.Duration) { poolAcquireTimeout = old }(poolAcquireTimeout)
+	poolAcquireTimeout = 10 * time.Millisecond
+	err := runSelfCheck(make(chan RawKVClientInterface, 1))
+
+	assert.Error(t, err)
+}
+
+////////////////////////////////////////////////////////////////
+/// test /blobs/{id}/exists
+////////////////////////////////////////////////////////////////
+
+// An existing id reports exists=true
+func TestBlobExistsForExistingID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- mockClient
+
+	mockClient.EXPECT().Get(gomock.Any(), []byte("blob:1699999999")).Return([]byte("hello"), nil)
+
+	server := httptest.NewServer(setupServer(clientPool))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/blobs/1699999999/exists")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var body map[string]bool
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, map[string]bool{"exists": true}, body)
+}
+
+// A missing id reports exists=false with status 200
+func TestBlobExistsForMissingID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- mockClient
+
+	mockClient.EXPECT().Get(gomock.Any(), []byte("blob:missing")).Return(nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/blobs/missing/exists", nil)
+	w := httptest.NewRecorder()
+
+	handleBlobRequest(w, req, clientPool)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"exists":false}`, w.Body.String())
+}
+
+// Lookup errors surface as a 500
+func TestBlobExistsGetError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- mockClient
+
+	mockClient.EXPECT().Get(gomock.Any(), []byte("blob:1")).Return(nil, errors.New("tikv unavailable"))
+
+	req := httptest.NewRequest(http.MethodGet, "/blobs/1/exists", nil)
+	w := httptest.NewRecorder()
+
+	handleBlobRequest(w, req, clientPool)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+// Only GET is allowed on the exists endpoint
+func TestBlobExistsRejectsOtherMethods(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- NewMockRawKVClientInterface(ctrl)
+
+	req := httptest.NewRequest(http.MethodPost, "/blobs/1/exists", nil)
+	w := httptest.NewRecorder()
+
+	handleBlobRequest(w, req, clientPool)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+////////////////////////////////////////////////////////////////
+/// test MAX_ALL_RESULTS
+////////////////////////////////////////////////////////////////
+
+// /all stops at the cap and returns a cursor for the remaining blobs
+func TestHandleGETAllTruncatesAtMaxAllResults(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	maxAllResults = 2
+	defer func() { maxAllResults = 0 }()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockKeys := [][]byte{[]byte("blob:1"), []byte("blob:2"), []byte("blob:3")}
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 3).Return(mockKeys, [][]byte{[]byte("one"), []byte("two"), []byte("three")}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/all", nil)
+	w := httptest.NewRecorder()
+
+	handleGETAll(w, req, mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Blobs     []string `json:"blobs"`
+		Truncated bool     `json:"truncated"`
+		Cursor    string   `json:"cursor"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []string{"one", "two"}, resp.Blobs)
+	assert.True(t, resp.Truncated)
+	assert.Equal(t, "blob:3", resp.Cursor)
+}
+
+// Following the cursor returns the rest without a truncation flag
+func TestHandleGETAllContinuesFromCursor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	maxAllResults = 2
+	defer func() { maxAllResults = 0 }()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockKeys := [][]byte{[]byte("blob:3")}
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:3"), []byte("blob;"), 3).Return(mockKeys, [][]byte{[]byte("three")}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/all?cursor=blob:3", nil)
+	w := httptest.NewRecorder()
+
+	handleGETAll(w, req, mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"blobs":["three"]}`, w.Body.String())
+}
+
+// Cursors outside the blob keyspace are rejected
+func TestHandleGETAllRejectsInvalidCursor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	req := httptest.NewRequest(http.MethodGet, "/all?cursor=meta:count", nil)
+	w := httptest.NewRecorder()
+
+	handleGETAll(w, req, NewMockRawKVClientInterface(ctrl))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+////////////////////////////////////////////////////////////////
+/// test PD failover
+////////////////////////////////////////////////////////////////
+
+// fakeClientFactory replaces newTiKVClient for the duration of a test.
+// Creation fails for any address set listed in failing, and every call is recorded.
+func fakeClientFactory(t *testing.T, failing ...string) *[]string {
+	calls := &[]string{}
+	original := newTiKVClient
+	newTiKVClient = func(addrs []string) (RawKVClientInterface, error) {
+		joined := strings.Join(addrs, ",")
+		*calls = append(*calls, joined)
+		for _, f := range failing {
+			if f == joined {
+				return nil, fmt.Errorf("cannot reach %s", joined)
+			}
+		}
+		return NewMockRawKVClientInterface(nil), nil
+	}
+	t.Cleanup(func() { newTiKVClient = original })
+	return calls
+}
+
+// A primary failure makes the pool create clients against the secondary
+func TestSetupClientPoolFailsOverToSecondary(t *testing.T) {
+	originalPrimary, originalSecondary := pdAddrs, secondaryPDAddrs
+	defer func() { pdAddrs, secondaryPDAddrs = originalPrimary, originalSecondary }()
+	pdAddrs = []string{"primary:2379"}
+	secondaryPDAddrs = []string{"standby-1:2379", "standby-2:2379"}
+	calls := fakeClientFactory(t, "primary:2379")
+
+	clientPool := setupClientPool(false)
+
+	assert.Equal(t, ClientPoolSize, len(clientPool))
+	assert.Equal(t, "primary:2379", (*calls)[0])
+	for _, call := range (*calls)[1:] {
+		assert.Equal(t, "standby-1:2379,standby-2:2379", call)
+	}
+	assert.Equal(t, secondaryPDAddrs, activePDAddrs)
+}
+
+// Without failures every client is created against the primary
+func TestSetupClientPoolUsesPrimary(t *testing.T) {
+	originalPrimary, originalSecondary := pdAddrs, secondaryPDAddrs
+	defer func() { pdAddrs, secondaryPDAddrs = originalPrimary, originalSecondary }()
+	pdAddrs = []string{"primary:2379"}
+	secondaryPDAddrs = []string{"standby:2379"}
+	calls := fakeClientFactory(t)
+
+	clientPool := setupClientPool(false)
+
+	assert.Equal(t, ClientPoolSize, len(clientPool))
+	assert.Equal(t, ClientPoolSize, len(*calls))
+	for _, call := range *calls {
+		assert.Equal(t, "primary:2379", call)
+	}
+}
+
+// Without a secondary the primary error is returned as is
+func TestCreateClientWithoutSecondary(t *testing.T) {
+	originalActive, originalSecondary := activePDAddrs, secondaryPDAddrs
+	defer func() { activePDAddrs, secondaryPDAddrs = originalActive, originalSecondary }()
+	activePDAddrs = []string{"primary:2379"}
+	secondaryPDAddrs = nil
+	calls := fakeClientFactory(t, "primary:2379")
+
+	client, err := createClient()
+
+	assert.Error(t, err)
+	assert.Nil(t, client)
+	assert.Equal(t, []string{"primary:2379"}, *calls)
+}
+
+////////////////////////////////////////////////////////////////
+/// test BLOB_FIELD_NAME
+////////////////////////////////////////////////////////////////
+
+// POST reads and echoes the blob under the configured field name
+func TestHandlePOSTHonorsBlobFieldName(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	blobFieldName = "content"
+	defer func() { blobFieldName = "blob" }()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 100).Return(nil, nil, nil)
+	mockClient.EXPECT().Put(gomock.Any(), gomock.Any(), []byte("hello")).Return(nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/?content=hello", nil)
+	w := httptest.NewRecorder()
+
+	handlePOST(w, req, mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"content":"hello"}`, w.Body.String())
+}
+
+// The default field name is no longer accepted once another is configured
+func TestHandlePOSTIgnoresDefaultFieldNameWhenConfigured(t *testing.T) {
+	blobFieldName = "content"
+	defer func() { blobFieldName = "blob" }()
+
+	req := httptest.NewRequest(http.MethodPost, "/?blob=hello", nil)
+	w := httptest.NewRecorder()
+
+	handlePOST(w, req, NewMockRawKVClientInterface(nil))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// PUT and random GET responses use the configured field name
+func TestResponsesHonorBlobFieldName(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	blobFieldName = "value"
+	defer func() { blobFieldName = "blob" }()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockKeys := [][]byte{[]byte("blob:1")}
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, repeatValue("old", 1), nil).Times(3)
+	mockClient.EXPECT().Get(gomock.Any(), mockKeys[0]).Return([]byte("old"), nil)
+	mockClient.EXPECT().Put(gomock.Any(), mockKeys[0], []byte("new")).Return(nil)
+
+	w := httptest.NewRecorder()
+	handlePUT(w, httptest.NewRequest(http.MethodPut, "/old?newBlob=new", nil), mockClient)
+	assert.Equal(t, `{"value":"new"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handleGETRandom(w, httptest.NewRequest(http.MethodGet, "/", nil), mockClient)
+	assert.Equal(t, `{"value":"old"}`, w.Body.String())
+}
+
+////////////////////////////////////////////////////////////////
+/// test response body format
+////////////////////////////////////////////////////////////////
+
+// Success and error bodies are compact JSON without a trailing newline
+func TestResponseBodiesAreByteExact(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockKeys := [][]byte{[]byte("blob:1"), []byte("blob:2")}
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, [][]byte{[]byte("one"), []byte("two")}, nil).AnyTimes()
+
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- mockClient
+
+	tests := []struct {
+		method   string
+		target   string
+		status   int
+		expected string
+	}{
+		{http.MethodGet, "/count", http.StatusOK, `{"count":2}`},
+		{http.MethodGet, "/all", http.StatusOK, `{"blobs":["one","two"]}`},
+		{http.MethodPost, "/?blob=one", http.StatusConflict, `{"error":"Blob already exists","id":"1"}`},
+		{http.MethodDelete, "/?blob=three", http.StatusNotFound, `{"error":"Blob not found"}`},
+		{http.MethodPut, "/?newBlob=two", http.StatusBadRequest, `{"error":"No old blob provided"}`},
+		{http.MethodPatch, "/", http.StatusMethodNotAllowed, `{"error":"Invalid request method"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.method+" "+test.target, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handleRequest(w, httptest.NewRequest(test.method, test.target, nil), clientPool)
+
+			assert.Equal(t, test.status, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			assert.Equal(t, test.expected, w.Body.String())
+		})
+	}
+}
+
+// An empty pool is reported in the same format
+func TestEmptyPoolResponseBodyIsByteExact(t *testing.T) {
+	defer func(old time.Duration) { poolAcquireTimeout = old }(poolAcquireTimeout)
+	poolAcquireTimeout = 10 * time.Millisecond
+	w := httptest.NewRecorder()
+	handleRequest(w, httptest.NewRequest(http.MethodGet, "/", nil), make(chan RawKVClientInterface, 1))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, `{"error":"No TiKV client available"}`, w.Body.String())
+}
+
+////////////////////////////////////////////////////////////////
+/// test duplicate POST pointing at the existing blob
+////////////////////////////////////////////////////////////////
+
+// A duplicate POST responds 409 with the existing id and its location
+func TestHandlePOSTConflictReturnsExistingID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockKeys := [][]byte{[]byte("blob:1699999999000000001"), []byte("blob:1699999999000000002")}
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, [][]byte{[]byte("other"), []byte("postMe")}, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/?blob=postMe", nil)
+	w := httptest.NewRecorder()
+
+	handlePOST(w, req, mockClient)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "/blobs/1699999999000000002", w.Header().Get("Location"))
+	var resp map[string]string
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "1699999999000000002", resp["id"])
+}
+
+// GET /blobs/{id} returns the stored blob
+func TestHandleGETByID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- mockClient
+
+	mockClient.EXPECT().Get(gomock.Any(), []byte("blob:42")).Return([]byte("hello"), nil)
+
+	w := httptest.NewRecorder()
+	handleBlobRequest(w, httptest.NewRequest(http.MethodGet, "/blobs/42", nil), clientPool)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"blob":"hello"}`, w.Body.String())
+}
+
+// GET /blobs/{id} returns 404 for a missing id
+func TestHandleGETByIDMissing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- mockClient
+
+	mockClient.EXPECT().Get(gomock.Any(), []byte("blob:42")).Return(nil, nil)
+
+	w := httptest.NewRecorder()
+	handleBlobRequest(w, httptest.NewRequest(http.MethodGet, "/blobs/42", nil), clientPool)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+////////////////////////////////////////////////////////////////
+/// test per-operation timeouts
+////////////////////////////////////////////////////////////////
+
+// A slow scan is cut off by the scan timeout while Put gets the write timeout
+func TestOperationTimeouts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	readTimeout, writeTimeout, scanTimeout = time.Second, 2*time.Second, 50*time.Millisecond
+	defer func() { readTimeout, writeTimeout, scanTimeout = 0, 0, 0 }()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- mockClient
+
+	// The scan blocks until its context expires.
+	var scanDeadline time.Time
+	mockClient.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, startKey, endKey []byte, limit int, options ...interface{}) ([][]byte, [][]byte, error) {
+			scanDeadline, _ = ctx.Deadline()
+			<-ctx.Done()
+			return nil, nil, ctx.Err()
+		})
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	handleRequest(w, httptest.NewRequest(http.MethodGet, "/all", nil), clientPool)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.WithinDuration(t, start.Add(scanTimeout), scanDeadline, 40*time.Millisecond)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// The Put returns straight away, with a deadline set from the write timeout.
+	var putDeadline time.Time
+	mockClient.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil, nil)
+	mockClient.EXPECT().Put(gomock.Any(), gomock.Any(), []byte("fast")).DoAndReturn(
+		func(ctx context.Context, key, value []byte, options ...interface{}) error {
+			putDeadline, _ = ctx.Deadline()
+			return nil
+		})
+
+	start = time.Now()
+	w = httptest.NewRecorder()
+	handleRequest(w, httptest.NewRequest(http.MethodPost, "/?blob=fast", nil), clientPool)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.WithinDuration(t, start.Add(writeTimeout), putDeadline, 40*time.Millisecond)
+}
+
+// Without timeouts configured the request context is passed through untouched
+func TestNoOperationTimeoutsByDefault(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- mockClient
+
+	mockClient.EXPECT().Get(gomock.Any(), []byte("blob:1")).DoAndReturn(
+		func(ctx context.Context, key []byte, options ...interface{}) ([]byte, error) {
+			_, hasDeadline := ctx.Deadline()
+			assert.False(t, hasDeadline)
+			return []byte("one"), nil
+		})
+
+	w := httptest.NewRecorder()
+	handleBlobRequest(w, httptest.NewRequest(http.MethodGet, "/blobs/1", nil), clientPool)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+////////////////////////////////////////////////////////////////
+/// test random blob deleted between scan and get
+////////////////////////////////////////////////////////////////
+
+// A key that vanished after the scan is skipped in favour of another
+func TestHandleGETRandomSkipsDeletedKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+
+	// Repeat so that the deleted key is picked first at least some of the time.
+	for i := 0; i < 10; i++ {
+		mockKeys := [][]byte{[]byte("blob:1"), []byte("blob:2")}
+		mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, nil, nil)
+		mockClient.EXPECT().Get(gomock.Any(), []byte("blob:1")).Return(nil, nil).MaxTimes(1)
+		mockClient.EXPECT().Get(gomock.Any(), []byte("blob:2")).Return([]byte("survivor"), nil)
+
+		w := httptest.NewRecorder()
+		handleGETRandom(w, httptest.NewRequest(http.MethodGet, "/", nil), mockClient)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `{"blob":"survivor"}`, w.Body.String())
+	}
+}
+
+// If every scanned key has been deleted the handler falls through to 404
+func TestHandleGETRandomAllKeysDeleted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockKeys := [][]byte{[]byte("blob:1"), []byte("blob:2")}
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, nil, nil)
+	mockClient.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil, nil).Times(2)
+
+	w := httptest.NewRecorder()
+	handleGETRandom(w, httptest.NewRequest(http.MethodGet, "/", nil), mockClient)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, `{"error":"No blobs found"}`, w.Body.String())
+}
+
+////////////////////////////////////////////////////////////////
+/// test content-addressed key scheme
+////////////////////////////////////////////////////////////////
+
+// Under the content scheme a new blob is stored under the hash of its value without scanning
+func TestHandlePOSTContentSchemeStoresUnderHash(t *testing.T) {
+	defer func(old string) { keyScheme = old }(keyScheme)
+	keyScheme = KeySchemeContent
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	key := contentKey("postMe")
+	mockClient.EXPECT().Get(gomock.Any(), key).Return(nil, nil)
+	mockClient.EXPECT().Put(gomock.Any(), key, []byte("postMe")).Return(nil)
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=postMe", nil), mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "blob:bbffb2a5315f8cb2a55ed2557d5520e4dea2e9a879a380c2aebdaccabed6fb57", string(key))
+}
+
+// Under the content scheme a duplicate POST is detected with a single Get
+func TestHandlePOSTContentSchemeDetectsDuplicate(t *testing.T) {
+	defer func(old string) { keyScheme = old }(keyScheme)
+	keyScheme = KeySchemeContent
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	key := contentKey("postMe")
+	mockClient.EXPECT().Get(gomock.Any(), key).Return([]byte("postMe"), nil)
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=postMe", nil), mockClient)
+
+	id := strings.TrimPrefix(string(key), "blob:")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "/blobs/"+id, w.Header().Get("Location"))
+	assert.Equal(t, `{"error":"Blob already exists","id":"`+id+`"}`, w.Body.String())
+}
+
+// Under the content scheme a blob is found by its value with a single Get and deleted
+func TestHandleDELETEContentSchemeLooksUpByContent(t *testing.T) {
+	defer func(old string) { keyScheme = old }(keyScheme)
+	keyScheme = KeySchemeContent
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	key := contentKey("deleteMe")
+	mockClient.EXPECT().Get(gomock.Any(), key).Return([]byte("deleteMe"), nil)
+	mockClient.EXPECT().Delete(gomock.Any(), key).Return(nil)
+
+	w := httptest.NewRecorder()
+	handleDELETE(w, httptest.NewRequest(http.MethodDelete, "/?blob=deleteMe", nil), mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// Under the content scheme an update moves the blob to the key of its new value
+func TestHandlePUTContentSchemeMovesKey(t *testing.T) {
+	defer func(old string) { keyScheme = old }(keyScheme)
+	keyScheme = KeySchemeContent
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	oldKey, newKey := contentKey("old"), contentKey("new")
+	mockClient.EXPECT().Get(gomock.Any(), oldKey).Return([]byte("old"), nil)
+	mockClient.EXPECT().Get(gomock.Any(), newKey).Return(nil, nil)
+	mockClient.EXPECT().Put(gomock.Any(), newKey, []byte("new")).Return(nil)
+	mockClient.EXPECT().Delete(gomock.Any(), oldKey).Return(nil)
+
+	w := httptest.NewRecorder()
+	handlePUT(w, httptest.NewRequest(http.MethodPut, "/old?newBlob=new", nil), mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+////////////////////////////////////////////////////////////////
+/// test LOG_ACTIONS toggle
+////////////////////////////////////////////////////////////////
+
+// With LOG_ACTIONS off the action line is not logged but errors still are
+func TestHandleGETLogActionsDisabled(t *testing.T) {
+	defer func(old bool) { logActions = old }(logActions)
+	logActions = false
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer func() {
+		log.SetOutput(os.Stderr)
+	}()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 100).Return(nil, nil, errors.New("scan failed"))
+
+	w := httptest.NewRecorder()
+	handleGET(w, httptest.NewRequest(http.MethodGet, "/", nil), mockClient)
+
+	assert.NotContains(t, buf.String(), "GET action")
+	assert.Contains(t, buf.String(), "scan failed")
+}
+
+// The action line is logged by default
+func TestHandleGETLogActionsEnabled(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer func() {
+		log.SetOutput(os.Stderr)
+	}()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 100).Return(nil, nil, nil)
+
+	w := httptest.NewRecorder()
+	handleGET(w, httptest.NewRequest(http.MethodGet, "/", nil), mockClient)
+
+	assert.Contains(t, buf.String(), "GET action: /")
+}
+
+////////////////////////////////////////////////////////////////
+/// test sorted /all
+////////////////////////////////////////////////////////////////
+
+// ?sort=value and ?sort=-value order the blobs by value in both directions
+func TestHandleGETAllSortByValue(t *testing.T) {
+	for sortOrder, expected := range map[string]string{
+		"":       `{"blobs":["pear","apple","fig"]}`,
+		"value":  `{"blobs":["apple","fig","pear"]}`,
+		"-value": `{"blobs":["pear","fig","apple"]}`,
+	} {
+		t.Run(sortOrder, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockClient, store := newMemoryClient(ctrl)
+			store["blob:1"] = "pear"
+			store["blob:2"] = "apple"
+			store["blob:3"] = "fig"
+
+			w := httptest.NewRecorder()
+			handleGETAll(w, httptest.NewRequest(http.MethodGet, "/all?sort="+sortOrder, nil), mockClient)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, expected, w.Body.String())
+		})
+	}
+}
+
+// An unknown sort order responds 400
+func TestHandleGETAllInvalidSort(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+
+	w := httptest.NewRecorder()
+	handleGETAll(w, httptest.NewRequest(http.MethodGet, "/all?sort=size", nil), mockClient)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `{"error":"Invalid sort"}`, w.Body.String())
+}
+
+////////////////////////////////////////////////////////////////
+/// test malformed URL encoding
+////////////////////////////////////////////////////////////////
+
+// A blob parameter with a malformed percent-encoding responds 400 instead of being treated as empty
+func TestMalformedBlobEncodingRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+
+	for _, tc := range []struct {
+		method  string
+		target  string
+		handler func(http.ResponseWriter, *http.Request, RawKVClientInterface)
+		message string
+	}{
+		{http.MethodPost, "/?blob=100%zz", handlePOST, "Malformed URL encoding in blob"},
+		{http.MethodDelete, "/?blob=%E", handleDELETE, "Malformed URL encoding in blob"},
+		{http.MethodPut, "/old?newBlob=50%", handlePUT, "Malformed URL encoding in newBlob"},
+	} {
+		w := httptest.NewRecorder()
+		tc.handler(w, httptest.NewRequest(tc.method, tc.target, nil), mockClient)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, tc.target)
+		assert.Equal(t, `{"error":"`+tc.message+`"}`, w.Body.String(), tc.target)
+	}
+}
+
+// Malformed pairs for other parameters do not affect the blob parameter
+func TestQueryParamIgnoresOtherMalformedPairs(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/?other=%zz&blob=a%20b", nil)
+
+	blob, err := queryParam(r, "blob")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "a b", blob)
+}
+
+////////////////////////////////////////////////////////////////
+/// test maximum query parameter length
+////////////////////////////////////////////////////////////////
+
+// A blob exactly at MAX_QUERY_PARAM_LENGTH is accepted and one byte more responds 414
+func TestBlobQueryParamLengthBoundary(t *testing.T) {
+	defer func(old int) { maxQueryParamLength = old }(maxQueryParamLength)
+	maxQueryParamLength = 16
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob="+strings.Repeat("a", 16), nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, store, 1)
+
+	w = httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob="+strings.Repeat("a", 17), nil), mockClient)
+	assert.Equal(t, http.StatusRequestURITooLong, w.Code)
+	assert.Equal(t, `{"error":"Blob too long for the URL, send it in the body of a POST /rpc call instead"}`, w.Body.String())
+	assert.Len(t, store, 1)
+}
+
+// The limit applies to the URL-encoded length
+func TestBlobQueryParamLengthCountsEncoding(t *testing.T) {
+	defer func(old int) { maxQueryParamLength = old }(maxQueryParamLength)
+	maxQueryParamLength = 16
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+
+	// Six spaces decode to 6 bytes but take 18 in the URL.
+	w := httptest.NewRecorder()
+	handleDELETE(w, httptest.NewRequest(http.MethodDelete, "/?blob="+strings.Repeat("%20", 6), nil), mockClient)
+	assert.Equal(t, http.StatusRequestURITooLong, w.Code)
+}
+
+// PUT checks both the old blob in the path and the new blob in the query
+func TestHandlePUTQueryParamLength(t *testing.T) {
+	defer func(old int) { maxQueryParamLength = old }(maxQueryParamLength)
+	maxQueryParamLength = 16
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+
+	w := httptest.NewRecorder()
+	handlePUT(w, httptest.NewRequest(http.MethodPut, "/"+strings.Repeat("o", 17)+"?newBlob=new", nil), mockClient)
+	assert.Equal(t, http.StatusRequestURITooLong, w.Code)
+
+	w = httptest.NewRecorder()
+	handlePUT(w, httptest.NewRequest(http.MethodPut, "/old?newBlob="+strings.Repeat("n", 17), nil), mockClient)
+	assert.Equal(t, http.StatusRequestURITooLong, w.Code)
+}
+
+////////////////////////////////////////////////////////////////
+/// test key partitions
+////////////////////////////////////////////////////////////////
+
+// With KEY_PARTITIONS set, new blobs are spread across shards and /all still returns every blob
+func TestKeyPartitionsSpreadWritesAndScansCoverAll(t *testing.T) {
+	defer func(old int) { keyPartitions = old }(keyPartitions)
+	keyPartitions = 4
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+
+	for i := 0; i < 40; i++ {
+		w := httptest.NewRecorder()
+		handlePOST(w, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/?blob=blob%d", i), nil), mockClient)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	shards := map[string]int{}
+	for key := range store {
+		parts := strings.Split(key, ":")
+		assert.Len(t, parts, 3, key)
+		shards[parts[1]]++
+	}
+	assert.Greater(t, len(shards), 1)
+	for shard := range shards {
+		assert.Contains(t, []string{"000", "001", "002", "003"}, shard)
+	}
+
+	w := httptest.NewRecorder()
+	handleGETAll(w, httptest.NewRequest(http.MethodGet, "/all", nil), mockClient)
+	var resp struct {
+		Blobs []string `json:"blobs"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.Blobs, 40)
+
+	w = httptest.NewRecorder()
+	handleGETCount(w, mockClient)
+	assert.Equal(t, `{"count":40}`, w.Body.String())
+}
+
+// A sharded blob can be fetched by its id, shard prefix included
+func TestKeyPartitionsGetByID(t *testing.T) {
+	defer func(old int) { keyPartitions = old }(keyPartitions)
+	keyPartitions = 4
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	key := string(newBlobKey("sharded"))
+	store[key] = "sharded"
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- mockClient
+
+	w := httptest.NewRecorder()
+	handleBlobRequest(w, httptest.NewRequest(http.MethodGet, "/blobs/"+strings.TrimPrefix(key, "blob:"), nil), clientPool)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"blob":"sharded"}`, w.Body.String())
+}
+
+////////////////////////////////////////////////////////////////
+/// test first and last
+////////////////////////////////////////////////////////////////
+
+// /first returns the earliest seeded blob and /last the latest
+func TestHandleGETFirstAndLast(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1699999999000000002"] = "middle"
+	store["blob:1699999999000000001"] = "earliest"
+	store["blob:1699999999000000003"] = "latest"
+	store["history:1699999999000000003:00000000000000000001"] = "older version"
+
+	w := httptest.NewRecorder()
+	handleGET(w, httptest.NewRequest(http.MethodGet, "/first", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"blob":"earliest","id":"1699999999000000001"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handleGET(w, httptest.NewRequest(http.MethodGet, "/last", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"blob":"latest","id":"1699999999000000003"}`, w.Body.String())
+}
+
+// /first and /last respond 404 on an empty store
+func TestHandleGETFirstAndLastEmpty(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 1).Return(nil, nil, nil)
+	mockClient.EXPECT().ReverseScan(gomock.Any(), []byte("blob;"), []byte("blob:"), 1).Return(nil, nil, nil)
+
+	for _, path := range []string{"/first", "/last"} {
+		w := httptest.NewRecorder()
+		handleGET(w, httptest.NewRequest(http.MethodGet, path, nil), mockClient)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, `{"error":"No blobs found"}`, w.Body.String())
+	}
+}
+
+////////////////////////////////////////////////////////////////
+/// test partial client pool startup
+////////////////////////////////////////////////////////////////
+
+// flakyClientFactory replaces newTiKVClient with one whose first failures calls fail.
+// It returns the number of calls made so far.
+func flakyClientFactory(t *testing.T, failures int32) *int32 {
+	var calls int32
+	original := newTiKVClient
+	newTiKVClient = func(addrs []string) (RawKVClientInterface, error) {
+		if atomic.AddInt32(&calls, 1) <= failures {
+			return nil, fmt.Errorf("cannot reach %s", strings.Join(addrs, ","))
+		}
+		return NewMockRawKVClientInterface(nil), nil
+	}
+	t.Cleanup(func() { newTiKVClient = original })
+	return &calls
+}
+
+// The pool starts with the minimum number of clients and fills the rest in the background
+func TestSetupClientPoolStartsAtMinimum(t *testing.T) {
+	originalPrimary, originalSecondary := pdAddrs, secondaryPDAddrs
+	defer func() { pdAddrs, secondaryPDAddrs = originalPrimary, originalSecondary }()
+	defer func(old int) { minPoolClients = old }(minPoolClients)
+	defer func(old time.Duration) { clientReconnectInterval = old }(clientReconnectInterval)
+	pdAddrs = []string{"primary:2379"}
+	secondaryPDAddrs = nil
+	minPoolClients = ClientPoolSize - 3
+	clientReconnectInterval = 50 * time.Millisecond
+	flakyClientFactory(t, 3)
+
+	clientPool := setupClientPool(false)
+
+	assert.Equal(t, ClientPoolSize-3, len(clientPool))
+	assert.Eventually(t, func() bool { return len(clientPool) == ClientPoolSize }, 2*time.Second, 10*time.Millisecond)
+}
+
+// Missing clients are retried until the pool is full
+func TestFillClientPoolRetriesUntilFull(t *testing.T) {
+	originalPrimary, originalSecondary := pdAddrs, secondaryPDAddrs
+	defer func() { pdAddrs, secondaryPDAddrs = originalPrimary, originalSecondary }()
+	defer func(old time.Duration) { clientReconnectInterval = old }(clientReconnectInterval)
+	pdAddrs = []string{"primary:2379"}
+	secondaryPDAddrs = nil
+	activePDAddrs = pdAddrs
+	clientReconnectInterval = time.Millisecond
+	calls := flakyClientFactory(t, 2)
+	clientPool := make(chan RawKVClientInterface, ClientPoolSize)
+
+	fillClientPool(clientPool, 3)
+
+	assert.Equal(t, 3, len(clientPool))
+	assert.Equal(t, int32(5), atomic.LoadInt32(calls))
+}
+
+// After clients are drained from the pool and discarded, the refiller brings it back to full size
+func TestPoolRefillerRestoresDrainedPool(t *testing.T) {
+	originalPrimary, originalSecondary := pdAddrs, secondaryPDAddrs
+	defer func() { pdAddrs, secondaryPDAddrs = originalPrimary, originalSecondary }()
+	defer func(old time.Duration) { poolRefillInterval = old }(poolRefillInterval)
+	defer discardedClients.Store(0)
+	pdAddrs = []string{"primary:2379"}
+	secondaryPDAddrs = nil
+	activePDAddrs = pdAddrs
+	poolRefillInterval = 10 * time.Millisecond
+	flakyClientFactory(t, 1)
+	clientPool := make(chan RawKVClientInterface, ClientPoolSize)
+	for i := 0; i < ClientPoolSize; i++ {
+		clientPool <- NewMockRawKVClientInterface(nil)
+	}
+
+	for i := 0; i < 4; i++ {
+		discardClient(clientPool, <-clientPool)
+	}
+	assert.Equal(t, ClientPoolSize-4, len(clientPool))
+
+	setupPoolRefiller(clientPool)
+
+	assert.Eventually(t, func() bool { return len(clientPool) == ClientPoolSize }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(0), discardedClients.Load())
+}
+
+// The refiller never grows the pool past its capacity
+func TestRefillClientPoolStopsWhenFull(t *testing.T) {
+	defer discardedClients.Store(0)
+	calls := flakyClientFactory(t, 0)
+	clientPool := make(chan RawKVClientInterface, 2)
+	clientPool <- NewMockRawKVClientInterface(nil)
+	discardedClients.Store(3)
+
+	refillClientPool(clientPool)
+
+	assert.Equal(t, 2, len(clientPool))
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+	assert.Equal(t, int32(0), discardedClients.Load())
+}
+
+////////////////////////////////////////////////////////////////
+/// test pool acquire modes
+////////////////////////////////////////////////////////////////
+
+// In failfast mode an empty pool yields no client without waiting
+func TestGetClientFromPoolFailFast(t *testing.T) {
+	defer func(old string) { poolAcquireMode = old }(poolAcquireMode)
+	defer func(old time.Duration) { poolAcquireTimeout = old }(poolAcquireTimeout)
+	poolAcquireMode = PoolAcquireFailFast
+	poolAcquireTimeout = time.Hour
+	clientPool := make(chan RawKVClientInterface, 1)
+
+	start := time.Now()
+	assert.Nil(t, getClientFromPool(clientPool))
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+// In wait mode an empty pool yields no client once the timeout passes
+func TestGetClientFromPoolWaitTimesOut(t *testing.T) {
+	defer func(old string) { poolAcquireMode = old }(poolAcquireMode)
+	defer func(old time.Duration) { poolAcquireTimeout = old }(poolAcquireTimeout)
+	poolAcquireMode = PoolAcquireWait
+	poolAcquireTimeout = 50 * time.Millisecond
+	clientPool := make(chan RawKVClientInterface, 1)
+
+	start := time.Now()
+	assert.Nil(t, getClientFromPool(clientPool))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+// In wait mode a client returned to the pool while waiting is handed out
+func TestGetClientFromPoolWaitGetsReturnedClient(t *testing.T) {
+	defer func(old string) { poolAcquireMode = old }(poolAcquireMode)
+	defer func(old time.Duration) { poolAcquireTimeout = old }(poolAcquireTimeout)
+	poolAcquireMode = PoolAcquireWait
+	poolAcquireTimeout = 5 * time.Second
+	clientPool := make(chan RawKVClientInterface, 1)
+	client := &MockRawKVClientInterface{}
+	time.AfterFunc(20*time.Millisecond, func() { clientPool <- client })
+
+	assert.Same(t, client, getClientFromPool(clientPool))
+}
+
+// In failfast mode a request against an empty pool gets the empty-pool error straight away
+func TestHandleRequestFailFastOnEmptyPool(t *testing.T) {
+	defer func(old string) { poolAcquireMode = old }(poolAcquireMode)
+	poolAcquireMode = PoolAcquireFailFast
+	w := httptest.NewRecorder()
+
+	start := time.Now()
+	handleRequest(w, httptest.NewRequest(http.MethodGet, "/", nil), make(chan RawKVClientInterface, 1))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, `{"error":"No TiKV client available"}`, w.Body.String())
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+// In wait mode a request against a pool that stays empty gets a 503 once the timeout passes
+func TestHandleRequestWaitTimeoutOnEmptyPool(t *testing.T) {
+	defer func(old string) { poolAcquireMode = old }(poolAcquireMode)
+	defer func(old time.Duration) { poolAcquireTimeout = old }(poolAcquireTimeout)
+	poolAcquireMode = PoolAcquireWait
+	poolAcquireTimeout = 50 * time.Millisecond
+	w := httptest.NewRecorder()
+
+	start := time.Now()
+	handleRequest(w, httptest.NewRequest(http.MethodGet, "/", nil), make(chan RawKVClientInterface, 1))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, `{"error":"No TiKV client available"}`, w.Body.String())
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+////////////////////////////////////////////////////////////////
+/// test read retries
+////////////////////////////////////////////////////////////////
+
+// A transient Get failure is retried within the request and the read succeeds
+func TestGetRequestRetriesTransientReadError(t *testing.T) {
+	defer func(old int) { maxReadRetries = old }(maxReadRetries)
+	maxReadRetries = 2
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- mockClient
+
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 100).Return([][]byte{[]byte("blob:1")}, nil, nil)
+	gomock.InOrder(
+		mockClient.EXPECT().Get(gomock.Any(), []byte("blob:1")).Return(nil, errors.New("region unavailable")),
+		mockClient.EXPECT().Get(gomock.Any(), []byte("blob:1")).Return([]byte("hello"), nil),
+	)
+
+	w := httptest.NewRecorder()
+	handleRequest(w, httptest.NewRequest(http.MethodGet, "/", nil), clientPool)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-TiKV-Retries"))
+}
+
+// Writes are not retried by the read retry budget
+func TestReadRetryClientPassesWritesThrough(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Put(gomock.Any(), []byte("blob:1"), []byte("hello")).Return(errors.New("region unavailable")).Times(1)
+
+	client := newReadRetryClient(mockClient, 3, nil)
+
+	assert.Error(t, client.Put(context.Background(), []byte("blob:1"), []byte("hello")))
+}
+
+////////////////////////////////////////////////////////////////
+/// test ?echo=stored
+////////////////////////////////////////////////////////////////
+
+// With ?echo=stored the response carries the value read back from TiKV, not the request input
+func TestHandlePOSTEchoStored(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 100).Return(nil, nil, nil)
+	mockClient.EXPECT().Put(gomock.Any(), gomock.Any(), []byte("hello  world ")).Return(nil)
+	// The store normalized the value on the way in.
+	mockClient.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]byte("hello world"), nil)
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=hello%20%20world%20&echo=stored", nil), mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"blob":"hello world"}`, w.Body.String())
+}
+
+// Without ?echo=stored the value is not read back
+func TestHandlePOSTEchoesInput(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 100).Return(nil, nil, nil)
+	mockClient.EXPECT().Put(gomock.Any(), gomock.Any(), []byte("hello  world ")).Return(nil)
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=hello%20%20world%20", nil), mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"blob":"hello  world "}`, w.Body.String())
+}
+
+// PUT with ?echo=stored reads the new value back from its key
+func TestHandlePUTEchoStored(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "old"
+
+	w := httptest.NewRecorder()
+	handlePUT(w, httptest.NewRequest(http.MethodPut, "/old?newBlob=new&echo=stored", nil), mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"blob":"new"}`, w.Body.String())
+}
+
+////////////////////////////////////////////////////////////////
+/// test MAX_CONNS
+////////////////////////////////////////////////////////////////
+
+// With MAX_CONNS set, connections beyond the limit wait until an open one closes
+func TestNewListenerQueuesBeyondMaxConns(t *testing.T) {
+	defer func(old int) { maxConns = old }(maxConns)
+	maxConns = 1
+
+	lis, err := newListener("127.0.0.1:0")
+	assert.NoError(t, err)
+	defer lis.Close()
+
+	first, err := net.Dial("tcp", lis.Addr().String())
+	assert.NoError(t, err)
+	defer first.Close()
+	accepted, err := lis.Accept()
+	assert.NoError(t, err)
+
+	second, err := net.Dial("tcp", lis.Addr().String())
+	assert.NoError(t, err)
+	defer second.Close()
+	queued := make(chan net.Conn, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err == nil {
+			queued <- conn
+		}
+	}()
+
+	select {
+	case conn := <-queued:
+		conn.Close()
+		t.Fatal("second connection accepted while the first was still open")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	accepted.Close()
+	select {
+	case conn := <-queued:
+		conn.Close()
+	case <-time.After(2 * time.Second):
+		t.Fatal("second connection not accepted after the first closed")
+	}
+}
+
+////////////////////////////////////////////////////////////////
+/// test Allow header on 405
+////////////////////////////////////////////////////////////////
+
+// Each route answers an unsupported method with 405 and the methods it does support
+func TestMethodNotAllowedListsAllowedMethods(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tests := []struct {
+		method string
+		path   string
+		allow  string
+	}{
+		{http.MethodPatch, "/", "GET, POST, PUT, DELETE"},
+		{http.MethodDelete, "/blobs/1", "GET"},
+		{http.MethodPost, "/blobs/1/exists", "GET"},
+		{http.MethodGet, "/blobs/1/touch", "POST"},
+		{http.MethodGet, "/rpc", "POST"},
+	}
+	for _, tt := range tests {
+		clientPool := make(chan RawKVClientInterface, 1)
+		clientPool <- NewMockRawKVClientInterface(ctrl)
+		w := httptest.NewRecorder()
+
+		setupServer(clientPool).ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code, "%s %s", tt.method, tt.path)
+		assert.Equal(t, tt.allow, w.Header().Get("Allow"), "%s %s", tt.method, tt.path)
+	}
+}
+
+////////////////////////////////////////////////////////////////
+/// test DELETE_SUCCESS_STATUS
+////////////////////////////////////////////////////////////////
+
+// A successful DELETE answers 200 with a message by default and 204 without a body when configured
+func TestHandleDELETESuccessStatus(t *testing.T) {
+	defer func(old int) { deleteSuccessStatus = old }(deleteSuccessStatus)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tests := []struct {
+		status int
+		body   string
+	}{
+		{http.StatusOK, `{"message":"Blob deleted successfully"}`},
+		{http.StatusNoContent, ""},
+	}
+	for _, tt := range tests {
+		deleteSuccessStatus = tt.status
+		mockClient, store := newMemoryClient(ctrl)
+		store["blob:1"] = "bye"
+		handler := withRequestID(withCompression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handleDELETE(w, r, mockClient)
+		})))
+		req := httptest.NewRequest(http.MethodDelete, "/?blob=bye", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.status, w.Code)
+		assert.Equal(t, tt.body, w.Body.String())
+		assert.Empty(t, store)
+	}
+}
+
+// With 204 configured, a JSON-RPC delete still succeeds, with a null result
+func TestRPCDeleteWithNoContent(t *testing.T) {
+	defer func(old int) { deleteSuccessStatus = old }(deleteSuccessStatus)
+	deleteSuccessStatus = http.StatusNoContent
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "bye"
+
+	result, rpcErr := callRPC(httptest.NewRequest(http.MethodPost, "/rpc", nil), mockClient, "blob.delete", rpcParams{Blob: "bye"})
+
+	assert.Nil(t, rpcErr)
+	assert.Equal(t, "null", string(result))
+	assert.Empty(t, store)
+}
+
+////////////////////////////////////////////////////////////////
+/// test DEDUP_SCAN_LIMIT
+////////////////////////////////////////////////////////////////
+
+// The duplicate check compares at most DEDUP_SCAN_LIMIT blobs and warns when it stopped there
+func TestHandlePOSTDedupScanLimit(t *testing.T) {
+	defer func(old int) { dedupScanLimit = old }(dedupScanLimit)
+	dedupScanLimit = 2
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockKeys := [][]byte{[]byte("blob:1"), []byte("blob:2")}
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 2).Return(mockKeys, [][]byte{[]byte("one"), []byte("two")}, nil)
+	mockClient.EXPECT().Put(gomock.Any(), gomock.Any(), []byte("three")).Return(nil)
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=three", nil), mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Only the first 2 blobs were checked for duplicates", w.Header().Get(DedupWarningHeader))
+}
+
+// Below the limit every blob was checked and there is no warning
+func TestHandlePOSTDedupBelowScanLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockKeys := [][]byte{[]byte("blob:1")}
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, [][]byte{[]byte("one")}, nil)
+	mockClient.EXPECT().Put(gomock.Any(), gomock.Any(), []byte("two")).Return(nil)
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=two", nil), mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(DedupWarningHeader))
+}
+
+////////////////
+
+// ?meta=true returns the id and the creation time parsed from a time-based key
+func TestHandleGETByIDWithMeta(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), []byte("blob:1700000000000000001")).Return([]byte("hello"), nil)
+
+	w := httptest.NewRecorder()
+	handleGETByID(w, httptest.NewRequest(http.MethodGet, "/blobs/1700000000000000001?meta=true", nil), mockClient, "1700000000000000001")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"id":"1700000000000000001","blob":"hello","created":"2023-11-14T22:13:20.000000001Z"}`, w.Body.String())
+}
+
+// A key that carries no time is returned without "created"
+func TestHandleGETByIDWithMetaNonConformingKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), []byte("blob:custom-id")).Return([]byte("hello"), nil)
+
+	w := httptest.NewRecorder()
+	handleGETByID(w, httptest.NewRequest(http.MethodGet, "/blobs/custom-id?meta=true", nil), mockClient, "custom-id")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"id":"custom-id","blob":"hello"}`, w.Body.String())
+}
+
+////////////////
+
+// Counting stops at COUNT_LIMIT and the response reports at least that many
+func TestHandleGETCountCapped(t *testing.T) {
+	defer func(old int) { countLimit = old }(countLimit)
+	countLimit = 150
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	for i := 0; i < 200; i++ {
+		store[fmt.Sprintf("blob:%05d", i)] = "blob"
+	}
+
+	w := httptest.NewRecorder()
+	handleGETCount(w, mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"count":150,"atLeast":true}`, w.Body.String())
+}
+
+// Below COUNT_LIMIT, and with COUNT_LIMIT=0, every blob is counted across pages
+func TestHandleGETCountUncapped(t *testing.T) {
+	defer func(old int) { countLimit = old }(countLimit)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	for i := 0; i < 250; i++ {
+		store[fmt.Sprintf("blob:%05d", i)] = "blob"
+	}
+
+	for _, limit := range []int{0, 250, 1000} {
+		countLimit = limit
+		w := httptest.NewRecorder()
+		handleGETCount(w, mockClient)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"count":250}`, w.Body.String(), "COUNT_LIMIT=%d", limit)
+	}
+}
+
+// A capped monitoring scan logs "at least" and reports no change in count
+func TestBlobMonitorCapped(t *testing.T) {
+	defer func(old int) { countLimit = old }(countLimit)
+	countLimit = 2
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	for i := 0; i < 3; i++ {
+		store[fmt.Sprintf("blob:%d", i)] = "blob"
+	}
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	monitor := &blobMonitor{}
+	monitor.tick(mockClient)
+	monitor.tick(mockClient)
+
+	assert.Contains(t, buf.String(), "Number of keys in TiKV: at least 2 (COUNT_LIMIT reached)")
+	assert.NotContains(t, buf.String(), "Change in number of blobs")
+}
+
+// Each monitoring tick returns its client, so the pool stays full however many ticks run
+func TestBlobMonitorReturnsClientToPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "blob"
+	clientPool := make(chan RawKVClientInterface, 2)
+	clientPool <- mockClient
+	clientPool <- mockClient
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	monitor := &blobMonitor{}
+	for i := 0; i < 5; i++ {
+		monitor.tickFromPool(clientPool)
+		assert.Equal(t, 2, len(clientPool), "after tick %d", i+1)
+	}
+	assert.Equal(t, 5, strings.Count(buf.String(), "Number of keys in TiKV: 1"))
+}
+
+////////////////
+
+// ?onDuplicate= decides what happens when the posted blob is already stored
+func TestHandlePOSTOnDuplicate(t *testing.T) {
+	defer func(old bool) { splitMetadata = old }(splitMetadata)
+	splitMetadata = true
+	const created = "2023-11-14T22:13:20Z"
+
+	tests := []struct {
+		mode      string
+		status    int
+		body      string
+		location  string
+		refreshed bool
+	}{
+		{"", http.StatusConflict, `{"error":"Blob already exists","id":"1700000000000000000"}`, "/blobs/1700000000000000000", false},
+		{"conflict", http.StatusConflict, `{"error":"Blob already exists","id":"1700000000000000000"}`, "/blobs/1700000000000000000", false},
+		{"overwrite", http.StatusOK, `{"blob":"hello"}`, "/blobs/1700000000000000000", true},
+		{"ignore", http.StatusOK, `{"blob":"hello","id":"1700000000000000000"}`, "/blobs/1700000000000000000", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.mode, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockClient, store := newMemoryClient(ctrl)
+			store["blob:1700000000000000000"] = "hello"
+			oldMeta := `{"created":"` + created + `","updated":"` + created + `","size":5}`
+			store["meta:1700000000000000000"] = oldMeta
+
+			w := httptest.NewRecorder()
+			handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=hello&onDuplicate="+test.mode, nil), mockClient)
+
+			assert.Equal(t, test.status, w.Code)
+			assert.JSONEq(t, test.body, w.Body.String())
+			assert.Equal(t, test.location, w.Header().Get("Location"))
+			assert.Len(t, store, 2)
+			assert.Equal(t, "hello", store["blob:1700000000000000000"])
+
+			var meta blobMeta
+			assert.NoError(t, json.Unmarshal([]byte(store["meta:1700000000000000000"]), &meta))
+			assert.Equal(t, created, meta.Created.Format(time.RFC3339))
+			assert.Equal(t, test.refreshed, meta.Updated.After(meta.Created))
+		})
+	}
+}
+
+// An unknown ?onDuplicate= is rejected before the store is touched
+func TestHandlePOSTInvalidOnDuplicate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := NewMockRawKVClientInterface(ctrl)
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=hello&onDuplicate=replace", nil), mockClient)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error":"Invalid onDuplicate"}`, w.Body.String())
+}
+
+////////////////
+
+// ?withId=true returns the id of the key the blob was read from
+func TestHandleGETRandomWithID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1700000000000000001"] = "one"
+	store["blob:1700000000000000002"] = "two"
+	store["blob:1700000000000000003"] = "three"
+
+	seen := map[string]bool{}
+	for i := 0; i < 30; i++ {
+		w := httptest.NewRecorder()
+		handleGETRandom(w, httptest.NewRequest(http.MethodGet, "/random?withId=true", nil), mockClient)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp map[string]string
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, store["blob:"+resp["id"]], resp["blob"])
+		seen[resp["id"]] = true
+	}
+	assert.Greater(t, len(seen), 1)
+}
+
+// When a deleted key is skipped, the id is that of the key picked instead
+func TestHandleGETRandomWithIDSkipsDeletedKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	for i := 0; i < 10; i++ {
+		mockKeys := [][]byte{[]byte("blob:1"), []byte("blob:2")}
+		mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, nil, nil)
+		mockClient.EXPECT().Get(gomock.Any(), []byte("blob:1")).Return(nil, nil).MaxTimes(1)
+		mockClient.EXPECT().Get(gomock.Any(), []byte("blob:2")).Return([]byte("survivor"), nil)
+
+		w := httptest.NewRecorder()
+		handleGETRandom(w, httptest.NewRequest(http.MethodGet, "/random?withId=true", nil), mockClient)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"blob":"survivor","id":"2"}`, w.Body.String())
+	}
+}
+
+// The id is left out unless asked for
+func TestHandleGETRandomWithoutID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "one"
+
+	w := httptest.NewRecorder()
+	handleGETRandom(w, httptest.NewRequest(http.MethodGet, "/random", nil), mockClient)
+
+	assert.Equal(t, `{"blob":"one"}`, w.Body.String())
+}
+
+////////////////
+
+// ?sha256= is verified against the received blob before it is written
+func TestHandlePOSTContentHash(t *testing.T) {
+	const helloWorld = "872e4e50ce9990d8b041330c47c9ddd11bec6b503ae9386a99da8584e9bb12c4"
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		body   string
+		stored bool
+	}{
+		{"matching", "&sha256=" + helloWorld, http.StatusOK, `{"blob":"HelloWorld"}`, true},
+		{"matching upper case", "&sha256=" + strings.ToUpper(helloWorld), http.StatusOK, `{"blob":"HelloWorld"}`, true},
+		{"absent", "", http.StatusOK, `{"blob":"HelloWorld"}`, true},
+		{"mismatching", "&sha256=" + strings.Repeat("0", 64), http.StatusBadRequest, `{"error":"Blob does not match sha256"}`, false},
+		{"too short", "&sha256=" + helloWorld[:len(helloWorld)-2], http.StatusBadRequest, `{"error":"Invalid sha256"}`, false},
+		{"not hex", "&sha256=" + strings.Repeat("z", 64), http.StatusBadRequest, `{"error":"Invalid sha256"}`, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockClient, store := newMemoryClient(ctrl)
+
+			w := httptest.NewRecorder()
+			handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=HelloWorld"+test.query, nil), mockClient)
+
+			assert.Equal(t, test.status, w.Code)
+			assert.JSONEq(t, test.body, w.Body.String())
+			assert.Equal(t, test.stored, len(store) == 1)
+		})
+	}
+}
+
+////////////////
+
+// ROOT_GET_BEHAVIOR decides what GET / returns, while other paths still return a random blob
+func TestHandleGETRootBehavior(t *testing.T) {
+	defer func(old string) { rootGetBehavior = old }(rootGetBehavior)
+	tests := []struct {
+		behavior string
+		status   int
+		body     string
+	}{
+		{RootGetRandom, http.StatusOK, `{"blob":"one"}`},
+		{RootGetList, http.StatusOK, `{"blobs":["one"]}`},
+		{RootGetCount, http.StatusOK, `{"count":1}`},
+		{RootGetNoop, http.StatusNoContent, ``},
+	}
+
+	for _, test := range tests {
+		t.Run(test.behavior, func(t *testing.T) {
+			rootGetBehavior = test.behavior
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockClient, store := newMemoryClient(ctrl)
+			store["blob:1"] = "one"
+
+			w := httptest.NewRecorder()
+			handleGET(w, httptest.NewRequest(http.MethodGet, "/", nil), mockClient)
+			assert.Equal(t, test.status, w.Code)
+			assert.Equal(t, test.body, w.Body.String())
+
+			w = httptest.NewRecorder()
+			handleGET(w, httptest.NewRequest(http.MethodGet, "/random", nil), mockClient)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, `{"blob":"one"}`, w.Body.String())
+		})
+	}
+}
+
+////////////////
+
+// With LIST_ETAGS a page carries an ETag, and a request that sends it back gets 304 until the page changes
+func TestHandleGETAllETag(t *testing.T) {
+	defer func(old bool) { listETags = old }(listETags)
+	listETags = true
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "one"
+	store["blob:2"] = "two"
+
+	w := httptest.NewRecorder()
+	handleGETAll(w, httptest.NewRequest(http.MethodGet, "/all", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.True(t, strings.HasPrefix(etag, `W/"`), etag)
+
+	r := httptest.NewRequest(http.MethodGet, "/all", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	handleGETAll(w, r, mockClient)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+
+	store["blob:2"] = "deux"
+	w = httptest.NewRecorder()
+	handleGETAll(w, r, mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+	assert.Equal(t, `{"blobs":["one","deux"]}`, w.Body.String())
+}
+
+// Pages in a different order, or without LIST_ETAGS, never get a 304
+func TestHandleGETAllETagVaries(t *testing.T) {
+	defer func(old bool) { listETags = old }(listETags)
+	listETags = true
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "one"
+	store["blob:2"] = "two"
+
+	w := httptest.NewRecorder()
+	handleGETAll(w, httptest.NewRequest(http.MethodGet, "/all", nil), mockClient)
+	etag := w.Header().Get("ETag")
+
+	r := httptest.NewRequest(http.MethodGet, "/all?sort=-value", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	handleGETAll(w, r, mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	listETags = false
+	r = httptest.NewRequest(http.MethodGet, "/all", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	handleGETAll(w, r, mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("ETag"))
+}
+
+////////////////
+
+// raftEntryTooLarge is the error the TiKV client returns for a RaftEntryTooLarge region error.
+var raftEntryTooLarge = errors.New(`message:"raft entry is too large, region 2, entry size 9437184" raft_entry_too_large:<region_id:2 entry_size:9437184 >`)
+
+// A blob TiKV refuses for its size responds 413, while other failed writes still respond 500
+func TestHandlePOSTEntryTooLarge(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		err    error
+		status int
+		body   string
+	}{
+		{"too large", raftEntryTooLarge, http.StatusRequestEntityTooLarge, `{"error":"Blob too large for TiKV"}`},
+		{"other failure", errors.New("region unavailable"), http.StatusInternalServerError, `{"error":"Failed to save blob"}`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockClient := NewMockRawKVClientInterface(ctrl)
+			mockClient.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil, nil)
+			mockClient.EXPECT().Put(gomock.Any(), gomock.Any(), []byte("HelloWorld")).Return(test.err)
+
+			w := httptest.NewRecorder()
+			handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=HelloWorld", nil), mockClient)
+
+			assert.Equal(t, test.status, w.Code)
+			assert.Equal(t, test.body, w.Body.String())
+		})
+	}
+}
+
+// An update TiKV refuses for its size also responds 413
+func TestHandlePUTEntryTooLarge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return([][]byte{[]byte("blob:1")}, [][]byte{[]byte("HelloWorld")}, nil).AnyTimes()
+	mockClient.EXPECT().Get(gomock.Any(), []byte("blob:1")).Return([]byte("HelloWorld"), nil).AnyTimes()
+	mockClient.EXPECT().Put(gomock.Any(), []byte("blob:1"), []byte("HelloAgain")).Return(raftEntryTooLarge)
+
+	w := httptest.NewRecorder()
+	handlePUT(w, httptest.NewRequest(http.MethodPut, "/HelloWorld?newBlob=HelloAgain", nil), mockClient)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, `{"error":"Blob too large for TiKV"}`, w.Body.String())
+}
+
+////////////////
+
+// DELETE takes the blob from a JSON body when it is not in the URL
+func TestHandleDELETEBlobInBody(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	long := strings.Repeat("to be or not to be ", 1000)
+	store["blob:1"] = long
+	store["blob:2"] = "HelloWorld"
+
+	body, _ := json.Marshal(map[string]string{"blob": long})
+	w := httptest.NewRecorder()
+	handleDELETE(w, httptest.NewRequest(http.MethodDelete, "/", bytes.NewReader(body)), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"message":"Blob deleted successfully"}`, w.Body.String())
+	assert.Equal(t, map[string]string{"blob:2": "HelloWorld"}, store)
+
+	w = httptest.NewRecorder()
+	handleDELETE(w, httptest.NewRequest(http.MethodDelete, "/", strings.NewReader(`{"blob":"ByeUniverse"}`)), mockClient)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, `{"error":"Blob not found"}`, w.Body.String())
+	assert.Len(t, store, 1)
+}
+
+// The query parameter wins over the body, and bodies that are not {"blob": "<string>"} are rejected
+func TestHandleDELETEBlobInBodyEdgeCases(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "HelloWorld"
+
+	w := httptest.NewRecorder()
+	handleDELETE(w, httptest.NewRequest(http.MethodDelete, "/?blob=HelloWorld", strings.NewReader(`{"blob":"ByeUniverse"}`)), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, store)
+
+	for body, expected := range map[string]string{
+		`not json`:      `{"error":"Invalid request body"}`,
+		`{"blob":42}`:   `{"error":"Invalid request body"}`,
+		`{"other":"x"}`: `{"error":"No blob provided"}`,
+		`{"blob":""}`:   `{"error":"No blob provided"}`,
+	} {
+		w := httptest.NewRecorder()
+		handleDELETE(w, httptest.NewRequest(http.MethodDelete, "/", strings.NewReader(body)), mockClient)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		assert.Equal(t, expected, w.Body.String(), body)
+	}
+}
+
+////////////////
+
+// When newBlob is already stored under another key, ?onDuplicate= decides what PUT does
+func TestHandlePUTOnDuplicate(t *testing.T) {
+	tests := []struct {
+		onDuplicate string
+		status      int
+		body        string
+		stored      map[string]string
+	}{
+		{"", http.StatusConflict, `{"error":"Blob already exists","id":"2"}`, map[string]string{"blob:1": "old", "blob:2": "new"}},
+		{"conflict", http.StatusConflict, `{"error":"Blob already exists","id":"2"}`, map[string]string{"blob:1": "old", "blob:2": "new"}},
+		{"overwrite", http.StatusOK, `{"blob":"new"}`, map[string]string{"blob:1": "new", "blob:2": "new"}},
+		{"merge", http.StatusOK, `{"blob":"new"}`, map[string]string{"blob:1": "new"}},
+	}
+
+	for _, test := range tests {
+		t.Run("onDuplicate="+test.onDuplicate, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockClient, store := newMemoryClient(ctrl)
+			store["blob:1"] = "old"
+			store["blob:2"] = "new"
+
+			w := httptest.NewRecorder()
+			handlePUT(w, httptest.NewRequest(http.MethodPut, "/old?newBlob=new&onDuplicate="+test.onDuplicate, nil), mockClient)
+
+			assert.Equal(t, test.status, w.Code)
+			assert.JSONEq(t, test.body, w.Body.String())
+			assert.Equal(t, test.stored, store)
+		})
+	}
+}
+
+// Updating a blob to its own value is not a duplicate, and onDuplicate values PUT does not know are rejected
+func TestHandlePUTOnDuplicateEdgeCases(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "same"
+
+	w := httptest.NewRecorder()
+	handlePUT(w, httptest.NewRequest(http.MethodPut, "/same?newBlob=same", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	for _, onDuplicate := range []string{"ignore", "bogus"} {
+		w := httptest.NewRecorder()
+		handlePUT(w, httptest.NewRequest(http.MethodPut, "/same?newBlob=other&onDuplicate="+onDuplicate, nil), mockClient)
+		assert.Equal(t, http.StatusBadRequest, w.Code, onDuplicate)
+		assert.Equal(t, `{"error":"Invalid onDuplicate"}`, w.Body.String(), onDuplicate)
+	}
+	assert.Equal(t, map[string]string{"blob:1": "same"}, store)
+}
+
+// With content keys the duplicate is the new key itself, so merging leaves just that one
+func TestHandlePUTOnDuplicateMergeContentScheme(t *testing.T) {
+	defer func(old string) { keyScheme = old }(keyScheme)
+	keyScheme = KeySchemeContent
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	oldKey, newKey := string(contentKey("old")), string(contentKey("new"))
+	store[oldKey] = "old"
+	store[newKey] = "new"
+
+	w := httptest.NewRecorder()
+	handlePUT(w, httptest.NewRequest(http.MethodPut, "/old?newBlob=new", nil), mockClient)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	handlePUT(w, httptest.NewRequest(http.MethodPut, "/old?newBlob=new&onDuplicate=merge", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]string{newKey: "new"}, store)
+}
+
+////////////////
+// INCLUDE_SIZE
+
+// With INCLUDE_SIZE a blob read by id carries its stored length in bytes, with or without ?meta=true
+func TestHandleGETByIDIncludeSize(t *testing.T) {
+	defer func(old bool) { includeSize = old }(includeSize)
+	includeSize = true
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:ascii"] = "to be or not to be"
+	store["blob:multibyte"] = "日本語"
+
+	w := httptest.NewRecorder()
+	handleGETByID(w, httptest.NewRequest(http.MethodGet, "/blobs/ascii", nil), mockClient, "ascii")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"blob":"to be or not to be","size":18}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handleGETByID(w, httptest.NewRequest(http.MethodGet, "/blobs/multibyte?meta=true", nil), mockClient, "multibyte")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"blob":"日本語","id":"multibyte","size":9}`, w.Body.String())
+}
+
+// Without INCLUDE_SIZE responses are unchanged
+func TestHandleGETByIDWithoutSize(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:ascii"] = "to be"
+
+	w := httptest.NewRecorder()
+	handleGETByID(w, httptest.NewRequest(http.MethodGet, "/blobs/ascii", nil), mockClient, "ascii")
+	assert.JSONEq(t, `{"blob":"to be"}`, w.Body.String())
+}
+
+////////////////
+// /all?format=withKeys
+
+// ?format=withKeys lists each blob with its stored key, sorted by value when asked
+func TestHandleGETAllWithKeys(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "pear"
+	store["blob:2"] = "apple"
+
+	w := httptest.NewRecorder()
+	handleGETAll(w, httptest.NewRequest(http.MethodGet, "/all?format=withKeys", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"blobs":[{"key":"blob:1","blob":"pear"},{"key":"blob:2","blob":"apple"}]}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handleGETAll(w, httptest.NewRequest(http.MethodGet, "/all?format=withKeys&sort=value", nil), mockClient)
+	assert.JSONEq(t, `{"blobs":[{"key":"blob:2","blob":"apple"},{"key":"blob:1","blob":"pear"}]}`, w.Body.String())
+}
+
+// An unknown format responds 400, and without one the flat array is unchanged
+func TestHandleGETAllFormat(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "pear"
+
+	w := httptest.NewRecorder()
+	handleGETAll(w, httptest.NewRequest(http.MethodGet, "/all?format=csv", nil), mockClient)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `{"error":"Invalid format"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handleGETAll(w, httptest.NewRequest(http.MethodGet, "/all", nil), mockClient)
+	assert.Equal(t, `{"blobs":["pear"]}`, w.Body.String())
+}
+
+////////////////
+// GET /get?key=
+
+// A blob is fetched by its full key with a single Get
+func TestHandleGETByKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), []byte("blob:1699999999000000000")).Return([]byte("HelloWorld"), nil)
+	mockClient.EXPECT().Get(gomock.Any(), []byte("blob:missing")).Return(nil, nil)
+
+	w := httptest.NewRecorder()
+	handleGET(w, httptest.NewRequest(http.MethodGet, "/get?key=blob:1699999999000000000", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"blob":"HelloWorld"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handleGET(w, httptest.NewRequest(http.MethodGet, "/get?key=blob:missing", nil), mockClient)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// A missing key, or one outside the "blob:" range, is rejected without touching TiKV
+func TestHandleGETByKeyRejectsInvalidKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := NewMockRawKVClientInterface(ctrl)
+
+	w := httptest.NewRecorder()
+	handleGET(w, httptest.NewRequest(http.MethodGet, "/get", nil), mockClient)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `{"error":"No key provided"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handleGET(w, httptest.NewRequest(http.MethodGet, "/get?key=meta:1", nil), mockClient)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `{"error":"Invalid key"}`, w.Body.String())
+}
+
+// A key is read exactly as given, even with CASE_INSENSITIVE_IDS, so keys differing only in case stay apart
+func TestHandleGETByKeyKeepsCase(t *testing.T) {
+	defer func(old bool) { caseInsensitiveIDs = old }(caseInsensitiveIDs)
+	defer func(old bool) { splitMetadata = old }(splitMetadata)
+	caseInsensitiveIDs = true
+	splitMetadata = true
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:AbC"] = "upper"
+	store["meta:AbC"] = `{"created":"2023-11-14T22:13:20Z","updated":"2023-11-14T22:13:20Z","size":5}`
+	store["blob:abc"] = "lower"
+
+	w := httptest.NewRecorder()
+	handleGET(w, httptest.NewRequest(http.MethodGet, "/get?key=blob:AbC&meta=true", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"id":"AbC","blob":"upper","meta":{"created":"2023-11-14T22:13:20Z","updated":"2023-11-14T22:13:20Z","size":5}}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handleGET(w, httptest.NewRequest(http.MethodGet, "/get?key=blob:abc", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"blob":"lower"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handleGET(w, httptest.NewRequest(http.MethodGet, "/get?key=blob:ABC", nil), mockClient)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+////////////////////////////////////////////////////////////////
+/// test handlers reading values from the scan
+////////////////////////////////////////////////////////////////
+
+// /all builds its response from the scanned values without a Get per key
+func TestHandleGETAllUsesScanValues(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockKeys := [][]byte{[]byte("blob:1"), []byte("blob:2")}
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, [][]byte{[]byte("one"), []byte("two")}, nil)
+
+	w := httptest.NewRecorder()
+	handleGETAll(w, httptest.NewRequest(http.MethodGet, "/all", nil), mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"blobs":["one","two"]}`, w.Body.String())
+}
+
+// DELETE and PUT find the blob among the scanned values without a Get per key
+func TestDeleteAndPutUseScanValues(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockKeys := [][]byte{[]byte("blob:1"), []byte("blob:2")}
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 100).Return(mockKeys, [][]byte{[]byte("one"), []byte("two")}, nil).Times(3)
+	mockClient.EXPECT().Delete(gomock.Any(), mockKeys[1]).Return(nil)
+	mockClient.EXPECT().Put(gomock.Any(), mockKeys[0], []byte("uno")).Return(nil)
+
+	w := httptest.NewRecorder()
+	handleDELETE(w, httptest.NewRequest(http.MethodDelete, "/?blob=two", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	handlePUT(w, httptest.NewRequest(http.MethodPut, "/one?newBlob=uno", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+////////////////////////////////////////////////////////////////
+/// test handlers seeing blobs past the first scan page
+////////////////////////////////////////////////////////////////
+
+// /all, POST, PUT and DELETE all reach a blob stored after the first page of keys
+func TestHandlersSeeBlobsPastFirstPage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	for i := 0; i < SearchPageSize+5; i++ {
+		store[fmt.Sprintf("blob:17000000000000%05d", i)] = fmt.Sprintf("blob %d", i)
+	}
+	last := fmt.Sprintf("blob %d", SearchPageSize+4)
+
+	w := httptest.NewRecorder()
+	handleGETAll(w, httptest.NewRequest(http.MethodGet, "/all", nil), mockClient)
+	var resp struct {
+		Blobs []string `json:"blobs"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.Blobs, SearchPageSize+5)
+
+	w = httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob="+url.QueryEscape(last), nil), mockClient)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Empty(t, w.Header().Get(DedupWarningHeader))
+
+	w = httptest.NewRecorder()
+	handlePUT(w, httptest.NewRequest(http.MethodPut, "/"+url.PathEscape(last)+"?newBlob=moved", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	handleDELETE(w, httptest.NewRequest(http.MethodDelete, "/?blob=moved", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, store, SearchPageSize+4)
+}
+
+////////////////
+
+// POST stores the blob sent in a JSON body, and falls back to the query parameter without one
+func TestHandlePOSTBlobInBody(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, _ := newMemoryClient(ctrl)
+	long := strings.Repeat("to be or not to be ", 1000)
+
+	body, _ := json.Marshal(map[string]string{"blob": long})
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handlePOST(w, req, mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, string(body), w.Body.String())
+
+	w = httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=HelloWorld", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	keys, values, err := scanAllBlobs(ctx, mockClient)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	assert.ElementsMatch(t, []string{long, "HelloWorld"}, []string{string(values[0]), string(values[1])})
+
+	w = httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"blob":"HelloWorld"}`)), mockClient)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+// The body wins over the query parameter, and bodies that are not {"blob": "<string>"} are rejected
+func TestHandlePOSTBlobInBodyEdgeCases(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, _ := newMemoryClient(ctrl)
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=FromQuery", strings.NewReader(`{"blob":"FromBody"}`)), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"blob":"FromBody"}`, w.Body.String())
+
+	for body, expected := range map[string]string{
+		`not json`:      `{"error":"Invalid request body"}`,
+		`{"blob":"x"`:   `{"error":"Invalid request body"}`,
+		`{"blob":42}`:   `{"error":"Invalid request body"}`,
+		`{"other":"x"}`: `{"error":"No blob provided"}`,
+		`{"blob":""}`:   `{"error":"No blob provided"}`,
+	} {
+		w := httptest.NewRecorder()
+		handlePOST(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)), mockClient)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		assert.Equal(t, expected, w.Body.String(), body)
+	}
 }
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tikv/client-go/v2/rawkv"
+)
+
+// Storage modes, chosen with STORAGE_MODE.
+//
+// StorageModeTiKV stores blobs in the TiKV cluster at PD_ADDRS. StorageModeMemory keeps them in a map inside the process
+// and needs no TiKV at all, for demos, local development and CI; everything is lost when the process exits.
+// StorageModeAuto uses TiKV, but falls back to memory if not a single TiKV client can be created at startup.
+const (
+	StorageModeTiKV   = "tikv"
+	StorageModeMemory = "memory"
+	StorageModeAuto   = "auto"
+)
+
+// memoryStore is the store every pooled client shares with STORAGE_MODE=memory.
+var memoryStore = newMemoryStore()
+
+// memoryKV is an in-memory RawKVClientInterface. Keys are kept in a map and sorted on each scan, which is fine for
+// the small stores it is meant for. TTLs are honoured: an expired key reads as missing. Options are ignored.
+type memoryKV struct {
+	mu      sync.Mutex
+	values  map[string][]byte
+	expires map[string]time.Time
+}
+
+// newMemoryStore returns an empty in-memory store.
+func newMemoryStore() *memoryKV {
+	return &memoryKV{values: map[string][]byte{}, expires: map[string]time.Time{}}
+}
+
+// get returns the value of key, or nil if it is missing or expired. The caller holds m.mu.
+func (m *memoryKV) get(key string) []byte {
+	if expiry, ok := m.expires[key]; ok && !time.Now().Before(expiry) {
+		delete(m.values, key)
+		delete(m.expires, key)
+		return nil
+	}
+	return m.values[key]
+}
+
+// put stores a copy of value under key. The caller holds m.mu.
+func (m *memoryKV) put(key string, value []byte) {
+	m.values[key] = cloneBytes(value)
+	delete(m.expires, key)
+}
+
+// Get returns the value of key, or nil if there is none.
+func (m *memoryKV) Get(ctx context.Context, key []byte, options ...rawkv.RawOption) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return cloneBytes(m.get(string(key))), nil
+}
+
+// BatchGet returns the values of keys in the same order, with nil for the missing ones.
+func (m *memoryKV) BatchGet(ctx context.Context, keys [][]byte, options ...rawkv.RawOption) ([][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i] = cloneBytes(m.get(string(key)))
+	}
+	return values, nil
+}
+
+// Put stores value under key without a TTL.
+func (m *memoryKV) Put(ctx context.Context, key []byte, value []byte, options ...rawkv.RawOption) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.put(string(key), value)
+	return nil
+}
+
+// PutWithTTL stores value under key, to expire after ttl seconds. A zero ttl never expires, as in TiKV.
+func (m *memoryKV) PutWithTTL(ctx context.Context, key []byte, value []byte, ttl uint64, options ...rawkv.RawOption) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.put(string(key), value)
+	if ttl > 0 {
+		m.expires[string(key)] = time.Now().Add(time.Duration(ttl) * time.Second)
+	}
+	return nil
+}
+
+// Delete removes key. Deleting a missing key is not an error.
+func (m *memoryKV) Delete(ctx context.Context, key []byte, options ...rawkv.RawOption) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.values, string(key))
+	delete(m.expires, string(key))
+	return nil
+}
+
+// Scan returns up to limit keys in [startKey, endKey) in ascending order, with their values.
+// An empty endKey means no upper bound.
+func (m *memoryKV) Scan(ctx context.Context, startKey []byte, endKey []byte, limit int, options ...rawkv.RawOption) ([][]byte, [][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.scan(startKey, endKey, limit, false)
+}
+
+// ReverseScan returns up to limit keys in [endKey, startKey) in descending order, with their values.
+// An empty startKey means no upper bound.
+func (m *memoryKV) ReverseScan(ctx context.Context, startKey []byte, endKey []byte, limit int, options ...rawkv.RawOption) ([][]byte, [][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.scan(endKey, startKey, limit, true)
+}
+
+// scan returns up to limit live keys in [lower, upper), in descending order when reverse is set. The caller holds m.mu.
+func (m *memoryKV) scan(lower, upper []byte, limit int, reverse bool) ([][]byte, [][]byte, error) {
+	var keys []string
+	for key := range m.values {
+		if key < string(lower) || (len(upper) > 0 && key >= string(upper)) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if reverse {
+		sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	} else {
+		sort.Strings(keys)
+	}
+
+	var rawKeys, values [][]byte
+	for _, key := range keys {
+		if len(rawKeys) == limit {
+			break
+		}
+		value := m.get(key)
+		if value == nil {
+			continue
+		}
+		rawKeys = append(rawKeys, []byte(key))
+		values = append(values, cloneBytes(value))
+	}
+	return rawKeys, values, nil
+}
+
+// CompareAndSwap stores newValue under key if its current value equals previousValue, where nil means missing.
+// It returns the value found and whether the swap happened.
+func (m *memoryKV) CompareAndSwap(ctx context.Context, key, previousValue, newValue []byte, options ...rawkv.RawOption) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current := m.get(string(key))
+	if (current == nil) != (previousValue == nil) || !bytes.Equal(current, previousValue) {
+		return cloneBytes(current), false, nil
+	}
+	m.put(string(key), newValue)
+	return cloneBytes(current), true, nil
+}
+
+// cloneBytes returns a copy of b, keeping nil and empty apart, so callers never share the store's slices.
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Scans honour their bounds, limit and direction, and an empty end key is unbounded
+func TestMemoryKVScan(t *testing.T) {
+	m := newMemoryStore()
+	for _, key := range []string{"blob:1", "blob:2", "blob:3", "meta:1"} {
+		assert.NoError(t, m.Put(ctx, []byte(key), []byte("v"+key)))
+	}
+
+	keys, values, err := m.Scan(ctx, blobStart, blobEnd, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("blob:1"), []byte("blob:2")}, keys)
+	assert.Equal(t, [][]byte{[]byte("vblob:1"), []byte("vblob:2")}, values)
+
+	keys, _, _ = m.Scan(ctx, []byte("blob:2"), nil, 10)
+	assert.Equal(t, [][]byte{[]byte("blob:2"), []byte("blob:3"), []byte("meta:1")}, keys)
+
+	keys, _, _ = m.ReverseScan(ctx, blobEnd, blobStart, 10)
+	assert.Equal(t, [][]byte{[]byte("blob:3"), []byte("blob:2"), []byte("blob:1")}, keys)
+
+	keys, _, _ = m.ReverseScan(ctx, []byte("blob:3"), blobStart, 1)
+	assert.Equal(t, [][]byte{[]byte("blob:2")}, keys)
+}
+
+// Get, BatchGet and Delete see the same keys, and values are copied in and out
+func TestMemoryKVGetPutDelete(t *testing.T) {
+	m := newMemoryStore()
+	value := []byte("hello")
+	assert.NoError(t, m.Put(ctx, []byte("blob:1"), value))
+	value[0] = 'j'
+
+	got, err := m.Get(ctx, []byte("blob:1"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), got)
+
+	values, err := m.BatchGet(ctx, [][]byte{[]byte("blob:2"), []byte("blob:1")})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{nil, []byte("hello")}, values)
+
+	assert.NoError(t, m.Delete(ctx, []byte("blob:1")))
+	got, _ = m.Get(ctx, []byte("blob:1"))
+	assert.Nil(t, got)
+}
+
+// An expired key reads as missing and is left out of scans, while a zero TTL never expires
+func TestMemoryKVTTL(t *testing.T) {
+	m := newMemoryStore()
+	assert.NoError(t, m.PutWithTTL(ctx, []byte("blob:1"), []byte("old"), 60))
+	assert.NoError(t, m.PutWithTTL(ctx, []byte("blob:2"), []byte("kept"), 0))
+	m.expires["blob:1"] = time.Now().Add(-time.Second)
+
+	got, _ := m.Get(ctx, []byte("blob:1"))
+	assert.Nil(t, got)
+	keys, _, _ := m.Scan(ctx, blobStart, blobEnd, 10)
+	assert.Equal(t, [][]byte{[]byte("blob:2")}, keys)
+}
+
+// CompareAndSwap only swaps when the current value matches, with nil meaning missing
+func TestMemoryKVCompareAndSwap(t *testing.T) {
+	m := newMemoryStore()
+
+	previous, swapped, err := m.CompareAndSwap(ctx, []byte("blob:1"), nil, []byte("first"))
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+	assert.Nil(t, previous)
+
+	previous, swapped, _ = m.CompareAndSwap(ctx, []byte("blob:1"), nil, []byte("second"))
+	assert.False(t, swapped)
+	assert.Equal(t, []byte("first"), previous)
+
+	_, swapped, _ = m.CompareAndSwap(ctx, []byte("blob:1"), []byte("first"), []byte("second"))
+	assert.True(t, swapped)
+	got, _ := m.Get(ctx, []byte("blob:1"))
+	assert.Equal(t, []byte("second"), got)
+}
+
+// With STORAGE_MODE=memory the pool is filled with the shared store and no TiKV client is created
+func TestSetupClientPoolMemoryMode(t *testing.T) {
+	defer func(old string) { storageMode = old }(storageMode)
+	storageMode = StorageModeMemory
+	calls := fakeClientFactory(t)
+
+	clientPool := setupClientPool(false)
+
+	assert.Equal(t, ClientPoolSize, len(clientPool))
+	assert.Empty(t, *calls)
+	assert.Same(t, memoryStore, (<-clientPool).(*memoryKV))
+}
+
+// With STORAGE_MODE=auto a TiKV that cannot be reached at startup falls back to the in-memory store
+func TestSetupClientPoolAutoFallsBackToMemory(t *testing.T) {
+	defer func(old string) { storageMode = old }(storageMode)
+	originalPrimary, originalSecondary := pdAddrs, secondaryPDAddrs
+	defer func() { pdAddrs, secondaryPDAddrs = originalPrimary, originalSecondary }()
+	storageMode = StorageModeAuto
+	pdAddrs = []string{"primary:2379"}
+	secondaryPDAddrs = nil
+	fakeClientFactory(t, "primary:2379")
+
+	clientPool := setupClientPool(false)
+
+	assert.Equal(t, ClientPoolSize, len(clientPool))
+	assert.Equal(t, StorageModeMemory, storageMode)
+	assert.Same(t, memoryStore, (<-clientPool).(*memoryKV))
+}
+
+// The HTTP handlers work end to end against the in-memory store, with no TiKV involved
+func TestHandlersWithMemoryStore(t *testing.T) {
+	defer func(old string) { storageMode = old }(storageMode)
+	defer func(old *memoryKV) { memoryStore = old }(memoryStore)
+	storageMode = StorageModeMemory
+	memoryStore = newMemoryStore()
+	handler := withMiddleware(setupServer(setupClientPool(false)))
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/?blob=hello", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"blob":"hello"}`, w.Body.String())
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/?blob=hello", "").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/?blob=world", "").Code)
+
+	assert.JSONEq(t, `{"count":2}`, do(http.MethodGet, "/count", "").Body.String())
+	assert.JSONEq(t, `{"blobs":["hello","world"]}`, do(http.MethodGet, "/all", "").Body.String())
+	assert.JSONEq(t, `{"blobs":["world"]}`, do(http.MethodGet, "/search?regex=%5Ewor", "").Body.String())
+
+	var recent struct {
+		Blobs []map[string]string `json:"blobs"`
+	}
+	assert.NoError(t, json.Unmarshal(do(http.MethodGet, "/blobs?action=recent", "").Body.Bytes(), &recent))
+	assert.Len(t, recent.Blobs, 2)
+	assert.Equal(t, "hello", recent.Blobs[1]["blob"])
+	id := recent.Blobs[1]["id"]
+
+	assert.JSONEq(t, `{"blob":"hello"}`, do(http.MethodGet, "/blobs/"+id, "").Body.String())
+	assert.JSONEq(t, `{"exists":true}`, do(http.MethodGet, "/blobs/"+id+"/exists", "").Body.String())
+	assert.JSONEq(t, `{"blobs":{"`+id+`":"hello"},"missing":["nope"]}`,
+		do(http.MethodPost, "/blobs?action=getMany", `{"ids":["`+id+`","nope"]}`).Body.String())
+	assert.JSONEq(t, `{"id":"`+id+`","blob":"hello"}`, do(http.MethodGet, "/first", "").Body.String())
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPut, "/hello?newBlob=there", "").Code)
+	assert.JSONEq(t, `{"blob":"there"}`, do(http.MethodGet, "/blobs/"+id, "").Body.String())
+
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/?blob=world", "").Code)
+	assert.JSONEq(t, `{"blobs":["there"]}`, do(http.MethodGet, "/all", "").Body.String())
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/blobs/nope", "").Code)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// blobMeta is the metadata kept next to a blob with SPLIT_METADATA, so the value itself stays exactly as written.
+type blobMeta struct {
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+	Size    int       `json:"size"`
+}
+
+// metaKey returns the key under which the metadata of the blob stored at key is kept.
+// Metadata keys live outside the "blob:" range, so they are never listed, counted or picked as random blobs.
+func metaKey(key []byte) []byte {
+	return []byte("meta:" + strings.TrimPrefix(string(key), "blob:"))
+}
+
+// getMeta returns the metadata of the blob stored at key, or nil if it has none.
+func getMeta(ctx context.Context, client RawKVClientInterface, key []byte) (*blobMeta, error) {
+	raw, err := client.Get(ctx, metaKey(key))
+	if err != nil || raw == nil {
+		return nil, err
+	}
+	var meta blobMeta
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// putMeta stores meta for the blob stored at key, with the same TTL as the blob.
+func putMeta(ctx context.Context, client RawKVClientInterface, key []byte, meta *blobMeta) error {
+	raw, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return putBlob(ctx, client, metaKey(key), raw)
+}
+
+// recordMeta writes the metadata of value, just stored at newKey, when SPLIT_METADATA is on, and its checksum
+// when STORE_CHECKSUMS is on. oldKey is where the blob was stored before, or nil for a new blob. Its creation time
+// is carried over, and its metadata is deleted if the blob moved to a different key.
+func recordMeta(ctx context.Context, client RawKVClientInterface, oldKey, newKey []byte, value []byte) error {
+	if err := recordChecksum(ctx, client, oldKey, newKey, value); err != nil {
+		return err
+	}
+	if !splitMetadata {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	meta := &blobMeta{Created: now, Updated: now, Size: len(value)}
+	if oldKey != nil {
+		old, err := getMeta(ctx, client, oldKey)
+		if err != nil {
+			return err
+		}
+		if old != nil {
+			meta.Created = old.Created
+		}
+	}
+	if err := putMeta(ctx, client, newKey, meta); err != nil {
+		return err
+	}
+	if oldKey != nil && string(oldKey) != string(newKey) {
+		return client.Delete(ctx, metaKey(oldKey))
+	}
+	return nil
+}
+
+// deleteMeta deletes the metadata of the blob stored at key when SPLIT_METADATA is on, and its checksum
+// when STORE_CHECKSUMS is on.
+func deleteMeta(ctx context.Context, client RawKVClientInterface, key []byte) error {
+	if storeChecksums {
+		if err := client.Delete(ctx, sumKey(key)); err != nil {
+			return err
+		}
+	}
+	if !splitMetadata {
+		return nil
+	}
+	return client.Delete(ctx, metaKey(key))
+}
+
+// touchMeta rewrites the metadata and checksum of the blob stored at key so that they get the same fresh TTL as the blob.
+func touchMeta(ctx context.Context, client RawKVClientInterface, key []byte) error {
+	if storeChecksums {
+		sum, err := client.Get(ctx, sumKey(key))
+		if err != nil {
+			return err
+		}
+		if sum != nil {
+			if err := putBlob(ctx, client, sumKey(key), sum); err != nil {
+				return err
+			}
+		}
+	}
+	if !splitMetadata {
+		return nil
+	}
+	meta, err := getMeta(ctx, client, key)
+	if err != nil || meta == nil {
+		return err
+	}
+	return putMeta(ctx, client, key, meta)
+}
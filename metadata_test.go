@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// blobKeyOf returns the single "blob:" key in store.
+func blobKeyOf(t *testing.T, store map[string]string) string {
+	var found []string
+	for key := range store {
+		if strings.HasPrefix(key, "blob:") {
+			found = append(found, key)
+		}
+	}
+	assert.Len(t, found, 1)
+	return found[0]
+}
+
+// With SPLIT_METADATA a write stores the raw value and its metadata under separate keys
+func TestSplitMetadataWrite(t *testing.T) {
+	defer func(old bool) { splitMetadata = old }(splitMetadata)
+	splitMetadata = true
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=hello", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	key := blobKeyOf(t, store)
+	assert.Equal(t, "hello", store[key])
+	var meta blobMeta
+	assert.NoError(t, json.Unmarshal([]byte(store[string(metaKey([]byte(key)))]), &meta))
+	assert.Equal(t, 5, meta.Size)
+	assert.False(t, meta.Created.IsZero())
+	assert.Equal(t, meta.Created, meta.Updated)
+}
+
+// Without ?meta=true the blob is read on its own, with the value as stored
+func TestSplitMetadataReadValueOnly(t *testing.T) {
+	defer func(old bool) { splitMetadata = old }(splitMetadata)
+	splitMetadata = true
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "hello"
+	store["meta:1"] = `{"created":"2023-11-14T22:13:20Z","updated":"2023-11-14T22:13:20Z","size":5}`
+
+	w := httptest.NewRecorder()
+	handleGETByID(w, httptest.NewRequest(http.MethodGet, "/blobs/1", nil), mockClient, "1")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"blob":"hello"}`, w.Body.String())
+}
+
+// ?meta=true returns the metadata alongside the value
+func TestSplitMetadataReadWithMeta(t *testing.T) {
+	defer func(old bool) { splitMetadata = old }(splitMetadata)
+	splitMetadata = true
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "hello"
+	store["meta:1"] = `{"created":"2023-11-14T22:13:20Z","updated":"2023-11-15T08:00:00Z","size":5}`
+
+	w := httptest.NewRecorder()
+	handleGETByID(w, httptest.NewRequest(http.MethodGet, "/blobs/1?meta=true", nil), mockClient, "1")
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"id":"1","blob":"hello","meta":{"created":"2023-11-14T22:13:20Z","updated":"2023-11-15T08:00:00Z","size":5}}`, w.Body.String())
+}
+
+// An update keeps the creation time, and a delete removes the metadata with the blob
+func TestSplitMetadataUpdateAndDelete(t *testing.T) {
+	defer func(old bool) { splitMetadata = old }(splitMetadata)
+	splitMetadata = true
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "hello"
+	store["meta:1"] = `{"created":"2023-11-14T22:13:20Z","updated":"2023-11-14T22:13:20Z","size":5}`
+
+	w := httptest.NewRecorder()
+	handlePUT(w, httptest.NewRequest(http.MethodPut, "/hello?newBlob=hello%20again", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var meta blobMeta
+	assert.NoError(t, json.Unmarshal([]byte(store["meta:1"]), &meta))
+	assert.Equal(t, "2023-11-14T22:13:20Z", meta.Created.Format("2006-01-02T15:04:05Z07:00"))
+	assert.True(t, meta.Updated.After(meta.Created))
+	assert.Equal(t, 11, meta.Size)
+
+	w = httptest.NewRecorder()
+	handleDELETE(w, httptest.NewRequest(http.MethodDelete, "/?blob=hello%20again", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, store)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// blobSizeBytes records the size of every blob written by POST and PUT.
+// It is rebuilt by registerMetrics once the configured buckets are known.
+var blobSizeBytes = newBlobSizeHistogram(blobSizeBuckets)
+
+// newBlobSizeHistogram returns the blob size histogram with the given bucket upper bounds, in bytes.
+func newBlobSizeHistogram(buckets []float64) prometheus.Histogram {
+	return prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "tikvapi_blob_size_bytes",
+		Help:    "Size in bytes of blobs written through POST and PUT.",
+		Buckets: buckets,
+	})
+}
+
+// registerMetrics builds the metrics from the loaded configuration and registers them with the default registry,
+// which is served on /metrics. It must be called once, after loadConfig.
+func registerMetrics() {
+	blobSizeBytes = newBlobSizeHistogram(blobSizeBuckets)
+	prometheus.MustRegister(blobSizeBytes, blobsGauge, blobBytesGauge, newestBlobAgeGauge, blobsDeltaGauge, httpRequestsTotal, dedupChecksTotal)
+}
+
+// blobsGauge, blobBytesGauge, newestBlobAgeGauge and blobsDeltaGauge are set by the monitoring goroutine on every tick.
+var (
+	blobsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "tikvapi_blobs",
+		Help: "Number of stored blobs, as of the last monitoring tick.",
+	})
+	blobBytesGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "tikvapi_blob_bytes",
+		Help: "Total size in bytes of the stored blobs, as of the last monitoring tick.",
+	})
+	newestBlobAgeGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "tikvapi_newest_blob_age_seconds",
+		Help: "Age of the newest blob with a time-based key, as of the last monitoring tick.",
+	})
+	blobsDeltaGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "tikvapi_blobs_delta",
+		Help: "Change in the number of stored blobs between the last two monitoring ticks.",
+	})
+)
+
+// httpRequestsTotal counts the HTTP requests served, by response status code. It is updated by withRequestMetrics.
+var httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "tikvapi_http_requests_total",
+	Help: "Number of HTTP requests served, by status code.",
+}, []string{"code"})
+
+// dedupChecksTotal counts how POST and PUT looked for a duplicate: "lookup" is the single Get of KEY_SCHEME=content,
+// "scan" the comparison against the stored blobs that time-based keys need, and "bloom" a lookup
+// skipped because DEDUP_BLOOM_SIZE's filter has never seen the key.
+var dedupChecksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "tikvapi_dedup_checks_total",
+	Help: "Number of duplicate checks made by POST and PUT, by method.",
+}, []string{"method"})
+
+// metricsHandler serves the metrics in the Prometheus text format.
+var metricsHandler = promhttp.Handler()
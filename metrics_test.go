@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+// bucketCounts returns the cumulative count of each bucket of h, keyed by upper bound.
+func bucketCounts(t *testing.T, h prometheus.Histogram) map[float64]uint64 {
+	var m dto.Metric
+	assert.NoError(t, h.Write(&m))
+	counts := map[float64]uint64{}
+	for _, bucket := range m.GetHistogram().GetBucket() {
+		counts[bucket.GetUpperBound()] = bucket.GetCumulativeCount()
+	}
+	return counts
+}
+
+// Blobs written through POST and PUT are recorded in the size histogram
+func TestBlobSizeHistogramRecordsWrites(t *testing.T) {
+	defer func(old prometheus.Histogram) { blobSizeBytes = old }(blobSizeBytes)
+	blobSizeBytes = newBlobSizeHistogram([]float64{4, 16})
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=abc", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob="+strings.Repeat("x", 10), nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	handlePUT(w, httptest.NewRequest(http.MethodPut, "/abc?newBlob="+strings.Repeat("y", 20), nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, store, 2)
+
+	assert.Equal(t, map[float64]uint64{4: 1, 16: 2}, bucketCounts(t, blobSizeBytes))
+	var m dto.Metric
+	assert.NoError(t, blobSizeBytes.Write(&m))
+	assert.Equal(t, uint64(3), m.GetHistogram().GetSampleCount())
+	assert.Equal(t, float64(3+10+20), m.GetHistogram().GetSampleSum())
+}
+
+// Failed writes are not recorded
+func TestBlobSizeHistogramIgnoresFailedWrites(t *testing.T) {
+	defer func(old prometheus.Histogram) { blobSizeBytes = old }(blobSizeBytes)
+	blobSizeBytes = newBlobSizeHistogram([]float64{4, 16})
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil, nil)
+	mockClient.EXPECT().Put(gomock.Any(), gomock.Any(), gomock.Any()).Return(assert.AnError)
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=abc", nil), mockClient)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, map[float64]uint64{4: 0, 16: 0}, bucketCounts(t, blobSizeBytes))
+}
+
+// One monitoring tick produces the blob count, total size and newest blob age from a single scan
+func TestMonitorBlobsSetsAllGauges(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	newest := time.Now().Add(-time.Minute)
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), SearchPageSize).Return(
+		[][]byte{[]byte("blob:1700000000000000000"), []byte(fmt.Sprintf("blob:%d", newest.UnixNano()))},
+		[][]byte{[]byte("hello"), []byte("world!")},
+		nil,
+	).Times(1)
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	(&blobMonitor{}).tick(mockClient)
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(blobsGauge))
+	assert.Equal(t, float64(11), testutil.ToFloat64(blobBytesGauge))
+	assert.InDelta(t, 60, testutil.ToFloat64(newestBlobAgeGauge), 5)
+	assert.Contains(t, buf.String(), "Number of keys in TiKV: 2")
+	assert.Contains(t, buf.String(), "Total size of blobs in TiKV: 11 bytes, newest blob age: 1m0s")
+}
+
+// With MONITOR_OUTPUT=metric a tick sets the gauges but writes nothing to the log, and with log it is the other way round
+func TestMonitorOutput(t *testing.T) {
+	defer func(old string) { monitorOutput = old }(monitorOutput)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "hello"
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	monitorOutput = MonitorOutputMetric
+	blobsGauge.Set(0)
+	(&blobMonitor{}).tick(mockClient)
+	assert.Equal(t, float64(1), testutil.ToFloat64(blobsGauge))
+	assert.NotContains(t, buf.String(), "Number of keys in TiKV")
+	assert.Empty(t, buf.String())
+
+	monitorOutput = MonitorOutputLog
+	store["blob:2"] = "world"
+	(&blobMonitor{}).tick(mockClient)
+	assert.Equal(t, float64(1), testutil.ToFloat64(blobsGauge))
+	assert.Contains(t, buf.String(), "Number of keys in TiKV: 2")
+}
+
+// The change in blob count is reported from the second tick on
+func TestBlobMonitorReportsDelta(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	gomock.InOrder(
+		mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), SearchPageSize).Return(
+			[][]byte{[]byte("blob:1"), []byte("blob:2")}, nil, nil),
+		mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), SearchPageSize).Return(
+			[][]byte{[]byte("blob:1"), []byte("blob:2"), []byte("blob:3"), []byte("blob:4"), []byte("blob:5")}, nil, nil),
+		mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), SearchPageSize).Return(
+			[][]byte{[]byte("blob:5")}, nil, nil),
+	)
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	blobsDeltaGauge.Set(0)
+	monitor := &blobMonitor{}
+
+	monitor.tick(mockClient)
+	assert.NotContains(t, buf.String(), "Change in number of blobs")
+	assert.Equal(t, float64(0), testutil.ToFloat64(blobsDeltaGauge))
+
+	monitor.tick(mockClient)
+	assert.Contains(t, buf.String(), "Change in number of blobs since last check: +3")
+	assert.Equal(t, float64(3), testutil.ToFloat64(blobsDeltaGauge))
+
+	monitor.tick(mockClient)
+	assert.Contains(t, buf.String(), "Change in number of blobs since last check: -4")
+	assert.Equal(t, float64(-4), testutil.ToFloat64(blobsDeltaGauge))
+}
+
+// Repeated identical scan errors are logged once, and the number of repeats is reported on recovery
+func TestBlobMonitorSuppressesRepeatedErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	gomock.InOrder(
+		mockClient.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil, errors.New("tikv unavailable")).Times(5),
+		mockClient.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return([][]byte{[]byte("blob:1")}, nil, nil),
+	)
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	monitor := &blobMonitor{}
+
+	for i := 0; i < 5; i++ {
+		monitor.tick(mockClient)
+	}
+	assert.Equal(t, 1, strings.Count(buf.String(), "Failed to collect blob stats: tikv unavailable"))
+	assert.Equal(t, 1, strings.Count(buf.String(), "Number of keys in TiKV: -1"))
+
+	monitor.tick(mockClient)
+	assert.Contains(t, buf.String(), "Previous blob stats error repeated 4 more times: tikv unavailable")
+	assert.Contains(t, buf.String(), "Number of keys in TiKV: 1")
+}
+
+// With MONITORING_ERROR_REPEAT set, a repeated error is logged again every that many repeats
+func TestBlobMonitorRepeatsErrorPeriodically(t *testing.T) {
+	defer func(old int) { monitoringErrorRepeat = old }(monitoringErrorRepeat)
+	monitoringErrorRepeat = 2
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil, errors.New("tikv unavailable")).Times(5)
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	monitor := &blobMonitor{}
+
+	for i := 0; i < 5; i++ {
+		monitor.tick(mockClient)
+	}
+
+	assert.Equal(t, 3, strings.Count(buf.String(), "Failed to collect blob stats: tikv unavailable"))
+	assert.Contains(t, buf.String(), "(repeated 4 times)")
+}
+
+// With KEY_SCHEME=content, POST checks for a duplicate with a single Get and never scans
+func TestDedupChecksContentSchemeSkipsScan(t *testing.T) {
+	defer func(old string) { keyScheme = old }(keyScheme)
+	keyScheme = KeySchemeContent
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+	mockClient.EXPECT().Get(gomock.Any(), contentKey("hello")).Return(nil, nil)
+	mockClient.EXPECT().Put(gomock.Any(), contentKey("hello"), []byte("hello")).Return(nil)
+	lookups := testutil.ToFloat64(dedupChecksTotal.WithLabelValues("lookup"))
+	scans := testutil.ToFloat64(dedupChecksTotal.WithLabelValues("scan"))
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=hello", nil), mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, lookups+1, testutil.ToFloat64(dedupChecksTotal.WithLabelValues("lookup")))
+	assert.Equal(t, scans, testutil.ToFloat64(dedupChecksTotal.WithLabelValues("scan")))
+}
+
+// Time-based keys fall back to the scan, which is counted as such
+func TestDedupChecksTimeSchemeScans(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, _ := newMemoryClient(ctrl)
+	lookups := testutil.ToFloat64(dedupChecksTotal.WithLabelValues("lookup"))
+	scans := testutil.ToFloat64(dedupChecksTotal.WithLabelValues("scan"))
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=hello", nil), mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, lookups, testutil.ToFloat64(dedupChecksTotal.WithLabelValues("lookup")))
+	assert.Equal(t, scans+1, testutil.ToFloat64(dedupChecksTotal.WithLabelValues("scan")))
+}
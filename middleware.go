@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// compressors maps each supported content coding to a constructor for its encoder.
+var compressors = map[string]func(w io.Writer) io.WriteCloser{
+	"gzip": func(w io.Writer) io.WriteCloser {
+		return gzip.NewWriter(w)
+	},
+	"deflate": func(w io.Writer) io.WriteCloser {
+		fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+		return fw
+	},
+	"br": func(w io.Writer) io.WriteCloser {
+		return brotli.NewWriter(w)
+	},
+}
+
+// withCompression wraps next so that responses are compressed with the best coding the client accepts
+// out of compressionAlgorithms. Bodies smaller than compressionMinSize are sent as they are.
+func withCompression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(compressionAlgorithms) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), compressionAlgorithms)
+		// Upgraded connections such as WebSockets need the raw connection, which compressWriter cannot hijack.
+		if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: compressionMinSize, status: http.StatusOK}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding picks the content coding to use for a request with the given Accept-Encoding header.
+// Codings are ranked by the client's q-values, with ties going to the earlier entry in supported.
+// It returns "" when the client accepts none of the supported codings.
+func negotiateEncoding(acceptEncoding string, supported []string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+
+	accepted := map[string]float64{}
+	wildcard := -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if coding == "*" {
+			wildcard = q
+		} else if coding != "" {
+			accepted[coding] = q
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, coding := range supported {
+		q, ok := accepted[coding]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the start of a response until it knows whether the body reaches the size threshold.
+// Once it does, the headers are sent with Content-Encoding set and the rest of the body is streamed through the encoder.
+// Smaller bodies are flushed uncompressed by Close.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	minSize     int
+	status      int
+	buf         []byte
+	encoder     io.WriteCloser
+	passthrough bool
+	wroteHeader bool
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+	// Empty responses, bodies the handler already encoded itself and gzip archives are never compressed.
+	if status == http.StatusNoContent || status == http.StatusNotModified || w.Header().Get("Content-Encoding") != "" ||
+		w.Header().Get("Content-Type") == "application/gzip" {
+		w.passthrough = true
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) < w.minSize {
+		return len(b), nil
+	}
+
+	w.Header().Set("Content-Encoding", w.encoding)
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+	w.encoder = compressors[w.encoding](w.ResponseWriter)
+	if _, err := w.encoder.Write(w.buf); err != nil {
+		return 0, err
+	}
+	w.buf = nil
+	return len(b), nil
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController and wantsPrettyJSON.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Close flushes whatever is still buffered, finishing the compressed stream if one was started.
+func (w *compressWriter) Close() error {
+	if w.encoder != nil {
+		return w.encoder.Close()
+	}
+	if w.passthrough {
+		return nil
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) > 0 {
+		_, err := w.ResponseWriter.Write(w.buf)
+		return err
+	}
+	return nil
+}
+
+// withContentTypeCheck rejects write requests whose body is not one of writeContentTypes with 415 Unsupported Media Type.
+// Requests without a body, such as the legacy query-parameter form of POST and PUT, are let through unchecked.
+func withContentTypeCheck(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		isWrite := r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch
+		if !isWrite || r.ContentLength == 0 || len(writeContentTypes) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err == nil {
+			for _, allowed := range writeContentTypes {
+				if strings.EqualFold(mediaType, allowed) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+
+		writeError(w, http.StatusUnsupportedMediaType, "Unsupported Content-Type")
+		log.Printf("Unsupported Content-Type: %q", r.Header.Get("Content-Type"))
+	})
+}
+
+// prettyJSONWriter marks a response whose JSON body should be indented. writeJSON looks for it with wantsPrettyJSON.
+type prettyJSONWriter struct {
+	http.ResponseWriter
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (w *prettyJSONWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack hands over the connection for WebSocket upgrades of requests with ?pretty=true.
+func (w *prettyJSONWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// withPrettyJSON makes writeJSON indent its output for requests with ?pretty=true, for reading responses with curl.
+// Other requests get compact JSON as before.
+func withPrettyJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty")); pretty {
+			w = &prettyJSONWriter{ResponseWriter: w}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// wantsPrettyJSON reports whether w, or any writer it wraps, was marked by withPrettyJSON.
+func wantsPrettyJSON(w http.ResponseWriter) bool {
+	for {
+		switch wrapped := w.(type) {
+		case *prettyJSONWriter:
+			return true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = wrapped.Unwrap()
+		default:
+			return false
+		}
+	}
+}
+
+// maxRequestIDLength is the longest X-Request-ID accepted from a client. Longer or non-printable ones are replaced.
+const maxRequestIDLength = 128
+
+// requestIDWriter carries the ID withRequestID assigned to a request. writeError looks for it with requestID.
+type requestIDWriter struct {
+	http.ResponseWriter
+	id string
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (w *requestIDWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack hands over the connection for WebSocket upgrades, which look for http.Hijacker on the writer itself
+// rather than going through http.ResponseController.
+func (w *requestIDWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// withRequestID gives every request an ID, taken from its X-Request-ID header or generated,
+// and echoes it in the X-Request-ID response header so clients can quote it when reporting a problem.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(&requestIDWriter{ResponseWriter: w, id: id}, r)
+	})
+}
+
+// validRequestID reports whether a client-supplied request ID is safe to log and echo back.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 16-byte ID in hex.
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("Failed to generate request ID: %v", err)
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestID returns the ID withRequestID assigned to the request w answers, or "" if there is none.
+func requestID(w http.ResponseWriter) string {
+	for {
+		switch wrapped := w.(type) {
+		case *requestIDWriter:
+			return wrapped.id
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = wrapped.Unwrap()
+		default:
+			return ""
+		}
+	}
+}
+
+// statusRecorder remembers the status code of the response written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack hands over the connection for WebSocket upgrades, which are recorded as 101 Switching Protocols.
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// withRequestMetrics counts every request in httpRequestsTotal under the status code it was answered with.
+func withRequestMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		httpRequestsTotal.WithLabelValues(strconv.Itoa(recorder.status)).Inc()
+	})
+}
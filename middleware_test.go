@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func bodyHandler(body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	})
+}
+
+// Each supported algorithm is negotiated and produces a decodable body
+func TestWithCompressionNegotiatesAlgorithms(t *testing.T) {
+	body := strings.Repeat("blob ", 500)
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"deflate": func(r io.Reader) (io.Reader, error) {
+			return flate.NewReader(r), nil
+		},
+		"br": func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+	}
+
+	for encoding, decode := range decoders {
+		t.Run(encoding, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", encoding)
+			w := httptest.NewRecorder()
+
+			withCompression(bodyHandler(body)).ServeHTTP(w, req)
+
+			assert.Equal(t, encoding, w.Header().Get("Content-Encoding"))
+			assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+			reader, err := decode(w.Body)
+			assert.NoError(t, err)
+			decoded, err := io.ReadAll(reader)
+			assert.NoError(t, err)
+			assert.Equal(t, body, string(decoded))
+		})
+	}
+}
+
+// Bodies below the threshold are left uncompressed
+func TestWithCompressionSkipsSmallBodies(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+	w := httptest.NewRecorder()
+
+	withCompression(bodyHandler(`{"blob":"small"}`)).ServeHTTP(w, req)
+
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	assert.Equal(t, `{"blob":"small"}`, w.Body.String())
+}
+
+// Clients that don't send Accept-Encoding get the plain body
+func TestWithCompressionWithoutAcceptEncoding(t *testing.T) {
+	body := strings.Repeat("blob ", 500)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+
+	withCompression(bodyHandler(body)).ServeHTTP(w, req)
+
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, body, w.Body.String())
+}
+
+// Status codes are preserved on compressed and uncompressed responses
+func TestWithCompressionPreservesStatus(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Blob not found", http.StatusNotFound)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+
+	withCompression(handler).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "Blob not found\n", w.Body.String())
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	supported := []string{"gzip", "deflate", "br"}
+	tests := []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"br, gzip", "gzip"},
+		{"br;q=1.0, gzip;q=0.5", "br"},
+		{"gzip;q=0, deflate", "deflate"},
+		{"*", "gzip"},
+		{"*;q=0.1, br", "br"},
+		{"GZIP", "gzip"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, negotiateEncoding(test.acceptEncoding, supported), test.acceptEncoding)
+	}
+}
+
+func okHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// A write with a non-JSON body is rejected with 415
+func TestWithContentTypeCheckRejectsWrongType(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("blob=hello"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	withContentTypeCheck(okHandler()).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+}
+
+// A write with a JSON body is accepted, including media type parameters
+func TestWithContentTypeCheckAcceptsJSON(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"blob":"hello"}`))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	w := httptest.NewRecorder()
+
+	withContentTypeCheck(okHandler()).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// A write with a body but no Content-Type is rejected
+func TestWithContentTypeCheckRejectsMissingType(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"blob":"hello"}`))
+	w := httptest.NewRecorder()
+
+	withContentTypeCheck(okHandler()).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+}
+
+// The legacy query-parameter form has no body and is not checked
+func TestWithContentTypeCheckAllowsQueryParamWrites(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/?blob=hello", nil)
+	w := httptest.NewRecorder()
+
+	withContentTypeCheck(okHandler()).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// Configured media types replace the JSON default
+func TestWithContentTypeCheckHonorsConfiguredTypes(t *testing.T) {
+	writeContentTypes = []string{"text/plain"}
+	defer func() { writeContentTypes = []string{"application/json"} }()
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hello"))
+	req.Header.Set("Content-Type", "text/plain")
+	w := httptest.NewRecorder()
+
+	withContentTypeCheck(okHandler()).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// ?pretty=true indents JSON written by handlers, also through the compression and retry wrappers
+func TestWithPrettyJSON(t *testing.T) {
+	handler := withCompression(withPrettyJSON(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(&retryHeaderWriter{ResponseWriter: w, retries: new(atomic.Int64)}, http.StatusOK, map[string]string{"blob": "value"})
+	})))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?pretty=true", nil))
+	assert.Equal(t, "{\n  \"blob\": \"value\"\n}", w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, `{"blob":"value"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?pretty=false", nil))
+	assert.Equal(t, `{"blob":"value"}`, w.Body.String())
+}
+
+// A server error carries the request ID in the body, the response header and the log
+func TestWithRequestIDInServerError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := NewMockRawKVClientInterface(ctrl)
+	client.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil, assert.AnError)
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	handler := withRequestID(withCompression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleGETAll(w, r, client)
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/all", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "req-42", w.Header().Get("X-Request-ID"))
+	assert.JSONEq(t, `{"error":"Failed to retrieve blobs","requestId":"req-42"}`, w.Body.String())
+	assert.Contains(t, buf.String(), "Request req-42 failed with 500")
+}
+
+// A missing or invalid X-Request-ID is replaced with a generated one
+func TestWithRequestIDGeneratesID(t *testing.T) {
+	handler := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "Blob not found")
+	}))
+
+	for _, header := range []string{"", "has space", strings.Repeat("x", maxRequestIDLength+1)} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Request-ID", header)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		id := w.Header().Get("X-Request-ID")
+		assert.Len(t, id, 32)
+		assert.JSONEq(t, `{"error":"Blob not found","requestId":"`+id+`"}`, w.Body.String())
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// MaxMigrateBatch caps ?limit= for POST /admin/migrate-keys.
+const MaxMigrateBatch = 1000
+
+// handlePOSTMigrateKeys rewrites one batch of time-based blobs under their content-addressed keys, for stores
+// that switched to KEY_SCHEME=content. Blobs already under a content key are left alone, and a blob whose content key
+// is taken is counted as a duplicate rather than written again, so the migration can be re-run safely.
+// With ?delete=true the time-based key, and its metadata, are deleted once the blob is in place under its content key.
+// With BLOB_COUNTER each key written or deleted adjusts the counter, so a duplicate collapsing into its content key
+// counts as one blob fewer.
+// The response reports the batch and, if more keys remain, a cursor to pass back as ?cursor= for the next batch.
+// Content keys share the "blob:" range with time-based ones, so later batches also pass over blobs migrated earlier.
+func handlePOSTMigrateKeys(w http.ResponseWriter, r *http.Request, client RawKVClientInterface) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	if keyScheme != KeySchemeContent {
+		writeError(w, http.StatusBadRequest, "Key migration needs KEY_SCHEME=content")
+		log.Println("Key migration requested but KEY_SCHEME is not content")
+		return
+	}
+
+	query := r.URL.Query()
+	startKey := blobStart
+	if cursor := query.Get("cursor"); cursor != "" {
+		if !strings.HasPrefix(cursor, "blob:") {
+			writeError(w, http.StatusBadRequest, "Invalid cursor")
+			log.Printf("Invalid cursor: %q", cursor)
+			return
+		}
+		startKey = []byte(cursor)
+	}
+	limit := SearchPageSize
+	if raw := query.Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			writeError(w, http.StatusBadRequest, "Invalid limit")
+			log.Printf("Invalid limit: %q", raw)
+			return
+		}
+	}
+	if limit > MaxMigrateBatch {
+		limit = MaxMigrateBatch
+	}
+	deleteOld, _ := strconv.ParseBool(query.Get("delete"))
+
+	// Fetch one extra key to find out whether anything is left after this batch.
+	keys, values, err := client.Scan(r.Context(), startKey, blobEnd, limit+1)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve blobs")
+		log.Printf("Failed to retrieve blobs: %v", err)
+		return
+	}
+	var nextCursor string
+	if len(keys) > limit {
+		nextCursor = string(keys[limit])
+		keys = keys[:limit]
+	}
+
+	migrated, duplicates, deleted := 0, 0, 0
+	for i, key := range keys {
+		if _, ok := blobCreated(strings.TrimPrefix(string(key), "blob:")); !ok {
+			continue
+		}
+		newKey := contentKey(string(values[i]))
+		existing, err := client.Get(r.Context(), newKey)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to retrieve blob")
+			log.Printf("Failed to retrieve blob: %v", err)
+			return
+		}
+		if existing != nil {
+			duplicates++
+		} else {
+			if err := putBlob(r.Context(), client, newKey, values[i]); err != nil {
+				writeError(w, http.StatusInternalServerError, "Failed to save blob")
+				log.Printf("Failed to save blob: %v", err)
+				return
+			}
+			dedupBloom.add(newKey)
+			adjustBlobCount(r.Context(), client, 1)
+			if err := copyMeta(r, client, key, newKey); err != nil {
+				writeError(w, http.StatusInternalServerError, "Failed to save blob metadata")
+				log.Printf("Failed to save blob metadata: %v", err)
+				return
+			}
+			migrated++
+		}
+
+		if deleteOld {
+			if err := client.Delete(r.Context(), key); err != nil {
+				writeError(w, http.StatusInternalServerError, "Failed to delete blob")
+				log.Printf("Failed to delete blob: %v", err)
+				return
+			}
+			adjustBlobCount(r.Context(), client, -1)
+			if err := deleteMeta(r.Context(), client, key); err != nil {
+				writeError(w, http.StatusInternalServerError, "Failed to delete blob metadata")
+				log.Printf("Failed to delete blob metadata: %v", err)
+				return
+			}
+			deleted++
+		}
+	}
+	log.Printf("Migrated %d blobs to content keys, %d duplicates, %d old keys deleted", migrated, duplicates, deleted)
+
+	resp := map[string]interface{}{"migrated": migrated, "duplicates": duplicates, "deleted": deleted, "done": nextCursor == ""}
+	if nextCursor != "" {
+		resp["cursor"] = nextCursor
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// copyMeta copies the metadata of the blob at key to newKey when SPLIT_METADATA is on, keeping its creation time.
+func copyMeta(r *http.Request, client RawKVClientInterface, key, newKey []byte) error {
+	if !splitMetadata {
+		return nil
+	}
+	meta, err := getMeta(r.Context(), client, key)
+	if err != nil || meta == nil {
+		return err
+	}
+	return putMeta(r.Context(), client, newKey, meta)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+type migrateResponse struct {
+	Migrated   int    `json:"migrated"`
+	Duplicates int    `json:"duplicates"`
+	Deleted    int    `json:"deleted"`
+	Done       bool   `json:"done"`
+	Cursor     string `json:"cursor"`
+}
+
+func migrate(t *testing.T, client RawKVClientInterface, query string) migrateResponse {
+	w := httptest.NewRecorder()
+	handlePOSTMigrateKeys(w, httptest.NewRequest(http.MethodPost, "/admin/migrate-keys"+query, nil), client)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp migrateResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+// Time-based blobs are moved to their content keys batch by batch, and every blob can be found by content afterwards
+func TestMigrateKeysToContentScheme(t *testing.T) {
+	defer func(old string) { keyScheme = old }(keyScheme)
+	keyScheme = KeySchemeContent
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1700000000000000001"] = "one"
+	store["blob:1700000000000000002"] = "two"
+	store["blob:1700000000000000003"] = "three"
+
+	first := migrate(t, mockClient, "?limit=2&delete=true")
+	assert.Equal(t, migrateResponse{Migrated: 2, Deleted: 2, Cursor: "blob:1700000000000000003"}, first)
+
+	// Content keys written by earlier batches can sort after the cursor and are skipped on the way.
+	migrated, cursor := first.Migrated, first.Cursor
+	for i := 0; cursor != "" && i < 10; i++ {
+		next := migrate(t, mockClient, "?limit=2&delete=true&cursor="+cursor)
+		migrated += next.Migrated
+		cursor = next.Cursor
+	}
+	assert.Equal(t, 3, migrated)
+	assert.Empty(t, cursor)
+
+	assert.Len(t, store, 3)
+	for _, blob := range []string{"one", "two", "three"} {
+		assert.Equal(t, blob, store[string(contentKey(blob))])
+	}
+	for key := range store {
+		_, legacy := blobCreated(strings.TrimPrefix(key, "blob:"))
+		assert.False(t, legacy, key)
+	}
+}
+
+// Running the migration again only finds duplicates, and without delete the old keys stay readable
+func TestMigrateKeysIsIdempotent(t *testing.T) {
+	defer func(old string) { keyScheme = old }(keyScheme)
+	keyScheme = KeySchemeContent
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1700000000000000001"] = "one"
+	store["blob:1700000000000000002"] = "two"
+
+	assert.Equal(t, 2, migrate(t, mockClient, "").Migrated)
+	again := migrate(t, mockClient, "")
+
+	assert.Equal(t, migrateResponse{Duplicates: 2, Done: true}, again)
+	assert.Len(t, store, 4)
+	assert.Equal(t, "one", store["blob:1700000000000000001"])
+	assert.Equal(t, "one", store[string(contentKey("one"))])
+}
+
+// The migration is refused unless the store uses content keys
+func TestMigrateKeysNeedsContentScheme(t *testing.T) {
+	w := httptest.NewRecorder()
+	handlePOSTMigrateKeys(w, httptest.NewRequest(http.MethodPost, "/admin/migrate-keys", nil), nil)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// With BLOB_COUNTER, migrating counts each new content key, and deleting old keys counts collapsed duplicates
+func TestMigrateKeysAdjustsBlobCounter(t *testing.T) {
+	defer func(old string) { keyScheme = old }(keyScheme)
+	defer func(old bool) { blobCounter = old }(blobCounter)
+	keyScheme = KeySchemeContent
+	blobCounter = true
+
+	client := newMemoryStore()
+	client.Put(ctx, []byte("blob:1700000000000000001"), []byte("one"))
+	client.Put(ctx, []byte("blob:1700000000000000002"), []byte("one"))
+	client.Put(ctx, []byte("blob:1700000000000000003"), []byte("two"))
+	assert.Equal(t, 3, storedBlobCount(ctx, client))
+
+	assert.Equal(t, migrateResponse{Migrated: 2, Duplicates: 1, Done: true}, migrate(t, client, ""))
+	assert.Equal(t, "5", string(client.values[string(blobCountKey)]))
+
+	assert.Equal(t, migrateResponse{Duplicates: 3, Deleted: 3, Done: true}, migrate(t, client, "?delete=true"))
+	assert.Equal(t, "2", string(client.values[string(blobCountKey)]))
+	rebuilt, err := rebuildBlobCount(ctx, client)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rebuilt)
+}
@@ -35,6 +35,47 @@ func (m *MockRawKVClientInterface) EXPECT() *MockRawKVClientInterfaceMockRecorde
 	return m.recorder
 }
 
+// BatchGet mocks base method.
+func (m *MockRawKVClientInterface) BatchGet(ctx context.Context, keys [][]byte, options ...rawkv.RawOption) ([][]byte, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, keys}
+	for _, a := range options {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "BatchGet", varargs...)
+	ret0, _ := ret[0].([][]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BatchGet indicates an expected call of BatchGet.
+func (mr *MockRawKVClientInterfaceMockRecorder) BatchGet(ctx, keys interface{}, options ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, keys}, options...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BatchGet", reflect.TypeOf((*MockRawKVClientInterface)(nil).BatchGet), varargs...)
+}
+
+// CompareAndSwap mocks base method.
+func (m *MockRawKVClientInterface) CompareAndSwap(ctx context.Context, key, previousValue, newValue []byte, options ...rawkv.RawOption) ([]byte, bool, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, key, previousValue, newValue}
+	for _, a := range options {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "CompareAndSwap", varargs...)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// CompareAndSwap indicates an expected call of CompareAndSwap.
+func (mr *MockRawKVClientInterfaceMockRecorder) CompareAndSwap(ctx, key, previousValue, newValue interface{}, options ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, key, previousValue, newValue}, options...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompareAndSwap", reflect.TypeOf((*MockRawKVClientInterface)(nil).CompareAndSwap), varargs...)
+}
+
 // Delete mocks base method.
 func (m *MockRawKVClientInterface) Delete(ctx context.Context, key []byte, options ...rawkv.RawOption) error {
 	m.ctrl.T.Helper()
@@ -93,6 +134,46 @@ func (mr *MockRawKVClientInterfaceMockRecorder) Put(ctx, key, value interface{},
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockRawKVClientInterface)(nil).Put), varargs...)
 }
 
+// PutWithTTL mocks base method.
+func (m *MockRawKVClientInterface) PutWithTTL(ctx context.Context, key, value []byte, ttl uint64, options ...rawkv.RawOption) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, key, value, ttl}
+	for _, a := range options {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "PutWithTTL", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PutWithTTL indicates an expected call of PutWithTTL.
+func (mr *MockRawKVClientInterfaceMockRecorder) PutWithTTL(ctx, key, value, ttl interface{}, options ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, key, value, ttl}, options...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutWithTTL", reflect.TypeOf((*MockRawKVClientInterface)(nil).PutWithTTL), varargs...)
+}
+
+// ReverseScan mocks base method.
+func (m *MockRawKVClientInterface) ReverseScan(ctx context.Context, startKey, endKey []byte, limit int, options ...rawkv.RawOption) ([][]byte, [][]byte, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, startKey, endKey, limit}
+	for _, a := range options {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ReverseScan", varargs...)
+	ret0, _ := ret[0].([][]byte)
+	ret1, _ := ret[1].([][]byte)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ReverseScan indicates an expected call of ReverseScan.
+func (mr *MockRawKVClientInterfaceMockRecorder) ReverseScan(ctx, startKey, endKey, limit interface{}, options ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, startKey, endKey, limit}, options...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReverseScan", reflect.TypeOf((*MockRawKVClientInterface)(nil).ReverseScan), varargs...)
+}
+
 // Scan mocks base method.
 func (m *MockRawKVClientInterface) Scan(ctx context.Context, startKey, endKey []byte, limit int, options ...rawkv.RawOption) ([][]byte, [][]byte, error) {
 	m.ctrl.T.Helper()
@@ -2,61 +2,305 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
 
+	tikverr "github.com/tikv/client-go/v2/error"
 	"github.com/tikv/client-go/v2/rawkv"
 )
 
 // RawKVClientInterface is an interface that wraps the rawkv.Client methods used in main.go
 type RawKVClientInterface interface {
 	Get(ctx context.Context, key []byte, options ...rawkv.RawOption) ([]byte, error)
+	BatchGet(ctx context.Context, keys [][]byte, options ...rawkv.RawOption) ([][]byte, error)
 	Put(ctx context.Context, key []byte, value []byte, options ...rawkv.RawOption) error
+	PutWithTTL(ctx context.Context, key []byte, value []byte, ttl uint64, options ...rawkv.RawOption) error
 	Delete(ctx context.Context, key []byte, options ...rawkv.RawOption) error
 	Scan(ctx context.Context, startKey []byte, endKey []byte, limit int, options ...rawkv.RawOption) ([][]byte, [][]byte, error)
+	ReverseScan(ctx context.Context, startKey []byte, endKey []byte, limit int, options ...rawkv.RawOption) ([][]byte, [][]byte, error)
+	CompareAndSwap(ctx context.Context, key, previousValue, newValue []byte, options ...rawkv.RawOption) ([]byte, bool, error)
 }
 
 // RawKVClientWrapper is a struct that wraps the rawkv.Client object and implements the RawKVClientInterface interface
+// Calls failing with a transient error are retried up to maxRetries times before the error is returned to the caller;
+// any other error is returned at once. Put and Delete are safe to repeat, as they leave the same state however often they run.
+// When retries is set, every retry is also added to that counter.
 type RawKVClientWrapper struct {
-	client RawKVClientInterface
+	client     RawKVClientInterface
+	maxRetries int
+	retries    *atomic.Int64
 }
 
+// RetryBackoff is the delay before the first retry. Each further retry waits one more step.
+const RetryBackoff = 10 * time.Millisecond
+
 // Get is a method of the RawKVClientWrapper struct that calls the Get method on the underlying rawkv.Client object
 func (r *RawKVClientWrapper) Get(ctx context.Context, key []byte, options ...rawkv.RawOption) ([]byte, error) {
-	if ctx.Err() != nil {
-		return nil, ctx.Err()
-	}
-	return r.client.Get(ctx, key, options...)
+	var value []byte
+	err := r.retry(ctx, func() error {
+		var err error
+		value, err = r.client.Get(ctx, key, options...)
+		return err
+	})
+	return value, err
+}
+
+// BatchGet is a method of the RawKVClientWrapper struct that calls the BatchGet method on the underlying rawkv.Client object
+func (r *RawKVClientWrapper) BatchGet(ctx context.Context, keys [][]byte, options ...rawkv.RawOption) ([][]byte, error) {
+	var values [][]byte
+	err := r.retry(ctx, func() error {
+		var err error
+		values, err = r.client.BatchGet(ctx, keys, options...)
+		return err
+	})
+	return values, err
 }
 
 // Put is a method of the RawKVClientWrapper struct that calls the Put method on the underlying rawkv.Client object
 func (r *RawKVClientWrapper) Put(ctx context.Context, key []byte, value []byte, options ...rawkv.RawOption) error {
-	if ctx.Err() != nil {
-		return ctx.Err()
-	}
-	return r.client.Put(ctx, key, value, options...)
+	return r.retry(ctx, func() error {
+		return r.client.Put(ctx, key, value, options...)
+	})
+}
+
+// PutWithTTL is a method of the RawKVClientWrapper struct that calls the PutWithTTL method on the underlying rawkv.Client object
+func (r *RawKVClientWrapper) PutWithTTL(ctx context.Context, key []byte, value []byte, ttl uint64, options ...rawkv.RawOption) error {
+	return r.retry(ctx, func() error {
+		return r.client.PutWithTTL(ctx, key, value, ttl, options...)
+	})
 }
 
 // Delete is a method of the RawKVClientWrapper struct that calls the Delete method on the underlying rawkv.Client object
 func (r *RawKVClientWrapper) Delete(ctx context.Context, key []byte, options ...rawkv.RawOption) error {
-	if ctx.Err() != nil {
-		return ctx.Err()
-	}
-	return r.client.Delete(ctx, key, options...)
+	return r.retry(ctx, func() error {
+		return r.client.Delete(ctx, key, options...)
+	})
 }
 
 // Scan is a method of the RawKVClientWrapper struct that calls the Scan method on the underlying rawkv.Client object
 func (r *RawKVClientWrapper) Scan(ctx context.Context, startKey []byte, endKey []byte, limit int, options ...rawkv.RawOption) ([][]byte, [][]byte, error) {
+	var keys, values [][]byte
+	err := r.retry(ctx, func() error {
+		var err error
+		keys, values, err = r.client.Scan(ctx, startKey, endKey, limit, options...)
+		return err
+	})
+	return keys, values, err
+}
+
+// ReverseScan is a method of the RawKVClientWrapper struct that calls the ReverseScan method on the underlying rawkv.Client object
+func (r *RawKVClientWrapper) ReverseScan(ctx context.Context, startKey []byte, endKey []byte, limit int, options ...rawkv.RawOption) ([][]byte, [][]byte, error) {
+	var keys, values [][]byte
+	err := r.retry(ctx, func() error {
+		var err error
+		keys, values, err = r.client.ReverseScan(ctx, startKey, endKey, limit, options...)
+		return err
+	})
+	return keys, values, err
+}
+
+// CompareAndSwap is a method of the RawKVClientWrapper struct that calls the CompareAndSwap method on the underlying rawkv.Client object
+// It is not retried: a swap that succeeded but reported an error would fail its own comparison on the retry.
+func (r *RawKVClientWrapper) CompareAndSwap(ctx context.Context, key, previousValue, newValue []byte, options ...rawkv.RawOption) ([]byte, bool, error) {
+	return r.client.CompareAndSwap(ctx, key, previousValue, newValue, options...)
+}
+
+// retry runs op, retrying it while it fails with a transient error and the retry budget allows.
+// A cancelled or expired context stops the loop and its error is returned instead.
+func (r *RawKVClientWrapper) retry(ctx context.Context, op func() error) error {
 	if ctx.Err() != nil {
-		return nil, nil, ctx.Err()
+		return ctx.Err()
+	}
+	err := op()
+	for attempt := 1; isRetryable(err) && attempt <= r.maxRetries; attempt++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * RetryBackoff):
+		}
+		if r.retries != nil {
+			r.retries.Add(1)
+		}
+		err = op()
 	}
-	return r.client.Scan(ctx, startKey, endKey, limit, options...)
+	return err
+}
+
+// transientErrors are the client errors a retry can get past, once the region, store or PD recovers.
+var transientErrors = []error{
+	tikverr.ErrTiKVServerTimeout,
+	tikverr.ErrTiKVServerBusy,
+	tikverr.ErrRegionUnavailable,
+	tikverr.ErrRegionDataNotReady,
+	tikverr.ErrRegionNotInitialized,
+}
+
+// transientMessages mark transient failures that reach us only as text, such as region errors passed on by the client.
+var transientMessages = []string{"region", "not leader", "epoch not match", "store", "server is busy", "unavailable", "timeout", "timed out"}
+
+// isRetryable reports whether err is a transient failure of a region, store or PD that a retry may get past.
+// Context errors and entries too large are never retried, nor is anything unrecognised, which would most likely
+// fail the same way again.
+func isRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || isEntryTooLarge(err) {
+		return false
+	}
+	for _, transient := range transientErrors {
+		if errors.Is(err, transient) {
+			return true
+		}
+	}
+	var pdTimeout *tikverr.ErrPDServerTimeout
+	if errors.As(err, &pdTimeout) {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	if strings.Contains(message, "context canceled") || strings.Contains(message, "deadline exceeded") {
+		return false
+	}
+	for _, marker := range transientMessages {
+		if strings.Contains(message, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// isEntryTooLarge reports whether err is TiKV refusing a key-value entry for its size, which retrying cannot fix.
+// The client reports it either as an ErrEntryTooLarge or as a RaftEntryTooLarge region error, passed on as text.
+func isEntryTooLarge(err error) bool {
+	var tooLarge *tikverr.ErrEntryTooLarge
+	if errors.As(err, &tooLarge) {
+		return true
+	}
+	return err != nil && strings.Contains(err.Error(), "raft_entry_too_large")
 }
 
 // NewRawKVClientWrapper is a function that creates a new instance of the RawKVClientWrapper struct, wrapping the provided rawkv.Client object
 func NewRawKVClientWrapper(client RawKVClientInterface) *RawKVClientWrapper {
 	return &RawKVClientWrapper{
-		client: client,
+		client:     client,
+		maxRetries: maxRetries,
+	}
+}
+
+// withRetryCounter returns a copy of the wrapper that adds its retries to counter.
+// The copy shares the underlying client, so it can be used for a single request while the original stays in the pool.
+func (r *RawKVClientWrapper) withRetryCounter(counter *atomic.Int64) *RawKVClientWrapper {
+	counted := *r
+	counted.retries = counter
+	return &counted
+}
+
+// timeoutClient applies a per-operation deadline to every call before passing it on to client.
+// Point reads use readTimeout, writes and deletes use writeTimeout and scans use scanTimeout. A zero timeout leaves the context as it is.
+type timeoutClient struct {
+	client       RawKVClientInterface
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	scanTimeout  time.Duration
+}
+
+// withOperationTimeout returns ctx bounded by timeout, or ctx itself if timeout is zero.
+func withOperationTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
 	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Get calls Get on the underlying client bounded by the read timeout
+func (t *timeoutClient) Get(ctx context.Context, key []byte, options ...rawkv.RawOption) ([]byte, error) {
+	ctx, cancel := withOperationTimeout(ctx, t.readTimeout)
+	defer cancel()
+	return t.client.Get(ctx, key, options...)
+}
+
+// BatchGet calls BatchGet on the underlying client bounded by the read timeout
+func (t *timeoutClient) BatchGet(ctx context.Context, keys [][]byte, options ...rawkv.RawOption) ([][]byte, error) {
+	ctx, cancel := withOperationTimeout(ctx, t.readTimeout)
+	defer cancel()
+	return t.client.BatchGet(ctx, keys, options...)
+}
+
+// Put calls Put on the underlying client bounded by the write timeout
+func (t *timeoutClient) Put(ctx context.Context, key []byte, value []byte, options ...rawkv.RawOption) error {
+	ctx, cancel := withOperationTimeout(ctx, t.writeTimeout)
+	defer cancel()
+	return t.client.Put(ctx, key, value, options...)
+}
+
+// PutWithTTL calls PutWithTTL on the underlying client bounded by the write timeout
+func (t *timeoutClient) PutWithTTL(ctx context.Context, key []byte, value []byte, ttl uint64, options ...rawkv.RawOption) error {
+	ctx, cancel := withOperationTimeout(ctx, t.writeTimeout)
+	defer cancel()
+	return t.client.PutWithTTL(ctx, key, value, ttl, options...)
+}
+
+// Delete calls Delete on the underlying client bounded by the write timeout
+func (t *timeoutClient) Delete(ctx context.Context, key []byte, options ...rawkv.RawOption) error {
+	ctx, cancel := withOperationTimeout(ctx, t.writeTimeout)
+	defer cancel()
+	return t.client.Delete(ctx, key, options...)
+}
+
+// Scan calls Scan on the underlying client bounded by the scan timeout
+func (t *timeoutClient) Scan(ctx context.Context, startKey []byte, endKey []byte, limit int, options ...rawkv.RawOption) ([][]byte, [][]byte, error) {
+	ctx, cancel := withOperationTimeout(ctx, t.scanTimeout)
+	defer cancel()
+	return t.client.Scan(ctx, startKey, endKey, limit, options...)
+}
+
+// ReverseScan calls ReverseScan on the underlying client bounded by the scan timeout
+func (t *timeoutClient) ReverseScan(ctx context.Context, startKey []byte, endKey []byte, limit int, options ...rawkv.RawOption) ([][]byte, [][]byte, error) {
+	ctx, cancel := withOperationTimeout(ctx, t.scanTimeout)
+	defer cancel()
+	return t.client.ReverseScan(ctx, startKey, endKey, limit, options...)
+}
+
+// CompareAndSwap calls CompareAndSwap on the underlying client bounded by the write timeout
+func (t *timeoutClient) CompareAndSwap(ctx context.Context, key, previousValue, newValue []byte, options ...rawkv.RawOption) ([]byte, bool, error) {
+	ctx, cancel := withOperationTimeout(ctx, t.writeTimeout)
+	defer cancel()
+	return t.client.CompareAndSwap(ctx, key, previousValue, newValue, options...)
+}
+
+// readRetryClient retries the reads of client, Get, BatchGet, Scan and ReverseScan, using its own retry budget
+// rather than maxRetries. Writes are passed through unchanged, as they are not always safe to repeat.
+type readRetryClient struct {
+	RawKVClientInterface
+	reads *RawKVClientWrapper
+}
+
+// newReadRetryClient returns client with its reads retried up to retries times, each retry added to counter if it is set.
+func newReadRetryClient(client RawKVClientInterface, retries int, counter *atomic.Int64) *readRetryClient {
+	return &readRetryClient{
+		RawKVClientInterface: client,
+		reads:                &RawKVClientWrapper{client: client, maxRetries: retries, retries: counter},
+	}
+}
+
+// Get calls Get on the underlying client, retrying it on failure
+func (c *readRetryClient) Get(ctx context.Context, key []byte, options ...rawkv.RawOption) ([]byte, error) {
+	return c.reads.Get(ctx, key, options...)
+}
+
+// BatchGet calls BatchGet on the underlying client, retrying it on failure
+func (c *readRetryClient) BatchGet(ctx context.Context, keys [][]byte, options ...rawkv.RawOption) ([][]byte, error) {
+	return c.reads.BatchGet(ctx, keys, options...)
+}
+
+// Scan calls Scan on the underlying client, retrying it on failure
+func (c *readRetryClient) Scan(ctx context.Context, startKey []byte, endKey []byte, limit int, options ...rawkv.RawOption) ([][]byte, [][]byte, error) {
+	return c.reads.Scan(ctx, startKey, endKey, limit, options...)
+}
+
+// ReverseScan calls ReverseScan on the underlying client, retrying it on failure
+func (c *readRetryClient) ReverseScan(ctx context.Context, startKey []byte, endKey []byte, limit int, options ...rawkv.RawOption) ([][]byte, [][]byte, error) {
+	return c.reads.ReverseScan(ctx, startKey, endKey, limit, options...)
 }
 
 // CustomError is a struct that represents a custom error with a message and code
@@ -4,10 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"testing"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	tikverr "github.com/tikv/client-go/v2/error"
 )
 
 // Put method returns nil error
@@ -432,3 +434,163 @@ func TestPutMethodReturnsExpectedErrorWhenUnderlyingClientReturnsError(t *testin
 	assert.Error(t, err)
 	assert.Equal(t, expectedError, err)
 }
+
+// Get method retries transient failures within the retry budget
+func TestGetMethodRetriesTransientFailures(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	wrapper := &RawKVClientWrapper{client: mockClient, maxRetries: 3}
+
+	key := []byte("key")
+	gomock.InOrder(
+		mockClient.EXPECT().Get(gomock.Any(), key).Return(nil, tikverr.ErrRegionUnavailable).Times(2),
+		mockClient.EXPECT().Get(gomock.Any(), key).Return([]byte("value"), nil),
+	)
+
+	retries := new(atomic.Int64)
+	value, err := wrapper.withRetryCounter(retries).Get(context.Background(), key)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value"), value)
+	assert.Equal(t, int64(2), retries.Load())
+}
+
+// Put method gives up once the retry budget is spent
+func TestPutMethodStopsAfterRetryBudget(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	wrapper := &RawKVClientWrapper{client: mockClient, maxRetries: 2}
+
+	key := []byte("key")
+	value := []byte("value")
+	mockClient.EXPECT().Put(gomock.Any(), key, value).Return(errors.New("not leader for region 2")).Times(3)
+
+	retries := new(atomic.Int64)
+	err := wrapper.withRetryCounter(retries).Put(context.Background(), key, value)
+
+	assert.Error(t, err)
+	assert.Equal(t, int64(2), retries.Load())
+}
+
+// PutWithTTL method passes the TTL through to the underlying client
+func TestPutWithTTLMethodPassesTTL(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	wrapper := NewRawKVClientWrapper(mockClient)
+
+	key := []byte("key")
+	value := []byte("value")
+
+	mockClient.EXPECT().PutWithTTL(gomock.Any(), key, value, uint64(60)).Return(nil)
+
+	err := wrapper.PutWithTTL(context.Background(), key, value, 60)
+
+	assert.NoError(t, err)
+}
+
+// ReverseScan method returns the keys and values from the underlying client
+func TestReverseScanMethodReturnsExpectedValues(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	wrapper := NewRawKVClientWrapper(mockClient)
+
+	keys := [][]byte{[]byte("key2"), []byte("key1")}
+	values := [][]byte{[]byte("value2"), []byte("value1")}
+	mockClient.EXPECT().ReverseScan(gomock.Any(), []byte("key~"), []byte("key"), 2).Return(keys, values, nil)
+
+	gotKeys, gotValues, err := wrapper.ReverseScan(context.Background(), []byte("key~"), []byte("key"), 2)
+
+	assert.NoError(t, err)
+	assert.Equal(t, keys, gotKeys)
+	assert.Equal(t, values, gotValues)
+}
+
+// An entry TiKV refuses for its size is not retried
+func TestPutMethodDoesNotRetryEntryTooLarge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	wrapper := &RawKVClientWrapper{client: mockClient, maxRetries: 2}
+
+	key := []byte("key")
+	value := []byte("value")
+	mockClient.EXPECT().Put(gomock.Any(), key, value).Return(&tikverr.ErrEntryTooLarge{Limit: 8, Size: 5}).Times(1)
+
+	retries := new(atomic.Int64)
+	err := wrapper.withRetryCounter(retries).Put(context.Background(), key, value)
+
+	assert.True(t, isEntryTooLarge(err))
+	assert.Equal(t, int64(0), retries.Load())
+}
+
+// Both forms of the size-limit error are recognised, wrapped or not, and nothing else is
+func TestIsEntryTooLarge(t *testing.T) {
+	assert.True(t, isEntryTooLarge(&tikverr.ErrEntryTooLarge{Limit: 8, Size: 16}))
+	assert.True(t, isEntryTooLarge(fmt.Errorf("put: %w", &tikverr.ErrEntryTooLarge{Limit: 8, Size: 16})))
+	assert.True(t, isEntryTooLarge(errors.New(`message:"raft entry is too large" raft_entry_too_large:<region_id:2 entry_size:9437184 >`)))
+	assert.False(t, isEntryTooLarge(errors.New("region unavailable")))
+	assert.False(t, isEntryTooLarge(nil))
+}
+
+// An error that is not transient is returned after a single attempt
+func TestPutMethodDoesNotRetryPermanentError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	wrapper := &RawKVClientWrapper{client: mockClient, maxRetries: 3}
+
+	key := []byte("key")
+	value := []byte("value")
+	expectedError := errors.New("invalid argument")
+	mockClient.EXPECT().Put(gomock.Any(), key, value).Return(expectedError).Times(1)
+
+	retries := new(atomic.Int64)
+	err := wrapper.withRetryCounter(retries).Put(context.Background(), key, value)
+
+	assert.Equal(t, expectedError, err)
+	assert.Equal(t, int64(0), retries.Load())
+}
+
+// A cancelled context is returned after a single attempt rather than retried
+func TestGetMethodDoesNotRetryCancelledContext(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	wrapper := &RawKVClientWrapper{client: mockClient, maxRetries: 3}
+
+	key := []byte("key")
+	mockClient.EXPECT().Get(gomock.Any(), key).Return(nil, fmt.Errorf("get: %w", context.Canceled)).Times(1)
+
+	retries := new(atomic.Int64)
+	_, err := wrapper.withRetryCounter(retries).Get(context.Background(), key)
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, int64(0), retries.Load())
+}
+
+// Region, store and timeout failures are retried; context, size and unrecognised errors are not
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, isRetryable(tikverr.ErrRegionUnavailable))
+	assert.True(t, isRetryable(fmt.Errorf("get: %w", tikverr.ErrTiKVServerBusy)))
+	assert.True(t, isRetryable(&tikverr.ErrPDServerTimeout{}))
+	assert.True(t, isRetryable(errors.New("not leader for region 2")))
+	assert.True(t, isRetryable(errors.New("store 4 is unreachable")))
+	assert.True(t, isRetryable(errors.New("rpc error: code = Unavailable desc = connection refused")))
+	assert.False(t, isRetryable(context.Canceled))
+	assert.False(t, isRetryable(context.DeadlineExceeded))
+	assert.False(t, isRetryable(errors.New("rpc error: code = DeadlineExceeded desc = context deadline exceeded")))
+	assert.False(t, isRetryable(&tikverr.ErrEntryTooLarge{Limit: 8, Size: 16}))
+	assert.False(t, isRetryable(errors.New("invalid argument")))
+	assert.False(t, isRetryable(nil))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRecentBlobs is how many blobs GET /blobs?action=recent returns without ?n=.
+	DefaultRecentBlobs = 10
+	// MaxRecentBlobs caps ?n= for GET /blobs?action=recent.
+	MaxRecentBlobs = 100
+)
+
+// handleGETRecent returns the newest ?n= blobs, newest first, as {"blobs": [{"id", "blob", "created"}, ...]}.
+// It reverse scans from the end of the "blob:" range, so newest means last in key order, which only matches
+// creation time for time-based keys without KEY_PARTITIONS. n defaults to DefaultRecentBlobs and is capped at MaxRecentBlobs.
+// With INCLUDE_SIZE each entry also carries the value's length in bytes as "size".
+func handleGETRecent(w http.ResponseWriter, r *http.Request, client RawKVClientInterface) {
+	n := DefaultRecentBlobs
+	if raw := r.URL.Query().Get("n"); raw != "" {
+		var err error
+		n, err = strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "Invalid n")
+			log.Printf("Invalid n: %q", raw)
+			return
+		}
+	}
+	if n > MaxRecentBlobs {
+		n = MaxRecentBlobs
+	}
+
+	keys, values, err := client.ReverseScan(r.Context(), blobEnd, blobStart, n)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve blobs")
+		log.Printf("Failed to retrieve blobs: %v", err)
+		return
+	}
+
+	blobs := make([]map[string]interface{}, 0, len(keys))
+	for i, key := range keys {
+		id := strings.TrimPrefix(string(key), "blob:")
+		blob := map[string]interface{}{"id": id, blobFieldName: string(values[i])}
+		if created, ok := blobCreated(id); ok {
+			blob["created"] = created.Format(time.RFC3339Nano)
+		}
+		if includeSize {
+			blob["size"] = len(values[i])
+		}
+		blobs = append(blobs, blob)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"blobs": blobs})
+}
+
+// blobCreated returns the creation time encoded in a time-based blob id, with or without a partition prefix.
+// Content-addressed ids carry no time and report false.
+func blobCreated(id string) (time.Time, bool) {
+	if i := strings.LastIndexByte(id, ':'); i >= 0 {
+		id = id[i+1:]
+	}
+	nanos, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || len(id) < 19 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos).UTC(), true
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+type recentResponse struct {
+	Blobs []map[string]string `json:"blobs"`
+}
+
+// The newest n blobs come back newest first, with their creation time
+func TestHandleGETRecentNewestFirst(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	for i := 1; i <= 5; i++ {
+		store[fmt.Sprintf("blob:170000000000000000%d", i)] = fmt.Sprintf("blob %d", i)
+	}
+	store["draw:s1:blob:1700000000000000001"] = ""
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- mockClient
+
+	w := httptest.NewRecorder()
+	handleBlobRequest(w, httptest.NewRequest(http.MethodGet, "/blobs?action=recent&n=3", nil), clientPool)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp recentResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []map[string]string{
+		{"id": "1700000000000000005", "blob": "blob 5", "created": "2023-11-14T22:13:20.000000005Z"},
+		{"id": "1700000000000000004", "blob": "blob 4", "created": "2023-11-14T22:13:20.000000004Z"},
+		{"id": "1700000000000000003", "blob": "blob 3", "created": "2023-11-14T22:13:20.000000003Z"},
+	}, resp.Blobs)
+}
+
+// With INCLUDE_SIZE each entry carries the byte length of its stored value, counting multibyte characters by their bytes
+func TestHandleGETRecentIncludeSize(t *testing.T) {
+	defer func(old bool) { includeSize = old }(includeSize)
+	includeSize = true
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1700000000000000001"] = "hello"
+	store["blob:1700000000000000002"] = "héllo wörld ✓"
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- mockClient
+
+	w := httptest.NewRecorder()
+	handleBlobRequest(w, httptest.NewRequest(http.MethodGet, "/blobs?action=recent", nil), clientPool)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"blobs":[
+		{"id":"1700000000000000002","blob":"héllo wörld ✓","created":"2023-11-14T22:13:20.000000002Z","size":17},
+		{"id":"1700000000000000001","blob":"hello","created":"2023-11-14T22:13:20.000000001Z","size":5}
+	]}`, w.Body.String())
+}
+
+// n defaults to DefaultRecentBlobs and is capped at MaxRecentBlobs
+func TestHandleGETRecentClampsN(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().ReverseScan(gomock.Any(), []byte("blob;"), []byte("blob:"), DefaultRecentBlobs).Return(nil, nil, nil)
+	mockClient.EXPECT().ReverseScan(gomock.Any(), []byte("blob;"), []byte("blob:"), MaxRecentBlobs).Return(nil, nil, nil)
+
+	w := httptest.NewRecorder()
+	handleGETRecent(w, httptest.NewRequest(http.MethodGet, "/blobs?action=recent", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"blobs":[]}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handleGETRecent(w, httptest.NewRequest(http.MethodGet, "/blobs?action=recent&n=100000", nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// A non-numeric or non-positive n is rejected
+func TestHandleGETRecentInvalidN(t *testing.T) {
+	for _, n := range []string{"0", "-1", "ten"} {
+		w := httptest.NewRecorder()
+		handleGETRecent(w, httptest.NewRequest(http.MethodGet, "/blobs?action=recent&n="+n, nil), nil)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+}
+
+// Ids without a timestamp, such as content hashes, get no creation time
+func TestBlobCreated(t *testing.T) {
+	created, ok := blobCreated("042:1700000000000000001")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1700000000000000001), created.UnixNano())
+
+	_, ok = blobCreated("9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08")
+	assert.False(t, ok)
+}
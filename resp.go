@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// MaxRESPBulkLength is the largest bulk string, in bytes, accepted from a Redis client.
+const MaxRESPBulkLength = 16 << 20
+
+// MaxRESPArgs is the most arguments accepted in a single Redis command.
+const MaxRESPArgs = 1024
+
+// errRESPProtocol is returned for input that is not valid RESP. The connection is closed after replying.
+var errRESPProtocol = errors.New("Protocol error")
+
+// serveRESP listens on addr and answers Redis clients until the listener fails.
+// SET, GET, DEL and KEYS work on the "blob:" keyspace, so Redis key k is TiKV key "blob:k".
+func serveRESP(addr string, clientPool chan RawKVClientInterface) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("Serving Redis protocol on %s", addr)
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+		go handleRESPConn(conn, clientPool)
+	}
+}
+
+// handleRESPConn reads commands from conn and writes their replies until the client quits or disconnects.
+// A panic while serving the connection closes that connection only, rather than the whole server.
+func handleRESPConn(conn net.Conn, clientPool chan RawKVClientInterface) {
+	defer conn.Close()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Redis connection from %s failed: %v", conn.RemoteAddr(), r)
+		}
+	}()
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+
+	for {
+		args, err := readRESPCommand(reader)
+		if err != nil {
+			if errors.Is(err, errRESPProtocol) {
+				fmt.Fprintf(writer, "-ERR %v\r\n", err)
+				writer.Flush()
+			} else if err != io.EOF {
+				log.Printf("Failed to read Redis command: %v", err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		quit := strings.EqualFold(args[0], "QUIT")
+		if quit {
+			writer.WriteString("+OK\r\n")
+		} else {
+			runRESPCommand(writer, args, clientPool)
+		}
+		if err := writer.Flush(); err != nil || quit {
+			return
+		}
+	}
+}
+
+// readRESPCommand reads one command, either as a RESP array of bulk strings or as an inline command line.
+func readRESPCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := readRESPLine(reader)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+
+	count, err := strconv.Atoi(line[1:])
+	if err != nil || count < 0 || count > MaxRESPArgs {
+		return nil, fmt.Errorf("%w: invalid multibulk length", errRESPProtocol)
+	}
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		header, err := readRESPLine(reader)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(header, "$") {
+			return nil, fmt.Errorf("%w: expected '$', got '%.1s'", errRESPProtocol, header)
+		}
+		length, err := strconv.Atoi(header[1:])
+		if err != nil || length < 0 || length > MaxRESPBulkLength {
+			return nil, fmt.Errorf("%w: invalid bulk length", errRESPProtocol)
+		}
+		buf := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		if string(buf[length:]) != "\r\n" {
+			return nil, fmt.Errorf("%w: bulk string not terminated by CRLF", errRESPProtocol)
+		}
+		args = append(args, string(buf[:length]))
+	}
+	return args, nil
+}
+
+// setRESPBlob stores value under key, overwriting any blob already there, as Redis SET does. It writes through the
+// same helpers as POST and PUT, so BLOB_TTL applies, the metadata and checksum are recorded, and the blob counter
+// counts a key that was not set before. Values are not checked for duplicates, as the Redis key names the blob.
+func setRESPBlob(ctx context.Context, client RawKVClientInterface, key []byte, value string) error {
+	existing, err := client.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := putBlob(ctx, client, key, []byte(value)); err != nil {
+		return err
+	}
+	var oldKey []byte
+	if existing == nil {
+		adjustBlobCount(ctx, client, 1)
+	} else {
+		oldKey = key
+	}
+	if err := recordMeta(ctx, client, oldKey, key, []byte(value)); err != nil {
+		return err
+	}
+	blobSizeBytes.Observe(float64(len(value)))
+	return nil
+}
+
+// readRESPLine reads a line terminated by CRLF, or by a bare LF as inline commands from telnet may be.
+func readRESPLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && line != "" {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+// runRESPCommand runs one command with a pooled client and writes its reply.
+func runRESPCommand(w *bufio.Writer, args []string, clientPool chan RawKVClientInterface) {
+	name := strings.ToLower(args[0])
+	arity := map[string]func(n int) bool{
+		"ping": func(n int) bool { return n <= 2 },
+		"set":  func(n int) bool { return n == 3 },
+		"get":  func(n int) bool { return n == 2 },
+		"del":  func(n int) bool { return n >= 2 },
+		"keys": func(n int) bool { return n == 2 },
+	}
+	valid, ok := arity[name]
+	if !ok {
+		fmt.Fprintf(w, "-ERR unknown command '%s'\r\n", args[0])
+		return
+	}
+	if !valid(len(args)) {
+		fmt.Fprintf(w, "-ERR wrong number of arguments for '%s' command\r\n", name)
+		return
+	}
+	if name == "del" && len(args)-1 > maxBatchSize {
+		fmt.Fprintf(w, "-ERR too many keys for 'del' command, at most %d\r\n", maxBatchSize)
+		return
+	}
+	if name == "ping" {
+		if len(args) == 2 {
+			writeRESPBulk(w, &args[1])
+		} else {
+			w.WriteString("+PONG\r\n")
+		}
+		return
+	}
+
+	client := getClientFromPool(clientPool)
+	if client == nil {
+		w.WriteString("-ERR no TiKV client available\r\n")
+		log.Println("Redis command failed: clientPool empty")
+		return
+	}
+	defer func() {
+		clientPool <- client
+	}()
+
+	if err := execRESPCommand(w, client, name, args[1:]); err != nil {
+		w.WriteString("-ERR TiKV request failed\r\n")
+		log.Printf("Redis %s failed: %v", strings.ToUpper(name), err)
+	}
+}
+
+// execRESPCommand runs a validated SET, GET, DEL or KEYS against client and writes its reply.
+func execRESPCommand(w *bufio.Writer, client RawKVClientInterface, name string, args []string) error {
+	switch name {
+	case "set":
+		if err := setRESPBlob(ctx, client, []byte("blob:"+args[0]), args[1]); err != nil {
+			if isEntryTooLarge(err) {
+				w.WriteString("-ERR Blob too large for TiKV\r\n")
+				return nil
+			}
+			return err
+		}
+		w.WriteString("+OK\r\n")
+	case "get":
+		value, err := client.Get(ctx, []byte("blob:"+args[0]))
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			writeRESPBulk(w, nil)
+		} else {
+			s := string(value)
+			writeRESPBulk(w, &s)
+		}
+	case "del":
+		deleted := 0
+		for _, key := range args {
+			value, err := client.Get(ctx, []byte("blob:"+key))
+			if err != nil {
+				return err
+			}
+			if value == nil {
+				continue
+			}
+			if err := client.Delete(ctx, []byte("blob:"+key)); err != nil {
+				return err
+			}
+			adjustBlobCount(ctx, client, -1)
+			if err := deleteMeta(ctx, client, []byte("blob:"+key)); err != nil {
+				return err
+			}
+			deleted++
+		}
+		fmt.Fprintf(w, ":%d\r\n", deleted)
+	case "keys":
+		keys, err := scanRESPKeys(ctx, client, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "*%d\r\n", len(keys))
+		for i := range keys {
+			writeRESPBulk(w, &keys[i])
+		}
+	}
+	return nil
+}
+
+// scanRESPKeys returns the Redis keys in the blob keyspace that match the glob pattern.
+func scanRESPKeys(ctx context.Context, client RawKVClientInterface, pattern string) ([]string, error) {
+	keys := []string{}
+	blobKeys, err := scanKeys(ctx, client, blobStart, blobEnd)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range blobKeys {
+		name := strings.TrimPrefix(string(key), "blob:")
+		if matched, _ := path.Match(pattern, name); matched {
+			keys = append(keys, name)
+		}
+	}
+	return keys, nil
+}
+
+// writeRESPBulk writes s as a bulk string, or the null bulk string if s is nil.
+func writeRESPBulk(w *bufio.Writer, s *string) {
+	if s == nil {
+		w.WriteString("$-1\r\n")
+		return
+	}
+	fmt.Fprintf(w, "$%d\r\n%s\r\n", len(*s), *s)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/tikv/client-go/v2/rawkv"
+)
+
+// respClient is a minimal Redis client that sends commands as RESP arrays and reads back one raw reply.
+type respClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newRESPClient(t *testing.T, client RawKVClientInterface) *respClient {
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- client
+
+	serverConn, clientConn := net.Pipe()
+	go handleRESPConn(serverConn, clientPool)
+	t.Cleanup(func() { clientConn.Close() })
+	return &respClient{conn: clientConn, reader: bufio.NewReader(clientConn)}
+}
+
+// do sends a command and returns its reply with the framing kept, e.g. "$3\r\none\r\n".
+func (c *respClient) do(t *testing.T, args ...string) string {
+	t.Helper()
+	var cmd strings.Builder
+	fmt.Fprintf(&cmd, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&cmd, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	go c.conn.Write([]byte(cmd.String()))
+	return c.readReply(t)
+}
+
+func (c *respClient) readReply(t *testing.T) string {
+	t.Helper()
+	line, err := c.reader.ReadString('\n')
+	assert.NoError(t, err)
+	switch line[0] {
+	case '$':
+		var n int
+		fmt.Sscanf(line, "$%d", &n)
+		if n < 0 {
+			return line
+		}
+		body := make([]byte, n+2)
+		_, err := io.ReadFull(c.reader, body)
+		assert.NoError(t, err)
+		return line + string(body)
+	case '*':
+		var n int
+		fmt.Sscanf(line, "*%d", &n)
+		for i := 0; i < n; i++ {
+			line += c.readReply(t)
+		}
+	}
+	return line
+}
+
+// SET then GET round-trips a value through the blob keyspace, and a second SET overwrites it
+func TestRESPSetGet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	client := newRESPClient(t, mockClient)
+
+	assert.Equal(t, "+OK\r\n", client.do(t, "SET", "greeting", "to be\r\nor not"))
+	assert.Equal(t, "to be\r\nor not", store["blob:greeting"])
+	assert.Equal(t, "$13\r\nto be\r\nor not\r\n", client.do(t, "GET", "greeting"))
+	assert.Equal(t, "$-1\r\n", client.do(t, "get", "missing"))
+
+	assert.Equal(t, "+OK\r\n", client.do(t, "SET", "greeting", "to be"))
+	assert.Equal(t, "$5\r\nto be\r\n", client.do(t, "GET", "greeting"))
+}
+
+// SET records metadata like POST, keeping the creation time on overwrite, and counts only keys it creates
+func TestRESPSetRecordsMetaAndCount(t *testing.T) {
+	defer func(old bool) { splitMetadata = old }(splitMetadata)
+	defer func(old bool) { blobCounter = old }(blobCounter)
+	splitMetadata = true
+	blobCounter = true
+	store := newMemoryStore()
+	store.Put(ctx, blobCountKey, []byte("0"))
+	client := newRESPClient(t, store)
+
+	assert.Equal(t, "+OK\r\n", client.do(t, "SET", "greeting", "to be"))
+	created, err := getMeta(ctx, store, []byte("blob:greeting"))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, created.Size)
+
+	assert.Equal(t, "+OK\r\n", client.do(t, "SET", "greeting", "or not to be"))
+	updated, err := getMeta(ctx, store, []byte("blob:greeting"))
+	assert.NoError(t, err)
+	assert.Equal(t, 12, updated.Size)
+	assert.Equal(t, created.Created, updated.Created)
+	assert.Equal(t, "1", string(store.values[string(blobCountKey)]))
+}
+
+// DEL counts removed keys and KEYS lists matching ones
+func TestRESPDelKeys(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:a1"] = "x"
+	store["blob:a2"] = "y"
+	store["blob:b1"] = "z"
+	client := newRESPClient(t, mockClient)
+
+	assert.Equal(t, "*2\r\n$2\r\na1\r\n$2\r\na2\r\n", client.do(t, "KEYS", "a*"))
+	assert.Equal(t, ":2\r\n", client.do(t, "DEL", "a1", "b1", "missing"))
+	assert.Equal(t, map[string]string{"blob:a2": "y"}, store)
+}
+
+// DEL removes the metadata and checksum of each blob along with it
+func TestRESPDelRemovesMeta(t *testing.T) {
+	defer func(old bool) { splitMetadata = old }(splitMetadata)
+	defer func(old bool) { storeChecksums = old }(storeChecksums)
+	splitMetadata = true
+	storeChecksums = true
+	store := newMemoryStore()
+	client := newRESPClient(t, store)
+
+	assert.Equal(t, "+OK\r\n", client.do(t, "SET", "greeting", "to be"))
+	assert.Contains(t, store.values, string(metaKey([]byte("blob:greeting"))))
+	assert.Contains(t, store.values, string(sumKey([]byte("blob:greeting"))))
+
+	assert.Equal(t, ":1\r\n", client.do(t, "DEL", "greeting"))
+	assert.Empty(t, store.values)
+}
+
+// Unknown commands and bad arity get Redis-style error replies
+func TestRESPErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := newRESPClient(t, NewMockRawKVClientInterface(ctrl))
+
+	assert.Equal(t, "-ERR unknown command 'FLUSHALL'\r\n", client.do(t, "FLUSHALL"))
+	assert.Equal(t, "-ERR wrong number of arguments for 'set' command\r\n", client.do(t, "SET", "k"))
+	assert.Equal(t, "+PONG\r\n", client.do(t, "PING"))
+}
+
+// Inline commands are accepted and malformed framing closes the connection with an error
+func TestRESPInlineAndProtocolError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := newRESPClient(t, NewMockRawKVClientInterface(ctrl))
+
+	go client.conn.Write([]byte("PING hello\r\n"))
+	assert.Equal(t, "$5\r\nhello\r\n", client.readReply(t))
+
+	go client.conn.Write([]byte("*1\r\n+PING\r\n"))
+	assert.Equal(t, "-ERR Protocol error: expected '$', got '+'\r\n", client.readReply(t))
+}
+
+// Negative multibulk and bulk lengths are protocol errors rather than allocation sizes
+func TestReadRESPCommandNegativeLengths(t *testing.T) {
+	for _, input := range []string{"*-1\r\n", "*1\r\n$-1\r\n", "*-5\r\n$3\r\nGET\r\n"} {
+		args, err := readRESPCommand(bufio.NewReader(strings.NewReader(input)))
+		assert.Nil(t, args, input)
+		assert.ErrorIs(t, err, errRESPProtocol, input)
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := newRESPClient(t, NewMockRawKVClientInterface(ctrl))
+	go client.conn.Write([]byte("*-1\r\n"))
+	assert.Equal(t, "-ERR Protocol error: invalid multibulk length\r\n", client.readReply(t))
+}
+
+// A panic while serving one connection is recovered, so the server keeps running
+func TestHandleRESPConnRecoversFromPanic(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Get(gomock.Any(), gomock.Any()).Do(func(ctx context.Context, key []byte, options ...rawkv.RawOption) { panic("boom") })
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- mockClient
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handleRESPConn(serverConn, clientPool)
+	}()
+
+	go clientConn.Write([]byte("*2\r\n$3\r\nGET\r\n$1\r\nk\r\n"))
+	<-done
+	assert.Len(t, clientPool, 1)
+}
+
+// DEL accepts up to MAX_BATCH_SIZE keys and rejects more without touching TiKV
+func TestRESPDelMaxBatchSize(t *testing.T) {
+	defer func(old int) { maxBatchSize = old }(maxBatchSize)
+	maxBatchSize = 2
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:a"] = "x"
+	store["blob:b"] = "y"
+	store["blob:c"] = "z"
+	client := newRESPClient(t, mockClient)
+
+	assert.Equal(t, "-ERR too many keys for 'del' command, at most 2\r\n", client.do(t, "DEL", "a", "b", "c"))
+	assert.Len(t, store, 3)
+	assert.Equal(t, ":2\r\n", client.do(t, "DEL", "a", "b"))
+	assert.Equal(t, map[string]string{"blob:c": "z"}, store)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// JSON-RPC 2.0 error codes. The -32000 range is reserved by the spec for server-defined errors.
+const (
+	RPCParseError     = -32700
+	RPCInvalidRequest = -32600
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+	RPCInternalError  = -32603
+	RPCNotFound       = -32001
+	RPCConflict       = -32002
+)
+
+// rpcRequest is a JSON-RPC 2.0 request. A request without an id is a notification and gets no response.
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  rpcParams       `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// rpcParams holds the named parameters accepted by the blob methods.
+type rpcParams struct {
+	Blob   string `json:"blob"`
+	ID     string `json:"id"`
+	Cursor string `json:"cursor"`
+	Sort   string `json:"sort"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// rpcError is a JSON-RPC error object. For errors raised by the blob handlers, Data holds the HTTP status
+// the same call would have answered with over the REST endpoints.
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// handleRPC serves JSON-RPC 2.0 calls on POST /rpc. The methods blob.create, blob.get, blob.delete, blob.list
+// and blob.count run the same handler logic as the REST endpoints, and their JSON responses become the call result.
+// Protocol errors are always answered with HTTP 200 and a JSON-RPC error object, as the spec requires.
+func handleRPC(w http.ResponseWriter, r *http.Request, client RawKVClientInterface) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
+	var req rpcRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusOK, rpcResponse{JSONRPC: "2.0", Error: &rpcError{Code: RPCParseError, Message: "Parse error"}, ID: json.RawMessage("null")})
+		log.Printf("Failed to parse JSON-RPC request: %v", err)
+		return
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		writeJSON(w, http.StatusOK, rpcResponse{JSONRPC: "2.0", Error: &rpcError{Code: RPCInvalidRequest, Message: "Invalid Request"}, ID: rpcID(req.ID)})
+		log.Println("Invalid JSON-RPC request")
+		return
+	}
+
+	result, rpcErr := callRPC(r, client, req.Method, req.Params)
+	if req.ID == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, rpcResponse{JSONRPC: "2.0", Result: result, Error: rpcErr, ID: req.ID})
+}
+
+// callRPC runs a single JSON-RPC method against client and returns its result or error.
+func callRPC(r *http.Request, client RawKVClientInterface, method string, params rpcParams) (json.RawMessage, *rpcError) {
+	capture := newCaptureWriter()
+	switch method {
+	case "blob.create":
+		if params.Blob == "" {
+			return nil, &rpcError{Code: RPCInvalidParams, Message: "No blob provided"}
+		}
+		createBlob(capture, r, client, params.Blob, params.ID)
+	case "blob.get":
+		if params.ID == "" {
+			return nil, &rpcError{Code: RPCInvalidParams, Message: "No blob id provided"}
+		}
+		handleGETByID(capture, r, client, params.ID)
+	case "blob.delete":
+		query := url.Values{blobFieldName: {params.Blob}}
+		handleDELETE(capture, rpcSubRequest(r, query), client)
+	case "blob.list":
+		query := url.Values{}
+		if params.Cursor != "" {
+			query.Set("cursor", params.Cursor)
+		}
+		if params.Sort != "" {
+			query.Set("sort", params.Sort)
+		}
+		handleGETAll(capture, rpcSubRequest(r, query), client)
+	case "blob.count":
+		handleGETCount(capture, client)
+	default:
+		return nil, &rpcError{Code: RPCMethodNotFound, Message: "Method not found"}
+	}
+
+	if capture.status == http.StatusNoContent {
+		return json.RawMessage("null"), nil
+	}
+	if capture.status < http.StatusBadRequest {
+		return capture.body.Bytes(), nil
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	json.Unmarshal(capture.body.Bytes(), &body)
+	code := RPCInternalError
+	switch capture.status {
+	case http.StatusBadRequest:
+		code = RPCInvalidParams
+	case http.StatusNotFound:
+		code = RPCNotFound
+	case http.StatusConflict:
+		code = RPCConflict
+	}
+	return nil, &rpcError{Code: code, Message: body.Error, Data: map[string]int{"status": capture.status}}
+}
+
+// rpcSubRequest returns a copy of r carrying query in place of the JSON-RPC request's own.
+func rpcSubRequest(r *http.Request, query url.Values) *http.Request {
+	sub := r.Clone(r.Context())
+	sub.URL.RawQuery = query.Encode()
+	return sub
+}
+
+// rpcID returns id, or JSON null when the request had none.
+func rpcID(id json.RawMessage) json.RawMessage {
+	if id == nil {
+		return json.RawMessage("null")
+	}
+	return id
+}
+
+// captureWriter records a handler's response so it can be returned as a JSON-RPC result.
+type captureWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newCaptureWriter() *captureWriter {
+	return &captureWriter{header: http.Header{}, status: http.StatusOK}
+}
+
+func (w *captureWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *captureWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
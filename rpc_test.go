@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func rpcCall(t *testing.T, client RawKVClientInterface, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handleRPC(w, httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body)), client)
+	return w
+}
+
+// A successful call returns the handler's response as the result
+func TestHandleRPCGet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "one"
+
+	w := rpcCall(t, mockClient, `{"jsonrpc":"2.0","method":"blob.get","params":{"id":"1"},"id":7}`)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"jsonrpc":"2.0","result":{"blob":"one"},"id":7}`, w.Body.String())
+}
+
+// blob.create, blob.count, blob.list and blob.delete run the REST handler logic
+func TestHandleRPCCreateListCountDelete(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+
+	w := rpcCall(t, mockClient, `{"jsonrpc":"2.0","method":"blob.create","params":{"blob":"one"},"id":1}`)
+	assert.Equal(t, `{"jsonrpc":"2.0","result":{"blob":"one"},"id":1}`, w.Body.String())
+	assert.Len(t, store, 1)
+
+	w = rpcCall(t, mockClient, `{"jsonrpc":"2.0","method":"blob.list","id":2}`)
+	assert.Equal(t, `{"jsonrpc":"2.0","result":{"blobs":["one"]},"id":2}`, w.Body.String())
+
+	w = rpcCall(t, mockClient, `{"jsonrpc":"2.0","method":"blob.count","id":3}`)
+	assert.Equal(t, `{"jsonrpc":"2.0","result":{"count":1},"id":3}`, w.Body.String())
+
+	w = rpcCall(t, mockClient, `{"jsonrpc":"2.0","method":"blob.delete","params":{"blob":"one"},"id":"four"}`)
+	assert.Equal(t, `{"jsonrpc":"2.0","result":{"message":"Blob deleted successfully"},"id":"four"}`, w.Body.String())
+	assert.Empty(t, store)
+}
+
+// A missing blob maps to the not-found error code with the HTTP status as data
+func TestHandleRPCNotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, _ := newMemoryClient(ctrl)
+
+	w := rpcCall(t, mockClient, `{"jsonrpc":"2.0","method":"blob.get","params":{"id":"404"},"id":1}`)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"jsonrpc":"2.0","error":{"code":-32001,"message":"Blob not found","data":{"status":404}},"id":1}`, w.Body.String())
+}
+
+// Protocol errors use the standard JSON-RPC codes
+func TestHandleRPCProtocolErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+
+	w := rpcCall(t, mockClient, `{"jsonrpc":`)
+	assert.Equal(t, `{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error"},"id":null}`, w.Body.String())
+
+	w = rpcCall(t, mockClient, `{"method":"blob.count","id":1}`)
+	assert.Equal(t, `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":1}`, w.Body.String())
+
+	w = rpcCall(t, mockClient, `{"jsonrpc":"2.0","method":"blob.rename","id":1}`)
+	assert.Equal(t, `{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":1}`, w.Body.String())
+
+	w = rpcCall(t, mockClient, `{"jsonrpc":"2.0","method":"blob.create","params":{},"id":1}`)
+	assert.Equal(t, `{"jsonrpc":"2.0","error":{"code":-32602,"message":"No blob provided"},"id":1}`, w.Body.String())
+}
+
+// Notifications are run but get no response body
+func TestHandleRPCNotification(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+
+	w := rpcCall(t, mockClient, `{"jsonrpc":"2.0","method":"blob.create","params":{"blob":"quiet"}}`)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Len(t, store, 1)
+}
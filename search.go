@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MaxRegexLength is the longest pattern accepted by the search endpoint.
+const MaxRegexLength = 256
+
+// SearchPageSize is how many blobs are fetched from TiKV per scan while searching.
+const SearchPageSize = 100
+
+// MaxSearchLimit caps ?limit= for the search endpoint.
+const MaxSearchLimit = 1000
+
+// searchCursor is where a paged search continues. It carries the pattern and page size with it,
+// so a client only passes ?cursor= for the following pages.
+type searchCursor struct {
+	Regex string `json:"regex"`
+	Limit int    `json:"limit"`
+	// Key is the key of the first match on the next page.
+	Key string `json:"key"`
+}
+
+// encode returns the cursor in the opaque form handed to clients.
+func (c searchCursor) encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeSearchCursor parses a cursor made by searchCursor.encode, rejecting anything that could not have come from it.
+func decodeSearchCursor(s string) (searchCursor, error) {
+	var c searchCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return c, err
+	}
+	if c.Regex == "" || c.Limit < 1 || c.Limit > MaxSearchLimit || !strings.HasPrefix(c.Key, "blob:") {
+		return c, errors.New("malformed search cursor")
+	}
+	return c, nil
+}
+
+// handleGETSearch returns every blob matching the "regex" query parameter.
+// Patterns use RE2 syntax, so matching runs in time linear in the blob size and cannot backtrack catastrophically.
+// Long patterns are rejected up front, and the whole search is bounded by searchTimeout.
+// With ?limit= at most that many matches are returned, and if more remain the response carries a cursor
+// holding the pattern and limit, to pass back as ?cursor= for the next page.
+// With PARTIAL_RESULTS a search that times out after scanning part of the store returns the matches found so far,
+// marked "partial", with a cursor to continue from, instead of 503.
+func handleGETSearch(w http.ResponseWriter, r *http.Request, client RawKVClientInterface) {
+	query := r.URL.Query()
+	pattern := query.Get("regex")
+	limit := 0
+	startKey := blobStart
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, err := decodeSearchCursor(raw)
+		if err != nil || (pattern != "" && pattern != cursor.Regex) {
+			writeError(w, http.StatusBadRequest, "Invalid cursor")
+			log.Printf("Invalid cursor: %q", raw)
+			return
+		}
+		pattern, limit, startKey = cursor.Regex, cursor.Limit, []byte(cursor.Key)
+	}
+	if raw := query.Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			writeError(w, http.StatusBadRequest, "Invalid limit")
+			log.Printf("Invalid limit: %q", raw)
+			return
+		}
+		if limit > MaxSearchLimit {
+			limit = MaxSearchLimit
+		}
+	}
+
+	if pattern == "" {
+		writeError(w, http.StatusBadRequest, "No regex provided")
+		log.Println("No regex provided")
+		return
+	}
+	if len(pattern) > MaxRegexLength {
+		writeError(w, http.StatusBadRequest, "Regex too long")
+		log.Printf("Regex too long: %d bytes", len(pattern))
+		return
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid regex")
+		log.Printf("Invalid regex %q: %v", pattern, err)
+		return
+	}
+
+	ctx := r.Context()
+	if searchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, searchTimeout)
+		defer cancel()
+	}
+
+	blobs, nextKey, err := searchBlobs(ctx, client, re, startKey, limit)
+	if errors.Is(err, context.DeadlineExceeded) && partialResults && !bytes.Equal(nextKey, startKey) {
+		// A cursor needs a limit, so a search without one resumes with the largest.
+		if limit == 0 {
+			limit = MaxSearchLimit
+		}
+		log.Printf("Search for %q timed out, returning %d matches found so far", pattern, len(blobs))
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"blobs":   blobs,
+			"partial": true,
+			"cursor":  searchCursor{Regex: pattern, Limit: limit, Key: string(nextKey)}.encode(),
+		})
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, http.StatusServiceUnavailable, "Search timed out")
+		log.Printf("Search for %q timed out", pattern)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve blobs")
+		log.Printf("Failed to retrieve blobs: %v", err)
+		return
+	}
+
+	resp := map[string]interface{}{"blobs": blobs}
+	if nextKey != nil {
+		resp["truncated"] = true
+		resp["cursor"] = searchCursor{Regex: pattern, Limit: limit, Key: string(nextKey)}.encode()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// searchBlobs scans the blob range from startKey page by page and returns the values matching re.
+// Only one page is held in memory at a time, so large stores can be searched.
+// With limit set it stops after that many matches and returns the key of the next match, if there is one,
+// so the next page never comes back empty.
+// If the scan fails part way, the matches found so far are returned with the error, along with the key to resume from.
+func searchBlobs(ctx context.Context, client RawKVClientInterface, re *regexp.Regexp, startKey []byte, limit int) ([]string, []byte, error) {
+	blobs := []string{}
+	for {
+		keys, values, err := client.Scan(ctx, startKey, blobEnd, SearchPageSize)
+		if err != nil {
+			return blobs, startKey, err
+		}
+		for i, value := range values {
+			if err := ctx.Err(); err != nil {
+				return blobs, keys[i], err
+			}
+			if !re.Match(value) {
+				continue
+			}
+			if limit > 0 && len(blobs) == limit {
+				return blobs, keys[i], nil
+			}
+			blobs = append(blobs, string(value))
+		}
+		if len(keys) < SearchPageSize {
+			return blobs, nil, nil
+		}
+		startKey = nextScanKey(keys[len(keys)-1])
+	}
+}
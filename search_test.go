@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/tikv/client-go/v2/rawkv"
+)
+
+// A valid regex returns only the matching blobs
+func TestHandleGETSearchMatches(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "to be or not to be"
+	store["blob:2"] = "that is the question"
+	store["blob:3"] = "to err is human"
+
+	w := httptest.NewRecorder()
+	handleGET(w, httptest.NewRequest(http.MethodGet, "/search?regex="+url.QueryEscape("^to (be|err)"), nil), mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"blobs":["to be or not to be","to err is human"]}`, w.Body.String())
+}
+
+// No match responds with an empty list rather than null
+func TestHandleGETSearchNoMatches(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "to be or not to be"
+
+	w := httptest.NewRecorder()
+	handleGET(w, httptest.NewRequest(http.MethodGet, "/search?regex=question", nil), mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"blobs":[]}`, w.Body.String())
+}
+
+// The search pages through stores larger than one scan
+func TestHandleGETSearchPagesThroughStore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	for i := 0; i < SearchPageSize*2+5; i++ {
+		store[fmt.Sprintf("blob:%04d", i)] = fmt.Sprintf("value %d", i)
+	}
+
+	w := httptest.NewRecorder()
+	handleGET(w, httptest.NewRequest(http.MethodGet, "/search?regex="+url.QueryEscape(`^value \d*7$`), nil), mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 20, strings.Count(w.Body.String(), "value"))
+}
+
+// A pattern that does not compile responds 400
+func TestHandleGETSearchInvalidRegex(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+
+	w := httptest.NewRecorder()
+	handleGET(w, httptest.NewRequest(http.MethodGet, "/search?regex="+url.QueryEscape("(unclosed"), nil), mockClient)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `{"error":"Invalid regex"}`, w.Body.String())
+}
+
+// Missing and overlong patterns respond 400 without touching TiKV
+func TestHandleGETSearchRejectsPattern(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+
+	w := httptest.NewRecorder()
+	handleGET(w, httptest.NewRequest(http.MethodGet, "/search", nil), mockClient)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `{"error":"No regex provided"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handleGET(w, httptest.NewRequest(http.MethodGet, "/search?regex="+strings.Repeat("a", MaxRegexLength+1), nil), mockClient)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `{"error":"Regex too long"}`, w.Body.String())
+}
+
+// A search that outlives SEARCH_TIMEOUT responds 503
+func TestHandleGETSearchTimeout(t *testing.T) {
+	defer func(old time.Duration) { searchTimeout = old }(searchTimeout)
+	searchTimeout = 10 * time.Millisecond
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any(), SearchPageSize).DoAndReturn(
+		func(ctx context.Context, startKey, endKey []byte, limit int, options ...rawkv.RawOption) ([][]byte, [][]byte, error) {
+			<-ctx.Done()
+			return nil, nil, ctx.Err()
+		})
+
+	w := httptest.NewRecorder()
+	handleGET(w, httptest.NewRequest(http.MethodGet, "/search?regex=a", nil), mockClient)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, `{"error":"Search timed out"}`, w.Body.String())
+}
+
+type searchPage struct {
+	Blobs     []string `json:"blobs"`
+	Truncated bool     `json:"truncated"`
+	Cursor    string   `json:"cursor"`
+}
+
+// Following the cursor pages through every match exactly once, in key order, across scan pages
+func TestHandleGETSearchPagination(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	var expected []string
+	for i := 0; i < SearchPageSize*2+5; i++ {
+		value := fmt.Sprintf("value %d", i)
+		store[fmt.Sprintf("blob:%04d", i)] = value
+		if i%10 == 7 {
+			expected = append(expected, value)
+		}
+	}
+
+	var found []string
+	path := "/search?limit=6&regex=" + url.QueryEscape(`^value \d*7$`)
+	for pages := 0; ; pages++ {
+		assert.Less(t, pages, 10)
+		w := httptest.NewRecorder()
+		handleGET(w, httptest.NewRequest(http.MethodGet, path, nil), mockClient)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var page searchPage
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		assert.NotEmpty(t, page.Blobs)
+		assert.LessOrEqual(t, len(page.Blobs), 6)
+		found = append(found, page.Blobs...)
+		if !page.Truncated {
+			assert.Empty(t, page.Cursor)
+			break
+		}
+		path = "/search?cursor=" + page.Cursor
+	}
+	assert.Equal(t, expected, found)
+}
+
+// A limit above the maximum is clamped, and a limit that is not a positive number is rejected
+func TestHandleGETSearchLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	for i := 0; i < MaxSearchLimit+1; i++ {
+		store[fmt.Sprintf("blob:%05d", i)] = "match"
+	}
+
+	w := httptest.NewRecorder()
+	handleGET(w, httptest.NewRequest(http.MethodGet, "/search?regex=match&limit=5000", nil), mockClient)
+	var page searchPage
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Len(t, page.Blobs, MaxSearchLimit)
+	assert.True(t, page.Truncated)
+
+	for _, limit := range []string{"0", "-1", "ten"} {
+		w := httptest.NewRecorder()
+		handleGET(w, httptest.NewRequest(http.MethodGet, "/search?regex=match&limit="+limit, nil), mockClient)
+		assert.Equal(t, http.StatusBadRequest, w.Code, limit)
+		assert.Equal(t, `{"error":"Invalid limit"}`, w.Body.String(), limit)
+	}
+}
+
+// Cursors that were not handed out by a search, or that belong to another pattern, are rejected
+func TestHandleGETSearchInvalidCursor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	valid := searchCursor{Regex: "a", Limit: 5, Key: "blob:1"}.encode()
+
+	for _, path := range []string{
+		"/search?cursor=not-base64!",
+		"/search?cursor=" + searchCursor{Regex: "a", Limit: 5, Key: "meta:1"}.encode(),
+		"/search?cursor=" + searchCursor{Regex: "a", Limit: 0, Key: "blob:1"}.encode(),
+		"/search?regex=b&cursor=" + valid,
+	} {
+		w := httptest.NewRecorder()
+		handleGET(w, httptest.NewRequest(http.MethodGet, path, nil), mockClient)
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+		assert.Equal(t, `{"error":"Invalid cursor"}`, w.Body.String(), path)
+	}
+}
+
+// With PARTIAL_RESULTS a search that times out after a page returns the matches so far and a cursor to resume from
+func TestHandleGETSearchPartialResults(t *testing.T) {
+	defer func(old bool) { partialResults = old }(partialResults)
+	partialResults = true
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var keys, values [][]byte
+	for i := 0; i < SearchPageSize; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("blob:%04d", i)))
+		values = append(values, []byte(fmt.Sprintf("value %d", i)))
+	}
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	gomock.InOrder(
+		mockClient.EXPECT().Scan(gomock.Any(), blobStart, blobEnd, SearchPageSize).Return(keys, values, nil),
+		mockClient.EXPECT().Scan(gomock.Any(), nextScanKey(keys[len(keys)-1]), blobEnd, SearchPageSize).
+			Return(nil, nil, context.DeadlineExceeded),
+	)
+
+	w := httptest.NewRecorder()
+	handleGET(w, httptest.NewRequest(http.MethodGet, "/search?regex="+url.QueryEscape(`^value \d*7$`), nil), mockClient)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var page struct {
+		Blobs   []string `json:"blobs"`
+		Partial bool     `json:"partial"`
+		Cursor  string   `json:"cursor"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.True(t, page.Partial)
+	assert.Len(t, page.Blobs, 10)
+	assert.Equal(t, "value 97", page.Blobs[9])
+
+	cursor, err := decodeSearchCursor(page.Cursor)
+	assert.NoError(t, err)
+	assert.Equal(t, `^value \d*7$`, cursor.Regex)
+	assert.Equal(t, string(nextScanKey(keys[len(keys)-1])), cursor.Key)
+}
+
+// Without PARTIAL_RESULTS the same interrupted search is an error
+func TestHandleGETSearchPartialResultsDisabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var keys, values [][]byte
+	for i := 0; i < SearchPageSize; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("blob:%04d", i)))
+		values = append(values, []byte("value"))
+	}
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	gomock.InOrder(
+		mockClient.EXPECT().Scan(gomock.Any(), blobStart, blobEnd, SearchPageSize).Return(keys, values, nil),
+		mockClient.EXPECT().Scan(gomock.Any(), gomock.Any(), blobEnd, SearchPageSize).Return(nil, nil, context.DeadlineExceeded),
+	)
+
+	w := httptest.NewRecorder()
+	handleGET(w, httptest.NewRequest(http.MethodGet, "/search?regex=value", nil), mockClient)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, `{"error":"Search timed out"}`, w.Body.String())
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// handleGETStats reports the client pool's size and use, and the requests served so far, as one JSON object.
+// The pool figures are read from the pool channel and the request counts from httpRequestsTotal,
+// so they match what /metrics serves. "uses" lists how many times each client was taken from the pool, lowest first.
+func handleGETStats(w http.ResponseWriter, clientPool chan RawKVClientInterface) {
+	available := len(clientPool)
+	byStatus := requestCounts()
+	total, clientErrors, serverErrors := 0, 0, 0
+	for code, count := range byStatus {
+		total += count
+		switch status, _ := strconv.Atoi(code); {
+		case status >= 500:
+			serverErrors += count
+		case status >= 400:
+			clientErrors += count
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"pool": map[string]interface{}{
+			"size":      cap(clientPool),
+			"available": available,
+			"inUse":     cap(clientPool) - available,
+			"uses":      clientUseCounts(clientPool),
+		},
+		"requests": map[string]interface{}{
+			"total":        total,
+			"clientErrors": clientErrors,
+			"serverErrors": serverErrors,
+			"byStatus":     byStatus,
+		},
+	})
+}
+
+// requestCounts returns the current values of httpRequestsTotal, keyed by status code.
+func requestCounts() map[string]int {
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		httpRequestsTotal.Collect(metrics)
+		close(metrics)
+	}()
+
+	counts := map[string]int{}
+	for metric := range metrics {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			continue
+		}
+		for _, label := range m.GetLabel() {
+			if label.GetName() == "code" {
+				counts[label.GetValue()] = int(m.GetCounter().GetValue())
+			}
+		}
+	}
+	return counts
+}
+
+// clientUses counts how many times each client was taken from its pool. The pool channel is first in, first out,
+// so the client returned longest ago is always the next one taken and the counts stay close to each other.
+var clientUses = struct {
+	sync.Mutex
+	byPool map[chan RawKVClientInterface]map[RawKVClientInterface]int
+}{byPool: map[chan RawKVClientInterface]map[RawKVClientInterface]int{}}
+
+// recordClientUse counts one more use of client, just taken from clientPool.
+func recordClientUse(clientPool chan RawKVClientInterface, client RawKVClientInterface) {
+	clientUses.Lock()
+	defer clientUses.Unlock()
+	uses := clientUses.byPool[clientPool]
+	if uses == nil {
+		uses = map[RawKVClientInterface]int{}
+		clientUses.byPool[clientPool] = uses
+	}
+	uses[client]++
+}
+
+// forgetClientUses drops the count of client once it has left clientPool for good.
+func forgetClientUses(clientPool chan RawKVClientInterface, client RawKVClientInterface) {
+	clientUses.Lock()
+	defer clientUses.Unlock()
+	delete(clientUses.byPool[clientPool], client)
+}
+
+// clientUseCounts returns how many times each client of clientPool has been used, lowest first.
+// Clients that have not been used yet are not listed.
+func clientUseCounts(clientPool chan RawKVClientInterface) []int {
+	clientUses.Lock()
+	defer clientUses.Unlock()
+	counts := []int{}
+	for _, count := range clientUses.byPool[clientPool] {
+		counts = append(counts, count)
+	}
+	sort.Ints(counts)
+	return counts
+}
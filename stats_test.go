@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type statsResponse struct {
+	Pool struct {
+		Size      int   `json:"size"`
+		Available int   `json:"available"`
+		InUse     int   `json:"inUse"`
+		Uses      []int `json:"uses"`
+	} `json:"pool"`
+	Requests struct {
+		Total        int            `json:"total"`
+		ClientErrors int            `json:"clientErrors"`
+		ServerErrors int            `json:"serverErrors"`
+		ByStatus     map[string]int `json:"byStatus"`
+	} `json:"requests"`
+}
+
+// /stats reports the pool and the requests served through the middleware stack
+func TestHandleGETStats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:1"] = "hello"
+	clientPool := make(chan RawKVClientInterface, 3)
+	clientPool <- mockClient
+	clientPool <- mockClient
+	handler := withMiddleware(setupServer(clientPool))
+
+	before := testutil.ToFloat64(httpRequestsTotal.WithLabelValues("404"))
+	for _, path := range []string{"/blobs/1", "/blobs/2", "/blobs/3"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	assert.Equal(t, before+2, testutil.ToFloat64(httpRequestsTotal.WithLabelValues("404")))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var stats statsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, 3, stats.Pool.Size)
+	assert.Equal(t, 2, stats.Pool.Available)
+	assert.Equal(t, 1, stats.Pool.InUse)
+	assert.GreaterOrEqual(t, stats.Requests.ByStatus["200"], 1)
+	assert.GreaterOrEqual(t, stats.Requests.ByStatus["404"], 2)
+	assert.GreaterOrEqual(t, stats.Requests.ClientErrors, 2)
+	assert.GreaterOrEqual(t, stats.Requests.Total, 3)
+	total := 0
+	for _, count := range stats.Requests.ByStatus {
+		total += count
+	}
+	assert.Equal(t, total, stats.Requests.Total)
+}
+
+// A handler that writes without calling WriteHeader is counted as 200
+func TestWithRequestMetricsImplicitOK(t *testing.T) {
+	before := testutil.ToFloat64(httpRequestsTotal.WithLabelValues("200"))
+	handler := withRequestMetrics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, before+1, testutil.ToFloat64(httpRequestsTotal.WithLabelValues("200")))
+}
+
+// Requests are spread evenly over the pooled clients, and /stats reports how often each was used
+func TestClientUsesSpreadEvenly(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	clientPool := make(chan RawKVClientInterface, 3)
+	for i := 0; i < 3; i++ {
+		clientPool <- NewMockRawKVClientInterface(ctrl)
+	}
+
+	noop := func(w http.ResponseWriter, r *http.Request, client RawKVClientInterface) {}
+	for i := 0; i < 30; i++ {
+		withPooledClient(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), clientPool, noop)
+	}
+
+	w := httptest.NewRecorder()
+	handleGETStats(w, clientPool)
+	var stats statsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, []int{10, 10, 10}, stats.Pool.Uses)
+
+	discardClient(clientPool, <-clientPool)
+	defer discardedClients.Store(0)
+	assert.Equal(t, []int{10, 10}, clientUseCounts(clientPool))
+}
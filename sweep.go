@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// setupSweeper starts a goroutine that deletes blobs older than maxBlobAge every sweepInterval,
+// using a client borrowed from the pool for each sweep. It does nothing if MAX_BLOB_AGE is not set.
+func setupSweeper(clientPool chan RawKVClientInterface) {
+	if maxBlobAge <= 0 {
+		return
+	}
+	if keyScheme == KeySchemeContent {
+		log.Println("MAX_BLOB_AGE is ignored with KEY_SCHEME=content, as content keys carry no creation time")
+		return
+	}
+
+	go func() {
+		for {
+			time.Sleep(sweepInterval)
+			client := <-clientPool
+			swept, err := sweepOldBlobs(ctx, client, time.Now().Add(-maxBlobAge), sweepDryRun)
+			clientPool <- client
+			if err != nil {
+				log.Printf("Failed to sweep old blobs: %v", err)
+				continue
+			}
+			if swept > 0 {
+				log.Printf("Swept %d blobs older than %v", swept, maxBlobAge)
+			}
+		}
+	}()
+}
+
+// sweepOldBlobs deletes every blob whose key was created before cutoff and returns how many it found.
+// With dryRun the blobs are only logged. Without KEY_PARTITIONS time-based keys sort by creation time,
+// so only the range below the cutoff is scanned; with partitions every shard is scanned and filtered.
+func sweepOldBlobs(ctx context.Context, client RawKVClientInterface, cutoff time.Time, dryRun bool) (int, error) {
+	end := blobEnd
+	if keyPartitions <= 1 {
+		end = []byte(fmt.Sprintf("blob:%d", cutoff.UnixNano()))
+	}
+	keys, err := scanKeys(ctx, client, blobStart, end)
+	if err != nil {
+		return 0, err
+	}
+
+	swept := 0
+	for _, key := range keys {
+		created, ok := blobCreated(strings.TrimPrefix(string(key), "blob:"))
+		if !ok || !created.Before(cutoff) {
+			continue
+		}
+		swept++
+		if dryRun {
+			log.Printf("Would sweep blob %s created %v", key, created)
+			continue
+		}
+		if err := client.Delete(ctx, key); err != nil {
+			return swept, err
+		}
+		adjustBlobCount(ctx, client, -1)
+		if err := deleteMeta(ctx, client, key); err != nil {
+			return swept, err
+		}
+	}
+	return swept, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// Blobs created before the cutoff are deleted with their metadata, newer ones are kept
+func TestSweepOldBlobs(t *testing.T) {
+	defer func(old bool) { splitMetadata = old }(splitMetadata)
+	splitMetadata = true
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	now := time.Now()
+	old := fmt.Sprintf("%d", now.Add(-48*time.Hour).UnixNano())
+	recent := fmt.Sprintf("%d", now.Add(-time.Hour).UnixNano())
+	mockClient, store := newMemoryClient(ctrl)
+	store["blob:"+old] = "old"
+	store["meta:"+old] = "{}"
+	store["blob:"+recent] = "recent"
+
+	swept, err := sweepOldBlobs(context.Background(), mockClient, now.Add(-24*time.Hour), false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, swept)
+	assert.Equal(t, map[string]string{"blob:" + recent: "recent"}, store)
+}
+
+// With KEY_PARTITIONS every shard is scanned and only old blobs are deleted
+func TestSweepOldBlobsPartitioned(t *testing.T) {
+	defer func(old int) { keyPartitions = old }(keyPartitions)
+	keyPartitions = 16
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	now := time.Now()
+	mockClient, store := newMemoryClient(ctrl)
+	store[fmt.Sprintf("blob:007:%d", now.Add(-48*time.Hour).UnixNano())] = "old"
+	recentKey := fmt.Sprintf("blob:003:%d", now.Add(-time.Hour).UnixNano())
+	store[recentKey] = "recent"
+
+	swept, err := sweepOldBlobs(context.Background(), mockClient, now.Add(-24*time.Hour), false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, swept)
+	assert.Equal(t, map[string]string{recentKey: "recent"}, store)
+}
+
+// A dry run finds the old blobs but deletes nothing
+func TestSweepOldBlobsDryRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	now := time.Now()
+	mockClient, store := newMemoryClient(ctrl)
+	store[fmt.Sprintf("blob:%d", now.Add(-48*time.Hour).UnixNano())] = "old"
+
+	swept, err := sweepOldBlobs(context.Background(), mockClient, now.Add(-24*time.Hour), true)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, swept)
+	assert.Len(t, store, 1)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// putBlob stores a blob value under key, with blobTTL as its time to live when one is configured.
+func putBlob(ctx context.Context, client RawKVClientInterface, key []byte, value []byte) error {
+	if blobTTL > 0 {
+		return client.PutWithTTL(ctx, key, value, blobTTLSeconds())
+	}
+	return client.Put(ctx, key, value)
+}
+
+// blobTTLSeconds returns blobTTL in whole seconds as TiKV expects, rounded up so that a sub-second TTL still expires.
+func blobTTLSeconds() uint64 {
+	return uint64((blobTTL + time.Second - 1) / time.Second)
+}
+
+// handlePOSTTouch rewrites the blob stored under "blob:<id>" with a fresh BLOB_TTL, so that blobs in active use
+// do not expire. It responds 404 if the blob is absent or has already expired.
+func handlePOSTTouch(w http.ResponseWriter, r *http.Request, client RawKVClientInterface, id string) {
+	if blobTTL <= 0 {
+		writeError(w, http.StatusBadRequest, "Blob TTL is not configured")
+		log.Println("Touch requested but BLOB_TTL is not set")
+		return
+	}
+
+	key := idKey(id)
+	value, err := client.Get(r.Context(), key)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to retrieve blob")
+		log.Printf("Failed to retrieve blob: %v", err)
+		return
+	}
+	if value == nil {
+		writeError(w, http.StatusNotFound, "Blob not found")
+		log.Println("Blob not found")
+		return
+	}
+
+	if err := putBlob(r.Context(), client, key, value); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to touch blob")
+		log.Printf("Failed to touch blob: %v", err)
+		return
+	}
+	if err := touchMeta(r.Context(), client, key); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to touch blob metadata")
+		log.Printf("Failed to touch blob metadata: %v", err)
+		return
+	}
+
+	resp := map[string]interface{}{"id": id, "ttl": blobTTLSeconds()}
+	writeJSON(w, http.StatusOK, resp)
+}
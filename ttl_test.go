@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// Touching an existing blob rewrites it with a fresh TTL
+func TestHandlePOSTTouch(t *testing.T) {
+	defer func(old time.Duration) { blobTTL = old }(blobTTL)
+	blobTTL = time.Hour
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- mockClient
+
+	mockClient.EXPECT().Get(gomock.Any(), []byte("blob:1")).Return([]byte("one"), nil)
+	mockClient.EXPECT().PutWithTTL(gomock.Any(), []byte("blob:1"), []byte("one"), uint64(3600)).Return(nil)
+
+	w := httptest.NewRecorder()
+	handleBlobRequest(w, httptest.NewRequest(http.MethodPost, "/blobs/1/touch", nil), clientPool)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"id":"1","ttl":3600}`, w.Body.String())
+}
+
+// Touching a missing blob responds 404 without writing
+func TestHandlePOSTTouchMissing(t *testing.T) {
+	defer func(old time.Duration) { blobTTL = old }(blobTTL)
+	blobTTL = time.Hour
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- mockClient
+
+	mockClient.EXPECT().Get(gomock.Any(), []byte("blob:404")).Return(nil, nil)
+
+	w := httptest.NewRecorder()
+	handleBlobRequest(w, httptest.NewRequest(http.MethodPost, "/blobs/404/touch", nil), clientPool)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, `{"error":"Blob not found"}`, w.Body.String())
+}
+
+// Touch needs BLOB_TTL and a POST
+func TestHandlePOSTTouchRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- mockClient
+
+	w := httptest.NewRecorder()
+	handleBlobRequest(w, httptest.NewRequest(http.MethodPost, "/blobs/1/touch", nil), clientPool)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	handleBlobRequest(w, httptest.NewRequest(http.MethodGet, "/blobs/1/touch", nil), clientPool)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+// New blobs are written with the TTL when one is configured, rounded up to whole seconds
+func TestInsertBlobUsesTTL(t *testing.T) {
+	defer func(old time.Duration) { blobTTL = old }(blobTTL)
+	blobTTL = 1500 * time.Millisecond
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Scan(gomock.Any(), []byte("blob:"), []byte("blob;"), 100).Return(nil, nil, nil)
+	mockClient.EXPECT().PutWithTTL(gomock.Any(), gomock.Any(), []byte("fresh"), uint64(2)).Return(nil)
+
+	w := httptest.NewRecorder()
+	handlePOST(w, httptest.NewRequest(http.MethodPost, "/?blob=fresh", nil), mockClient)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"embed"
+	"html/template"
+	"log"
+	"net/http"
+)
+
+//go:embed ui/index.html
+var uiFiles embed.FS
+
+// uiPage is the blob browser served at / with ENABLE_UI.
+var uiPage = template.Must(template.ParseFS(uiFiles, "ui/index.html"))
+
+// isUIRequest reports whether r should get the blob browser rather than the API:
+// ENABLE_UI is set and r is a plain GET of / with no query. Every API request carries a path or a query, so none is shadowed.
+func isUIRequest(r *http.Request) bool {
+	return enableUI && r.Method == http.MethodGet && r.URL.Path == "/" && r.URL.RawQuery == ""
+}
+
+// handleUI serves the blob browser, a single page that lists, adds and deletes blobs through the JSON API.
+func handleUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := uiPage.Execute(w, map[string]string{"Field": blobFieldName}); err != nil {
+		log.Printf("Failed to render UI: %v", err)
+	}
+}
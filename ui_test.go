@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// With ENABLE_UI a plain GET / serves the HTML page without touching TiKV
+func TestUIEnabledServesHTML(t *testing.T) {
+	defer func(old bool) { enableUI = old }(enableUI)
+	enableUI = true
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- NewMockRawKVClientInterface(ctrl)
+
+	w := httptest.NewRecorder()
+	setupServer(clientPool).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "<title>tikvapi blobs</title>")
+	assert.Contains(t, w.Body.String(), `const field = "blob";`)
+}
+
+// With ENABLE_UI, API requests on / still reach the API
+func TestUIEnabledKeepsAPIRoutes(t *testing.T) {
+	defer func(old bool) { enableUI = old }(enableUI)
+	enableUI = true
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil, nil).AnyTimes()
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- mockClient
+
+	w := httptest.NewRecorder()
+	setupServer(clientPool).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?action=random", nil))
+
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+}
+
+// Without ENABLE_UI, GET / keeps its JSON behavior
+func TestUIDisabledServesJSON(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockClient := NewMockRawKVClientInterface(ctrl)
+	mockClient.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, nil, nil).AnyTimes()
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- mockClient
+
+	w := httptest.NewRecorder()
+	setupServer(clientPool).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+}
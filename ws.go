@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket limits. Clients must answer pings within WSPongWait or the connection is closed.
+const (
+	WSMaxMessageSize = 1 << 20
+	WSPingInterval   = 30 * time.Second
+	WSPongWait       = 60 * time.Second
+	WSWriteWait      = 10 * time.Second
+)
+
+var wsUpgrader = websocket.Upgrader{}
+
+// wsCommand is a command frame sent by a WebSocket client.
+type wsCommand struct {
+	Op string `json:"op"`
+	rpcParams
+}
+
+// wsResult is the frame sent back for each command: the result on success, or the HTTP status and error message.
+type wsResult struct {
+	Op     string          `json:"op"`
+	Status int             `json:"status"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// handleWebSocket upgrades GET /ws to a WebSocket and answers JSON command frames until the client disconnects
+// or the request context ends. The ops create, get, delete, list and count take the same parameters as the
+// JSON-RPC methods on /rpc, and each command borrows a client from the pool only while it runs.
+func handleWebSocket(w http.ResponseWriter, r *http.Request, clientPool chan RawKVClientInterface) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Failed to upgrade WebSocket: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	conn.SetReadLimit(WSMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(WSPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(WSPongWait))
+	})
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(WSPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(WSWriteWait)); err != nil {
+					return
+				}
+			case <-r.Context().Done():
+				// Unblocks the read loop below.
+				conn.Close()
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		_, frame, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("WebSocket closed: %v", err)
+			}
+			return
+		}
+
+		result := wsResult{Status: http.StatusBadRequest, Error: "Invalid command"}
+		var cmd wsCommand
+		if err := json.Unmarshal(frame, &cmd); err == nil {
+			result = runWSCommand(r, clientPool, cmd)
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(WSWriteWait))
+		if err := conn.WriteJSON(result); err != nil {
+			log.Printf("Failed to write WebSocket frame: %v", err)
+			return
+		}
+	}
+}
+
+// runWSCommand runs cmd with a pooled client through the JSON-RPC method of the same name.
+func runWSCommand(r *http.Request, clientPool chan RawKVClientInterface, cmd wsCommand) wsResult {
+	client := getClientFromPool(clientPool)
+	if client == nil {
+		log.Println("No TiKV client available: clientPool empty")
+		return wsResult{Op: cmd.Op, Status: http.StatusServiceUnavailable, Error: "No TiKV client available"}
+	}
+	defer func() {
+		clientPool <- client
+	}()
+
+	result, rpcErr := callRPC(r, client, "blob."+cmd.Op, cmd.rpcParams)
+	if rpcErr == nil {
+		return wsResult{Op: cmd.Op, Status: http.StatusOK, Result: result}
+	}
+	status := http.StatusBadRequest
+	if data, ok := rpcErr.Data.(map[string]int); ok {
+		status = data["status"]
+	}
+	message := rpcErr.Message
+	if rpcErr.Code == RPCMethodNotFound {
+		message = "Unknown op"
+	}
+	return wsResult{Op: cmd.Op, Status: status, Error: message}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// dialTestWebSocket serves the full middleware stack with client in the pool and opens a WebSocket to /ws.
+func dialTestWebSocket(t *testing.T, client RawKVClientInterface) *websocket.Conn {
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- client
+	server := httptest.NewServer(withMiddleware(setupServer(clientPool)))
+	t.Cleanup(server.Close)
+
+	header := http.Header{"Accept-Encoding": {"gzip"}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", header)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// The upgrade goes through every middleware, each of which must let the connection be hijacked
+func TestWebSocketUpgradeThroughMiddleware(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clientPool := make(chan RawKVClientInterface, 1)
+	clientPool <- NewMockRawKVClientInterface(ctrl)
+	server := httptest.NewServer(withMiddleware(setupServer(clientPool)))
+	defer server.Close()
+
+	header := http.Header{"Accept-Encoding": {"gzip"}, "X-Request-ID": {"ws-upgrade"}}
+	for _, path := range []string{"/ws", "/ws?pretty=true"} {
+		conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+path, header)
+		if !assert.NoError(t, err, path) {
+			continue
+		}
+		assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode, path)
+		conn.Close()
+	}
+}
+
+// A blob created over the socket can be read back by id
+func TestWebSocketCreateAndGet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, store := newMemoryClient(ctrl)
+	conn := dialTestWebSocket(t, mockClient)
+
+	assert.NoError(t, conn.WriteJSON(map[string]string{"op": "create", "blob": "over the wire"}))
+	_, frame, err := conn.ReadMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"op":"create","status":200,"result":{"blob":"over the wire"}}`+"\n", string(frame))
+
+	var id string
+	for key := range store {
+		id = strings.TrimPrefix(key, "blob:")
+	}
+	assert.NoError(t, conn.WriteJSON(map[string]string{"op": "get", "id": id}))
+	_, frame, err = conn.ReadMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"op":"get","status":200,"result":{"blob":"over the wire"}}`+"\n", string(frame))
+}
+
+// Errors are reported per frame without closing the socket
+func TestWebSocketErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient, _ := newMemoryClient(ctrl)
+	conn := dialTestWebSocket(t, mockClient)
+
+	for frame, expected := range map[string]string{
+		`{"op":"get","id":"404"}`: `{"op":"get","status":404,"error":"Blob not found"}`,
+		`{"op":"rename"}`:         `{"op":"rename","status":400,"error":"Unknown op"}`,
+		`{"op":`:                  `{"op":"","status":400,"error":"Invalid command"}`,
+	} {
+		assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(frame)))
+		_, reply, err := conn.ReadMessage()
+		assert.NoError(t, err)
+		assert.Equal(t, expected+"\n", string(reply))
+	}
+}
+
+// Frames over the size limit close the connection
+func TestWebSocketMessageTooLarge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn := dialTestWebSocket(t, NewMockRawKVClientInterface(ctrl))
+
+	assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("a", WSMaxMessageSize+1))))
+	_, _, err := conn.ReadMessage()
+	assert.Error(t, err)
+}